@@ -6,10 +6,21 @@ import os
 import sys
 import codecs
 
+# For each level certs can be aggregated at, the fields of a cert that
+# identify what it's aggregated under and name it.
+LEVELS = {
+  "issuer": ("IssuerKey", "IssuerDN"),
+  "root": ("RootKey", "RootDN"),
+  "caOwner": ("CAOwner", "CAOwner"),
+}
+
 
 def main():
-  if len(sys.argv) != 3:
-    sys.exit("Usage: " + sys.argv[0] + " <certs.json> <output_file.csv>")
+  if len(sys.argv) not in (3, 4) or (len(sys.argv) == 4 and
+                                     sys.argv[3] not in LEVELS):
+    sys.exit("Usage: " + sys.argv[0] +
+             " <certs.json> <output_file.csv> [issuer|root|caOwner]")
+  key_field, name_field = LEVELS[sys.argv[3] if len(sys.argv) == 4 else "issuer"]
 
   f_in = open(sys.argv[1], "r")
   #f_out = codecs.open(sys.argv[2], "w", encoding='utf8')
@@ -18,49 +29,33 @@ def main():
 
   certs = blob["Certs"]
 
+  # One column per check that sunlight ran, taken from the first cert.
+  checks = sorted(certs[0]["Violations"].keys()) if certs else []
+
   issuers = {};
+  names = {};
   for c in certs:
-    issuer = c["Issuer"]
+    issuer = c.get(key_field)
+    if not issuer:
+      # e.g. the root of a cert that doesn't chain to any root program
+      continue
     if not issuer in issuers:
-      issuers[issuer] = { "DeprecatedVersion": 0,
-                          "DeprecatedSignatureAlgorithm": 0,
-                          "ExpTooSmall": 0,
-                          "IsCA": 0,
-                          "KeyTooShort": 0,
-                          "MissingCNinSAN": 0,
-                          "ValidPeriodTooLong": 0 }
-    if c["DeprecatedVersion"]:
-      issuers[issuer]["DeprecatedVersion"] += 1
-    if c["DeprecatedSignatureAlgorithm"]:
-      issuers[issuer]["DeprecatedSignatureAlgorithm"] += 1
-    if c["ExpTooSmall"]:
-      issuers[issuer]["ExpTooSmall"] += 1
+      issuers[issuer] = dict((check, 0) for check in checks)
+      issuers[issuer]["IsCA"] = 0
+      names[issuer] = c[name_field]
+    for check in checks:
+      if c["Violations"].get(check):
+        issuers[issuer][check] += 1
     if c["IsCA"]:
       issuers[issuer]["IsCA"] += 1
-    if c["KeyTooShort"]:
-      issuers[issuer]["KeyTooShort"] += 1
-    if c["MissingCNinSAN"]:
-      issuers[issuer]["MissingCNinSAN"] += 1
-    if c["ValidPeriodTooLong"]:
-      issuers[issuer]["ValidPeriodTooLong"] += 1
 
-  f_out.write("issuer,deprecatedVersion,deprecatedSignatureAlgorithm,expTooSmall,isCA,keyTooShort,missingCNinSAN,validPeriodTooLong,n_violations\n");
+  f_out.write(",".join(["issuer"] + checks + ["isCA", "n_violations"]) + "\n");
   for issuer in issuers:
-    n_violations = (issuers[issuer]["DeprecatedVersion"] +
-          issuers[issuer]["DeprecatedSignatureAlgorithm"] +
-          issuers[issuer]["ExpTooSmall"] +
-          issuers[issuer]["KeyTooShort"] +
-          issuers[issuer]["MissingCNinSAN"] +
-          issuers[issuer]["ValidPeriodTooLong"])
-    f_out.write("%s,%d,%d,%d,%d,%d,%d,%d,%d\n" % (
-                issuer.encode('utf-8').replace(",", " - "),
-                issuers[issuer]["DeprecatedVersion"],
-                issuers[issuer]["DeprecatedSignatureAlgorithm"],
-                issuers[issuer]["ExpTooSmall"],
-                issuers[issuer]["IsCA"],
-                issuers[issuer]["KeyTooShort"],
-                issuers[issuer]["MissingCNinSAN"],
-                issuers[issuer]["ValidPeriodTooLong"], n_violations));
+    n_violations = sum(issuers[issuer][check] for check in checks)
+    f_out.write("%s,%s,%d,%d\n" % (
+                names[issuer].encode('utf-8').replace(",", " - "),
+                ",".join(str(issuers[issuer][check]) for check in checks),
+                issuers[issuer]["IsCA"], n_violations));
 
 if __name__ == "__main__":
   main()
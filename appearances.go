@@ -0,0 +1,84 @@
+package sunlight
+
+// Where a certificate was seen: the log it was in (a log URL or entries
+// file) and the index of its entry.
+type LogAppearance struct {
+	Log   string
+	Index uint64
+}
+
+// Where the appearances CertAppearances has seen are kept, so that they can
+// be looked up without holding every fingerprint in memory (e.g. a DB table
+// indexed by fingerprint).
+type AppearanceStore interface {
+	// Returns where the cert with the given fingerprint has been seen, first
+	// appearance first.
+	Appearances(fingerprint string) ([]LogAppearance, error)
+	// Records that the cert with the given fingerprint was seen at appearance.
+	Add(fingerprint string, appearance LogAppearance) error
+}
+
+// An AppearanceStore in memory, for when there are few enough certificates.
+type MemoryAppearanceStore struct {
+	// Map of fingerprint to where the cert was seen, in the order it was seen
+	appearances map[string][]LogAppearance
+}
+
+func NewMemoryAppearanceStore() *MemoryAppearanceStore {
+	return &MemoryAppearanceStore{make(map[string][]LogAppearance)}
+}
+
+func (store *MemoryAppearanceStore) Appearances(fingerprint string) ([]LogAppearance, error) {
+	return store.appearances[fingerprint], nil
+}
+
+func (store *MemoryAppearanceStore) Add(fingerprint string, appearance LogAppearance) error {
+	store.appearances[fingerprint] = append(store.appearances[fingerprint], appearance)
+	return nil
+}
+
+// Keeps track of the certificates seen across several logs (or logged more
+// than once in the same log) by SHA-256 fingerprint, so that each is only
+// counted once, and of where each was seen. The appearances themselves are
+// kept in an AppearanceStore.
+type CertAppearances struct {
+	// Count of appearances of certs that had already been seen
+	DuplicateCount uint64
+	store          AppearanceStore
+}
+
+func NewCertAppearances(store AppearanceStore) *CertAppearances {
+	appearances := new(CertAppearances)
+	appearances.store = store
+	return appearances
+}
+
+// Records that the cert with the given fingerprint was seen at appearance.
+// Returns whether this is the first time the cert has been seen, in which
+// case it should be counted. Seeing the cert at the same appearance again
+// (e.g. when a certificate inventory is checked again) has no effect.
+func (certs *CertAppearances) Add(fingerprint string, appearance LogAppearance) (bool, error) {
+	appearances, err := certs.store.Appearances(fingerprint)
+	if err != nil {
+		return false, err
+	}
+	for _, seen := range appearances {
+		if seen == appearance {
+			return false, nil
+		}
+	}
+	if err := certs.store.Add(fingerprint, appearance); err != nil {
+		return false, err
+	}
+	first := len(appearances) == 0
+	if !first {
+		certs.DuplicateCount += 1
+	}
+	return first, nil
+}
+
+// Returns where the cert with the given fingerprint has been seen, first
+// appearance first.
+func (certs *CertAppearances) Appearances(fingerprint string) ([]LogAppearance, error) {
+	return certs.store.Appearances(fingerprint)
+}
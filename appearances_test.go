@@ -0,0 +1,50 @@
+package sunlight
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCertAppearances(t *testing.T) {
+	store := NewMemoryAppearanceStore()
+	certs := NewCertAppearances(store)
+	add := func(fingerprint string, appearance LogAppearance) bool {
+		first, err := certs.Add(fingerprint, appearance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return first
+	}
+	if !add("a", LogAppearance{"log1", 5}) {
+		t.Error("First appearance should be counted")
+	}
+	if add("a", LogAppearance{"log2", 7}) {
+		t.Error("Cert seen in another log shouldn't be counted again")
+	}
+	if add("a", LogAppearance{"log1", 9}) {
+		t.Error("Cert logged twice shouldn't be counted again")
+	}
+	if add("a", LogAppearance{"log2", 7}) {
+		t.Error("Cert seen at the same place shouldn't be counted again")
+	}
+	if !add("b", LogAppearance{"log2", 8}) {
+		t.Error("Different cert should be counted")
+	}
+	expected := []LogAppearance{{"log1", 5}, {"log2", 7}, {"log1", 9}}
+	if appearances, _ := certs.Appearances("a"); !reflect.DeepEqual(appearances, expected) {
+		t.Errorf("Unexpected appearances %v", appearances)
+	}
+	if appearances, _ := certs.Appearances("c"); len(appearances) != 0 {
+		t.Error("Unseen cert shouldn't have appearances")
+	}
+	if certs.DuplicateCount != 2 {
+		t.Errorf("Expected 2 duplicates, got %d", certs.DuplicateCount)
+	}
+
+	// A new CertAppearances (as in a later run) finds the certs seen before
+	// by looking them up in the store.
+	resumed := NewCertAppearances(store)
+	if first, err := resumed.Add("b", LogAppearance{"log3", 1}); err != nil || first {
+		t.Error("Cert seen by an earlier run shouldn't be counted again")
+	}
+}
@@ -0,0 +1,220 @@
+package sunlight
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// A validated path from a certificate to a root in a root store.
+type CertPath struct {
+	// The CA certificates between the certificate and the root, starting with
+	// the one that issued the certificate. Empty if the root issued it.
+	Intermediates []*x509.Certificate
+	Root          *Root
+}
+
+// Returns the sha256 fingerprints of the certificates in path, from the
+// certificate's issuer up to the root.
+func (path *CertPath) Fingerprints() []string {
+	var fingerprints []string
+	for _, intermediate := range path.Intermediates {
+		fingerprints = append(fingerprints, Sha256Fingerprint(intermediate))
+	}
+	return append(fingerprints, Sha256Fingerprint(path.Root.Cert))
+}
+
+// Returns the certificate that issued the certificate path is for.
+func (path *CertPath) Issuer() *x509.Certificate {
+	if len(path.Intermediates) > 0 {
+		return path.Intermediates[0]
+	}
+	return path.Root.Cert
+}
+
+// Returns whether cert can be an intermediate: a CA certificate, or a
+// version 1 certificate, which can't say.
+func canIssue(cert *x509.Certificate) bool {
+	return (cert.BasicConstraintsValid && cert.IsCA) || cert.Version < 3
+}
+
+// Returns whether issuer issued cert: cert names issuer's subject as its
+// issuer, their key identifiers match (where both have them), issuer was
+// valid at issuance (the time the certificate at the bottom of the path was
+// issued) and issuer's key verifies cert's signature. A precertificate from
+// ParsePrecertificate has no signature, so for one of those only the rest is
+// checked.
+func issued(issuer *x509.Certificate, cert *x509.Certificate, issuance time.Time) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 &&
+		!bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+		return false
+	}
+	if issuance.Before(issuer.NotBefore) || issuance.After(issuer.NotAfter) {
+		return false
+	}
+	if len(cert.Signature) == 0 {
+		return true
+	}
+	return issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate,
+		cert.Signature) == nil
+}
+
+// Returns a path from cert through the certificates in chain (in any order)
+// to a root in roots, or nil if there isn't one. Every certificate on the
+// path must have been valid when cert was issued (its notBefore). A path to
+// a root that's trusted for websites as of cert's notBefore is preferred
+// over one to a root that isn't. Precertificates in chain (e.g. the one a
+// final certificate's log entry was issued from) are never intermediates.
+func BuildPath(cert *x509.Certificate, chain []*x509.Certificate, roots *RootStore) *CertPath {
+	var untrusted *CertPath
+	used := make([]bool, len(chain))
+	var build func(current *x509.Certificate, intermediates []*x509.Certificate) *CertPath
+	build = func(current *x509.Certificate, intermediates []*x509.Certificate) *CertPath {
+		for _, root := range roots.IssuersOf(current) {
+			if !issued(root.Cert, current, cert.NotBefore) {
+				continue
+			}
+			path := &CertPath{append([]*x509.Certificate(nil), intermediates...), root}
+			if root.TrustedForWebsites(cert.NotBefore) {
+				return path
+			}
+			if untrusted == nil {
+				untrusted = path
+			}
+		}
+		for i, candidate := range chain {
+			if used[i] || !canIssue(candidate) || IsPrecertificate(candidate) ||
+				!issued(candidate, current, cert.NotBefore) {
+				continue
+			}
+			used[i] = true
+			if path := build(candidate, append(intermediates, candidate)); path != nil {
+				return path
+			}
+			used[i] = false
+		}
+		return nil
+	}
+	if path := build(cert, nil); path != nil {
+		return path
+	}
+	return untrusted
+}
+
+// Returns the certificate in chain that issued cert (see issued), or nil if
+// there isn't one.
+func FindIssuer(cert *x509.Certificate, chain []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range chain {
+		if canIssue(candidate) && !IsPrecertificate(candidate) &&
+			issued(candidate, cert, cert.NotBefore) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// Returns the key that identifies the CA that issued cert, so that CAs with
+// the same name are told apart and a re-keyed CA is a new issuer. This is
+// the SPKIHash of issuer, the certificate that issued cert, if it's known.
+// Otherwise it's "keyid:" and cert's hex authority key identifier, which
+// also identifies the issuer's key (though not the same way, so an
+// IssuerKeyMap is needed to tell that it's the same issuer), or for a cert
+// without one, "dn:" and its issuer's RFC 4514 DN.
+func IssuerKey(cert *x509.Certificate, issuer *x509.Certificate) string {
+	if issuer != nil {
+		return SPKIHash(issuer)
+	}
+	if keyId := authorityKeyIdKey(cert); len(keyId) > 0 {
+		return keyId
+	}
+	return "dn:" + cert.Issuer.String()
+}
+
+// Returns the "keyid:" issuer key of cert (see IssuerKey), or "" if it has
+// no authority key identifier.
+func authorityKeyIdKey(cert *x509.Certificate) string {
+	if len(cert.AuthorityKeyId) == 0 {
+		return ""
+	}
+	return "keyid:" + hex.EncodeToString(cert.AuthorityKeyId)
+}
+
+// Maps the "keyid:" issuer keys of certs whose issuer wasn't known (see
+// IssuerKey) to the SPKIHash of their issuer, as learned from the certs with
+// the same authority key identifier whose issuer was known. This keeps an
+// issuer from being split in two when its certificate is only sometimes
+// logged with the certs it issued.
+type IssuerKeyMap struct {
+	byKeyId map[string]string
+}
+
+func NewIssuerKeyMap() *IssuerKeyMap {
+	return &IssuerKeyMap{make(map[string]string)}
+}
+
+// Records that the "keyid:" issuer key keyId is the issuer with the key
+// hash issuerKey.
+func (keys *IssuerKeyMap) Add(keyId string, issuerKey string) {
+	keys.byKeyId[keyId] = issuerKey
+}
+
+// Returns the key hash of the issuer identified by issuerKey if it's a
+// "keyid:" key that's in the map, and otherwise issuerKey itself.
+func (keys *IssuerKeyMap) Resolve(issuerKey string) string {
+	if resolved, ok := keys.byKeyId[issuerKey]; ok {
+		return resolved
+	}
+	return issuerKey
+}
+
+// Resolves summary's IssuerKey through the map if it's a "keyid:" key, or if
+// it's the key hash of cert's issuer, records it for cert's authority key
+// identifier. Returns the "keyid:" key if that's the first time it's
+// recorded (so that whatever was kept under it can be merged into the
+// issuer's), and otherwise "".
+func (keys *IssuerKeyMap) Apply(cert *x509.Certificate, summary *CertSummary) string {
+	if strings.HasPrefix(summary.IssuerKey, "keyid:") {
+		summary.IssuerKey = keys.Resolve(summary.IssuerKey)
+		return ""
+	}
+	if strings.HasPrefix(summary.IssuerKey, "dn:") {
+		return ""
+	}
+	keyId := authorityKeyIdKey(cert)
+	if len(keyId) == 0 || keys.byKeyId[keyId] == summary.IssuerKey {
+		return ""
+	}
+	keys.Add(keyId, summary.IssuerKey)
+	return keyId
+}
+
+// Returns the CA organisation that owns root: its owner if the root store
+// says who that is, otherwise its organization.
+func RootOwner(root *Root) string {
+	if len(root.Owner) > 0 {
+		return root.Owner
+	}
+	if len(root.Cert.Subject.Organization) > 0 {
+		return root.Cert.Subject.Organization[0]
+	}
+	return root.Cert.Subject.String()
+}
+
+// Returns the CA organisation that owns cert's issuer as far as the root
+// store knows: the owner of the root at the end of path (see RootOwner), or
+// the organization of the issuer if there's no path. An OwnerMap can say
+// otherwise (see OwnerMap.Apply).
+func CAOwner(cert *x509.Certificate, path *CertPath) string {
+	if path != nil {
+		return RootOwner(path.Root)
+	}
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0]
+	}
+	return cert.Issuer.String()
+}
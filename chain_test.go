@@ -0,0 +1,229 @@
+package sunlight
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Signs template with a fresh P-256 key using parent and parentKey (or
+// self-signs it if parent is nil). Returns the certificate and its key.
+func issueCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal("could not create certificate", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("could not parse certificate", err)
+	}
+	return cert, key
+}
+
+func TestBuildPath(t *testing.T) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Root"
+	root, rootKey := issueCert(t, template, nil, nil)
+	template.Subject.CommonName = "Intermediate"
+	intermediate, intermediateKey := issueCert(t, template, root, rootKey)
+	template.Subject.CommonName = "Other Root"
+	other, _ := issueCert(t, template, nil, nil)
+	store := NewRootStore()
+	store.Add(&Root{Cert: root, Websites: true,
+		WebsitesDistrustAfter: notBefore.AddDate(0, 6, 0)})
+
+	leaf, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		intermediate, intermediateKey)
+	for _, chain := range [][]*x509.Certificate{
+		{intermediate},
+		{intermediate, root},
+		{other, root, intermediate},
+	} {
+		path := BuildPath(leaf, chain, store)
+		if path == nil {
+			t.Fatal("Expected a path to the root")
+		}
+		if !reflect.DeepEqual(path.Fingerprints(),
+			[]string{Sha256Fingerprint(intermediate), Sha256Fingerprint(root)}) {
+			t.Error("Unexpected path", path.Fingerprints())
+		}
+	}
+	if BuildPath(leaf, nil, store) != nil {
+		t.Error("Shouldn't find a path without the intermediate")
+	}
+	if BuildPath(leaf, []*x509.Certificate{intermediate}, nil) != nil {
+		t.Error("Shouldn't find a path without a root store")
+	}
+
+	programs := []RootProgram{{ROOT_PROGRAM_MOZILLA, store}}
+	summary, _ := CalculateCertSummary(leaf, 0, nil, []*x509.Certificate{intermediate}, programs)
+	if !summary.InRootProgram(ROOT_PROGRAM_MOZILLA) || summary.Root != "CN=Root" ||
+		summary.Intermediate != "CN=Intermediate" || len(summary.Path) != 2 {
+		t.Errorf("Unexpected attribution %v %s %s %v", summary.RootPrograms,
+			summary.Root, summary.Intermediate, summary.Path)
+	}
+
+	// Issued by the root directly
+	direct, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)), root, rootKey)
+	summary, _ = CalculateCertSummary(direct, 0, nil, nil, programs)
+	if !summary.InRootProgram(ROOT_PROGRAM_MOZILLA) || summary.Root != "CN=Root" || summary.Intermediate != "" ||
+		!reflect.DeepEqual(summary.Path, []string{Sha256Fingerprint(root)}) {
+		t.Error("Cert should chain to the root directly")
+	}
+
+	// Issued after the root's distrust-after date: still attributed to the
+	// root, but not trusted.
+	late, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 7, 0)),
+		intermediate, intermediateKey)
+	summary, _ = CalculateCertSummary(late, 0, nil, []*x509.Certificate{intermediate}, programs)
+	if len(summary.RootPrograms) != 0 || summary.Root != "CN=Root" {
+		t.Error("Cert issued after the distrust-after date shouldn't be trusted")
+	}
+
+	// Issued before the intermediate was
+	early, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, -1, 0)),
+		intermediate, intermediateKey)
+	if BuildPath(early, []*x509.Certificate{intermediate}, store) != nil {
+		t.Error("Intermediate wasn't valid when the cert was issued")
+	}
+
+	// Issued via an intermediate that was valid at the time, but to a root
+	// that had already expired
+	template = caTemplate(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC))
+	template.NotAfter = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	template.Subject.CommonName = "Expired Root"
+	expiredRoot, expiredRootKey := issueCert(t, template, nil, nil)
+	template = caTemplate(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	template.NotAfter = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	template.Subject.CommonName = "Long-lived Intermediate"
+	longLived, longLivedKey := issueCert(t, template, expiredRoot, expiredRootKey)
+	expiredStore := NewRootStore()
+	expiredStore.Add(&Root{Cert: expiredRoot, Websites: true})
+	recent, _ := issueCert(t, subscriberTemplate(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)),
+		longLived, longLivedKey)
+	if BuildPath(recent, []*x509.Certificate{longLived}, expiredStore) != nil {
+		t.Error("The root wasn't valid when the cert was issued")
+	}
+	old, _ := issueCert(t, subscriberTemplate(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)),
+		longLived, longLivedKey)
+	if BuildPath(old, []*x509.Certificate{longLived}, expiredStore) == nil {
+		t.Error("The whole path was valid when the cert was issued")
+	}
+
+	// Same issuer name and key identifier, but signed by another key
+	template = caTemplate(notBefore)
+	template.Subject.CommonName = "Intermediate"
+	template.SubjectKeyId = intermediate.SubjectKeyId
+	impostor, impostorKey := issueCert(t, template, nil, nil)
+	forged, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		impostor, impostorKey)
+	if BuildPath(forged, []*x509.Certificate{intermediate}, store) != nil {
+		t.Error("Intermediate's key didn't sign the cert")
+	}
+
+	// Precertificates from log entries have no signature.
+	precert, err := ParsePrecertificate(leaf.RawTBSCertificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BuildPath(precert, []*x509.Certificate{intermediate}, store) == nil {
+		t.Error("Expected a path for the precertificate")
+	}
+}
+
+func TestRootPrograms(t *testing.T) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Root"
+	root, rootKey := issueCert(t, template, nil, nil)
+	template.Subject.CommonName = "Cross-signing Root"
+	crossRoot, crossRootKey := issueCert(t, template, nil, nil)
+	template.Subject.CommonName = "Intermediate"
+	intermediate, intermediateKey := issueCert(t, template, root, rootKey)
+	// The same intermediate, cross-signed
+	template.PublicKey = nil
+	crossSigned, err := x509.CreateCertificate(rand.Reader, template, crossRoot,
+		&intermediateKey.PublicKey, crossRootKey)
+	if err != nil {
+		t.Fatal("could not create certificate", err)
+	}
+	cross, err := x509.ParseCertificate(crossSigned)
+	if err != nil {
+		t.Fatal("could not parse certificate", err)
+	}
+	leaf, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		intermediate, intermediateKey)
+
+	rootOnly := func(root *x509.Certificate, websites bool) *RootStore {
+		store := NewRootStore()
+		store.Add(&Root{Cert: root, Websites: websites})
+		return store
+	}
+	programs := []RootProgram{
+		{ROOT_PROGRAM_MICROSOFT, rootOnly(root, false)},
+		{ROOT_PROGRAM_MOZILLA, rootOnly(root, true)},
+		{ROOT_PROGRAM_APPLE, rootOnly(crossRoot, true)},
+		{ROOT_PROGRAM_CHROME, NewRootStore()},
+	}
+	summary, _ := CalculateCertSummary(leaf, 0, nil,
+		[]*x509.Certificate{intermediate, cross}, programs)
+	if !reflect.DeepEqual(summary.RootPrograms,
+		[]string{ROOT_PROGRAM_MOZILLA, ROOT_PROGRAM_APPLE}) {
+		t.Errorf("Unexpected root programs %v", summary.RootPrograms)
+	}
+	// Microsoft's path comes first, but Mozilla is the first to trust it.
+	if summary.Root != "CN=Root" ||
+		summary.Path[1] != Sha256Fingerprint(root) {
+		t.Errorf("Cert should be attributed to Mozilla's path, not %s", summary.Root)
+	}
+	summary, _ = CalculateCertSummary(leaf, 0, nil,
+		[]*x509.Certificate{intermediate}, programs)
+	if !reflect.DeepEqual(summary.RootPrograms, []string{ROOT_PROGRAM_MOZILLA}) {
+		t.Errorf("Apple's root can't be reached without the cross-signed intermediate")
+	}
+}
+
+func TestIssuerKeyMap(t *testing.T) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Intermediate"
+	template.SubjectKeyId = []byte{1, 2, 3, 4}
+	intermediate, intermediateKey := issueCert(t, template, nil, nil)
+	leaf, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		intermediate, intermediateKey)
+
+	keys := NewIssuerKeyMap()
+	unknown := &CertSummary{IssuerKey: IssuerKey(leaf, nil)}
+	if keys.Apply(leaf, unknown) != "" || unknown.IssuerKey != "keyid:01020304" {
+		t.Errorf("Unexpected issuer key %s before the issuer is seen", unknown.IssuerKey)
+	}
+	known := &CertSummary{IssuerKey: IssuerKey(leaf, intermediate)}
+	if keys.Apply(leaf, known) != "keyid:01020304" {
+		t.Error("Should have learned the issuer of the key identifier")
+	}
+	if keys.Apply(leaf, known) != "" {
+		t.Error("Should only learn the issuer of a key identifier once")
+	}
+	unknown = &CertSummary{IssuerKey: IssuerKey(leaf, nil)}
+	keys.Apply(leaf, unknown)
+	if unknown.IssuerKey != SPKIHash(intermediate) {
+		t.Errorf("Expected the issuer's key hash, got %s", unknown.IssuerKey)
+	}
+	byDN := &CertSummary{IssuerKey: "dn:CN=Intermediate"}
+	if keys.Apply(leaf, byDN) != "" || byDN.IssuerKey != "dn:CN=Intermediate" {
+		t.Error("Shouldn't resolve or learn from a DN issuer key")
+	}
+}
@@ -0,0 +1,225 @@
+package sunlight
+
+import (
+	"code.google.com/p/go.net/idna"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type Severity int
+
+const (
+	SEVERITY_NOTICE Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_NOTICE:
+		return "notice"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_ERROR:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Check is a single Baseline Requirements rule. Everything that is keyed by
+// rule (CertSummary.Violations, the columns of the sqlite tables, the scores
+// in IssuerReputation) is derived from the set of registered checks, so adding
+// a rule only means writing a new Check and registering it.
+type Check interface {
+	// A stable, unique name for the check, e.g. "ValidPeriodTooLong". This
+	// is used as the key in CertSummary.Violations.
+	ID() string
+	// The section of the Baseline Requirements the check enforces.
+	BRSection() string
+	Severity() Severity
+	// Certificates issued before this date are not evaluated. The zero time
+	// means the check always applies.
+	EffectiveDate() time.Time
+	// Returns true if cert violates the rule. chain holds any additional
+	// certificates that were supplied with cert (this may be empty).
+	Run(cert *x509.Certificate, chain []*x509.Certificate) bool
+}
+
+// A Check that can fail to evaluate a certificate, e.g. because something
+// the rule is about can't be parsed. RunCheck calls Evaluate instead of Run
+// for these, so that such certs aren't reported as passing (or failing) the
+// check. Run should return false when Evaluate returns an error.
+type FallibleCheck interface {
+	Check
+	Evaluate(cert *x509.Certificate, chain []*x509.Certificate) (bool, error)
+}
+
+// Returns true if cert violates check, or a *CheckError if check couldn't
+// be evaluated for cert. Doesn't consider whether the check applies to cert
+// (see CheckApplies).
+func RunCheck(check Check, cert *x509.Certificate, chain []*x509.Certificate) (bool, error) {
+	fallible, ok := check.(FallibleCheck)
+	if !ok {
+		return check.Run(cert, chain), nil
+	}
+	violated, err := fallible.Evaluate(cert, chain)
+	if err != nil {
+		return false, &CheckError{check.ID(), err}
+	}
+	return violated, nil
+}
+
+// checkInfo implements everything in Check except Run. Concrete checks embed
+// it so that they only need to provide the rule itself.
+type checkInfo struct {
+	id            string
+	brSection     string
+	severity      Severity
+	effectiveDate time.Time
+}
+
+func (info checkInfo) ID() string               { return info.id }
+func (info checkInfo) BRSection() string        { return info.brSection }
+func (info checkInfo) Severity() Severity       { return info.severity }
+func (info checkInfo) EffectiveDate() time.Time { return info.effectiveDate }
+
+var registeredChecks []Check
+var registeredCheckIDs = make(map[string]bool)
+
+// Adds check to the set of checks run by CalculateCertSummary. This is
+// meant to be called from init functions. If a check with the same ID has
+// already been registered, RegisterCheck panics.
+func RegisterCheck(check Check) {
+	if check == nil {
+		panic("sunlight: RegisterCheck check is nil")
+	}
+	if registeredCheckIDs[check.ID()] {
+		panic("sunlight: RegisterCheck called twice for check " + check.ID())
+	}
+	registeredCheckIDs[check.ID()] = true
+	registeredChecks = append(registeredChecks, check)
+}
+
+// Returns the registered checks in the order they were registered.
+func Checks() []Check {
+	checks := make([]Check, len(registeredChecks))
+	copy(checks, registeredChecks)
+	return checks
+}
+
+// Returns the registered check with the given ID, or nil if there isn't one.
+func CheckByID(id string) Check {
+	for _, check := range registeredChecks {
+		if check.ID() == id {
+			return check
+		}
+	}
+	return nil
+}
+
+// Returns true if check should be evaluated against cert.
+func CheckApplies(check Check, cert *x509.Certificate) bool {
+	effectiveDate := check.EffectiveDate()
+	return effectiveDate.IsZero() || !cert.NotBefore.Before(effectiveDate)
+}
+
+// Converts a check ID into the prefix used for its sqlite column names, e.g.
+// "ValidPeriodTooLong" -> "validPeriodTooLong".
+func ColumnName(id string) string {
+	if len(id) == 0 {
+		return id
+	}
+	return strings.ToLower(id[:1]) + id[1:]
+}
+
+type deprecatedSignatureAlgorithm struct{ checkInfo }
+
+// SignatureAlgorithm is SHA1
+func (deprecatedSignatureAlgorithm) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.SignatureAlgorithm == x509.SHA1WithRSA ||
+		cert.SignatureAlgorithm == x509.DSAWithSHA1 ||
+		cert.SignatureAlgorithm == x509.ECDSAWithSHA1
+}
+
+type deprecatedVersion struct{ checkInfo }
+
+func (deprecatedVersion) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.Version != 3
+}
+
+type missingCNInSAN struct{ checkInfo }
+
+func (check missingCNInSAN) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	violated, _ := check.Evaluate(cert, chain)
+	return violated
+}
+
+// BR 9.2.2: Common Name must be in Subject Alt Names, either as an IP or a
+// DNS name.
+func (missingCNInSAN) Evaluate(cert *x509.Certificate, chain []*x509.Certificate) (bool, error) {
+	// Assume a 0-length CN means it isn't present (this isn't a good
+	// assumption). If the CN is missing, then it can't be missing CN in SAN.
+	if len(cert.Subject.CommonName) == 0 {
+		return false, nil
+	}
+
+	// CNs that aren't valid IDNs are reported by InvalidPunycode. Unless
+	// one appears in the SANs as is, we can't tell which SAN it should match.
+	if err := punycodeError(cert.Subject.CommonName); err != nil {
+		for _, san := range cert.DNSNames {
+			if san == cert.Subject.CommonName {
+				return false, nil
+			}
+		}
+		return false, err
+	}
+	cnAsPunycode, _ := idna.ToASCII(cert.Subject.CommonName)
+
+	cnAsIP := net.ParseIP(cert.Subject.CommonName)
+	if cnAsIP != nil {
+		for _, ip := range cert.IPAddresses {
+			if cnAsIP.Equal(ip) {
+				return false, nil
+			}
+		}
+	} else {
+		for _, san := range cert.DNSNames {
+			if strings.EqualFold(san, cnAsPunycode) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+type keyTooShort struct{ checkInfo }
+
+// Public key length <= 1024 bits
+func (keyTooShort) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	parsedKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	return ok && parsedKey.N.BitLen() <= 1024
+}
+
+type expTooSmall struct{ checkInfo }
+
+func (expTooSmall) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	parsedKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	return ok && parsedKey.E <= 3
+}
+
+func init() {
+	RegisterCheck(deprecatedSignatureAlgorithm{checkInfo{
+		DEPRECATED_SIGNATURE_ALGORITHM, "Appendix A", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(deprecatedVersion{checkInfo{
+		DEPRECATED_VERSION, "9", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(missingCNInSAN{checkInfo{
+		MISSING_CN_IN_SAN, "9.2.2", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(keyTooShort{checkInfo{
+		KEY_TOO_SHORT, "Appendix A", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(expTooSmall{checkInfo{
+		EXP_TOO_SMALL, "Appendix A", SEVERITY_ERROR, time.Time{}}})
+}
@@ -0,0 +1,144 @@
+package sunlight
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Returns a template for a typical subscriber certificate for
+// test.example.com, valid for a year from notBefore.
+func subscriberTemplate(notBefore time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(0).SetBytes([]byte{
+			0x4a, 0x91, 0x3b, 0x07, 0xc2, 0x5e, 0x66, 0x10, 0xd8, 0x3f}),
+		Subject:               pkix.Name{CommonName: "test.example.com"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(1, 0, 0),
+		DNSNames:              []string{"test.example.com"},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+}
+
+// Self-signs template with a fresh P-256 key and returns the parsed result.
+func makeCert(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	return makeCertWithKey(t, template, &key.PublicKey, key)
+}
+
+// Signs template (containing pub) with signer and returns the parsed result.
+func makeCertWithKey(t *testing.T, template *x509.Certificate,
+	pub interface{}, signer interface{}) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, signer)
+	if err != nil {
+		t.Fatal("could not create certificate", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("could not parse certificate", err)
+	}
+	return cert
+}
+
+func TestChecksRegistered(t *testing.T) {
+	for _, id := range []string{VALID_PERIOD_TOO_LONG,
+		DEPRECATED_SIGNATURE_ALGORITHM, DEPRECATED_VERSION, MISSING_CN_IN_SAN,
+		KEY_TOO_SHORT, EXP_TOO_SMALL} {
+		if CheckByID(id) == nil {
+			t.Errorf("Check %s should be registered", id)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, check := range Checks() {
+		if seen[check.ID()] {
+			t.Errorf("Check %s registered twice", check.ID())
+		}
+		seen[check.ID()] = true
+		if len(check.BRSection()) == 0 {
+			t.Errorf("Check %s should have a BR section", check.ID())
+		}
+	}
+}
+
+func TestRegisterCheckTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a check twice should panic")
+		}
+	}()
+	RegisterCheck(deprecatedVersion{checkInfo{
+		DEPRECATED_VERSION, "9", SEVERITY_ERROR, time.Time{}}})
+}
+
+func TestViolationsDerivedFromChecks(t *testing.T) {
+	cert := makeCert(t, subscriberTemplate(time.Now()))
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	if len(summary.Violations) != len(Checks()) {
+		t.Errorf("Expected %d violations, got %d", len(Checks()),
+			len(summary.Violations))
+	}
+	for _, check := range Checks() {
+		if _, present := summary.Violations[check.ID()]; !present {
+			t.Errorf("Violations should contain %s", check.ID())
+		}
+	}
+}
+
+func TestEffectiveDate(t *testing.T) {
+	check := deprecatedVersion{checkInfo{"Test", "9", SEVERITY_ERROR,
+		time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	before := makeCert(t, subscriberTemplate(time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC)))
+	after := makeCert(t, subscriberTemplate(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)))
+	if CheckApplies(check, before) {
+		t.Error("Check should not apply before its effective date")
+	}
+	if !CheckApplies(check, after) {
+		t.Error("Check should apply after its effective date")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	if ColumnName(VALID_PERIOD_TOO_LONG) != "validPeriodTooLong" {
+		t.Error("Unexpected column name", ColumnName(VALID_PERIOD_TOO_LONG))
+	}
+}
+
+func TestCheckCouldNotBeEvaluated(t *testing.T) {
+	template := subscriberTemplate(time.Now())
+	// Not a valid IDN: the label decodes to "abc", which doesn't encode back
+	// to it, so there's no telling which SAN it should match.
+	template.Subject.CommonName = "xn--abc-.example.com"
+	cert := makeCert(t, template)
+	check := CheckByID(MISSING_CN_IN_SAN)
+	violated, err := RunCheck(check, cert, nil)
+	if checkErr, ok := err.(*CheckError); !ok || checkErr.ID != MISSING_CN_IN_SAN {
+		t.Fatalf("Expected a CheckError, got %v", err)
+	}
+	if violated || check.Run(cert, nil) {
+		t.Error("A check that couldn't be evaluated shouldn't be violated")
+	}
+	summary, err := CalculateCertSummary(cert, 0, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.CheckErrors) != 1 || len(summary.CheckErrors[MISSING_CN_IN_SAN]) == 0 {
+		t.Errorf("Unexpected check errors %v", summary.CheckErrors)
+	}
+
+	// The same CN is fine if it's in the SANs as is.
+	template.DNSNames = append(template.DNSNames, template.Subject.CommonName)
+	cert = makeCert(t, template)
+	if violated, err := RunCheck(check, cert, nil); violated || err != nil {
+		t.Errorf("Expected no violation, got %v, %v", violated, err)
+	}
+}
@@ -0,0 +1,383 @@
+// Package ctlog is a client for the RFC 6962 Certificate Transparency log
+// API, along with a fake log for testing it.
+package ctlog
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/monicachew/certificatetransparency"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returned for unsuccessful responses from a log.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("log returned %d: %s", err.StatusCode, err.Body)
+}
+
+// Server errors and rate limiting are worth retrying; anything else won't
+// get better by asking again.
+func isRetryable(err error) bool {
+	httpErr, ok := err.(*HTTPError)
+	return !ok || httpErr.StatusCode >= 500 ||
+		httpErr.StatusCode == http.StatusTooManyRequests
+}
+
+type Client struct {
+	// Base URL of the log, e.g. https://ct.googleapis.com/pilot
+	URL        string
+	HTTPClient *http.Client
+	// Number of entries to ask for in each get-entries request. Logs may
+	// return fewer.
+	BatchSize uint64
+	// How many times to retry a failed request, and how long to wait before
+	// the first retry. The wait doubles after each retry.
+	MaxRetries int
+	Backoff    time.Duration
+	// If set, the signature of every tree head is checked against this key.
+	PublicKey crypto.PublicKey
+}
+
+func NewClient(logURL string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(logURL, "/"),
+		HTTPClient: http.DefaultClient,
+		BatchSize:  1000,
+		MaxRetries: 5,
+		Backoff:    time.Second,
+	}
+}
+
+// Makes a GET request to the given API method and decodes the JSON
+// response into result, retrying as configured.
+func (client *Client) get(method string, params url.Values, result interface{}) error {
+	requestURL := client.URL + "/ct/v1/" + method
+	if len(params) > 0 {
+		requestURL += "?" + params.Encode()
+	}
+	backoff := client.Backoff
+	var err error
+	for attempt := 0; attempt <= client.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = client.getOnce(requestURL, result)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (client *Client) getOnce(requestURL string, result interface{}) error {
+	response, err := client.HTTPClient.Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return &HTTPError{response.StatusCode, string(body)}
+	}
+	return json.Unmarshal(body, result)
+}
+
+// Returns the log's current signed tree head.
+func (client *Client) GetSTH() (*SignedTreeHead, error) {
+	sth := new(SignedTreeHead)
+	if err := client.get("get-sth", nil, sth); err != nil {
+		return nil, err
+	}
+	if client.PublicKey != nil {
+		if err := VerifySTHSignature(sth, client.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	return sth, nil
+}
+
+// Returns the consistency proof between the log's trees of the given sizes.
+func (client *Client) GetSTHConsistency(first, second uint64) ([][]byte, error) {
+	params := url.Values{}
+	params.Set("first", fmt.Sprint(first))
+	params.Set("second", fmt.Sprint(second))
+	var response struct {
+		Consistency [][]byte `json:"consistency"`
+	}
+	if err := client.get("get-sth-consistency", params, &response); err != nil {
+		return nil, err
+	}
+	return response.Consistency, nil
+}
+
+// Returns an error unless the log's tree of size oldSize with root oldRoot
+// is a prefix of the tree sth describes.
+func (client *Client) VerifyConsistency(oldSize uint64, oldRoot []byte,
+	sth *SignedTreeHead) error {
+	if oldSize > sth.TreeSize {
+		return fmt.Errorf("log shrank from %d to %d entries", oldSize, sth.TreeSize)
+	}
+	var proof [][]byte
+	if oldSize > 0 && oldSize < sth.TreeSize {
+		var err error
+		proof, err = client.GetSTHConsistency(oldSize, sth.TreeSize)
+		if err != nil {
+			return err
+		}
+	}
+	if !VerifyConsistency(oldSize, sth.TreeSize, oldRoot, sth.SHA256RootHash, proof) {
+		return fmt.Errorf("tree of size %d with root %x is inconsistent with "+
+			"tree of size %d with root %x", oldSize, oldRoot, sth.TreeSize,
+			sth.SHA256RootHash)
+	}
+	return nil
+}
+
+type leafEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+type getEntriesResponse struct {
+	Entries []leafEntry `json:"entries"`
+}
+
+// Returns the entries from start to end, inclusive. The log may return
+// fewer entries than were asked for, but always at least one.
+func (client *Client) GetEntries(start, end uint64) ([]*Entry, error) {
+	leaves, err := client.getRawEntries(start, end)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, len(leaves.Entries))
+	for i, leaf := range leaves.Entries {
+		entries[i], err = ParseEntry(leaf.LeafInput, leaf.ExtraData)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", start+uint64(i), err)
+		}
+	}
+	return entries, nil
+}
+
+func (client *Client) getRawEntries(start, end uint64) (*getEntriesResponse, error) {
+	params := url.Values{}
+	params.Set("start", fmt.Sprint(start))
+	params.Set("end", fmt.Sprint(end))
+	response := new(getEntriesResponse)
+	if err := client.get("get-entries", params, response); err != nil {
+		return nil, err
+	}
+	if len(response.Entries) == 0 || uint64(len(response.Entries)) > end-start+1 {
+		return nil, fmt.Errorf("log returned %d entries for %d-%d",
+			len(response.Entries), start, end)
+	}
+	return response, nil
+}
+
+// Returns the DER-encoded root certificates the log accepts.
+func (client *Client) GetRoots() ([][]byte, error) {
+	var response struct {
+		Certificates [][]byte `json:"certificates"`
+	}
+	if err := client.get("get-roots", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Certificates, nil
+}
+
+// Returns the index of the leaf with the given hash and its audit path in
+// the tree of the given size.
+func (client *Client) GetProofByHash(leafHash []byte, treeSize uint64) (uint64, [][]byte, error) {
+	params := url.Values{}
+	params.Set("hash", base64.StdEncoding.EncodeToString(leafHash))
+	params.Set("tree_size", fmt.Sprint(treeSize))
+	var response struct {
+		LeafIndex uint64   `json:"leaf_index"`
+		AuditPath [][]byte `json:"audit_path"`
+	}
+	if err := client.get("get-proof-by-hash", params, &response); err != nil {
+		return 0, nil, err
+	}
+	return response.LeafIndex, response.AuditPath, nil
+}
+
+// Calls fn on each of the entries from start up to (but not including) end,
+// fetching them BatchSize at a time. Like EntriesFile.Map, fn is called from
+// several goroutines at once, in no particular order, and is passed an error
+// for entries that can't be parsed. Returns an error if the entries can't be
+// fetched.
+func (client *Client) Scan(start, end uint64,
+	fn func(*certificatetransparency.EntryAndPosition, error)) error {
+	return client.scan(start, end, nil, fn)
+}
+
+// As Scan, also adding each entry to tree if it isn't nil.
+func (client *Client) scan(start, end uint64, tree *MerkleTree,
+	fn func(*certificatetransparency.EntryAndPosition, error)) error {
+	type parsedEntry struct {
+		entry *certificatetransparency.EntryAndPosition
+		err   error
+	}
+	entries := make(chan parsedEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for parsed := range entries {
+				fn(parsed.entry, parsed.err)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(entries)
+
+	for start < end {
+		batchEnd := start + client.BatchSize - 1
+		if batchEnd >= end {
+			batchEnd = end - 1
+		}
+		leaves, err := client.getRawEntries(start, batchEnd)
+		if err != nil {
+			return err
+		}
+		for _, leaf := range leaves.Entries {
+			if tree != nil {
+				tree.AddLeafHash(LeafHash(leaf.LeafInput))
+			}
+			entry, err := ParseEntry(leaf.LeafInput, leaf.ExtraData)
+			// Entries are passed on as the log file reader's are, without
+			// the precertificate.
+			var logEntry *certificatetransparency.LogEntry
+			if entry != nil {
+				logEntry = &entry.LogEntry
+			}
+			entries <- parsedEntry{&certificatetransparency.EntryAndPosition{
+				Index: start,
+				Raw:   leaf.LeafInput,
+				Entry: logEntry,
+			}, err}
+			start++
+		}
+	}
+	return nil
+}
+
+// How far a scan of a log has got.
+type Checkpoint struct {
+	// Entries before this one have been processed.
+	NextIndex uint64
+	// The tree head the processed entries were verified against
+	TreeHead *SignedTreeHead
+	// The Merkle tree of the processed entries
+	Tree *MerkleTree
+}
+
+// Calls fn on the first maxEntries entries of the log (or all of them, if
+// maxEntries is 0), as EntriesFile.Map does for a downloaded log. See
+// VerifiedMap.
+func (client *Client) Map(fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) error {
+	_, err := client.VerifiedMap(nil, fn, maxEntries)
+	return err
+}
+
+// As Map, but checks that the entries are the ones the log has committed to:
+// the tree head must be consistent with previous (a tree head from an
+// earlier run, if not nil), and the Merkle tree of the entries that were
+// scanned must be consistent with it. Returns the verified tree head.
+//
+// Entries are passed to fn before they can be verified, so callers must
+// discard their results if this returns an error.
+func (client *Client) VerifiedMap(previous *SignedTreeHead,
+	fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) (*SignedTreeHead, error) {
+	checkpoint, err := client.Resume(&Checkpoint{TreeHead: previous}, fn,
+		maxEntries, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint.TreeHead, nil
+}
+
+// Continues a scan of the log from checkpoint (which may be nil to start
+// from the beginning), calling fn on up to maxEntries more entries (or all
+// of them, if maxEntries is 0) as Scan does. Entries are processed in
+// batches of batchSize (or all at once, if it's 0); once fn has been called
+// on every entry of a batch and the batch has been verified against the
+// log's current tree head, commit is called (if it isn't nil) with the new
+// checkpoint. If commit returns an error, the scan stops. Returns the final
+// checkpoint. The checkpoint's Tree keeps changing as the scan goes on, so
+// commit must save its Hashes rather than keep it.
+//
+// Entries are passed to fn before they can be verified, so callers must
+// discard the results of a batch that isn't committed.
+func (client *Client) Resume(checkpoint *Checkpoint,
+	fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries, batchSize uint64, commit func(*Checkpoint) error) (*Checkpoint, error) {
+	if checkpoint == nil {
+		checkpoint = new(Checkpoint)
+	}
+	tree := checkpoint.Tree
+	if tree == nil {
+		tree = NewMerkleTree()
+	}
+	if tree.Size() != checkpoint.NextIndex {
+		return nil, fmt.Errorf("checkpoint at %d has a tree of size %d",
+			checkpoint.NextIndex, tree.Size())
+	}
+	sth, err := client.GetSTH()
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.TreeHead != nil {
+		err := client.VerifyConsistency(checkpoint.TreeHead.TreeSize,
+			checkpoint.TreeHead.SHA256RootHash, sth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	end := sth.TreeSize
+	if maxEntries > 0 && tree.Size()+maxEntries < end {
+		end = tree.Size() + maxEntries
+	}
+	// Even with no new entries, the first batch checks that what was already
+	// processed is consistent with the current tree head.
+	for {
+		batchEnd := end
+		if batchSize > 0 && tree.Size()+batchSize < end {
+			batchEnd = tree.Size() + batchSize
+		}
+		if err := client.scan(tree.Size(), batchEnd, tree, fn); err != nil {
+			return nil, err
+		}
+		if err := client.VerifyConsistency(tree.Size(), tree.RootHash(), sth); err != nil {
+			return nil, fmt.Errorf("entries don't match tree head: %s", err)
+		}
+		current := &Checkpoint{tree.Size(), sth, tree}
+		if commit != nil {
+			if err := commit(current); err != nil {
+				return nil, err
+			}
+		}
+		if current.NextIndex >= end {
+			return current, nil
+		}
+	}
+}
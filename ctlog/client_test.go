@@ -0,0 +1,234 @@
+package ctlog
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"github.com/monicachew/certificatetransparency"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startFakeLog(t *testing.T, n int) (*FakeLog, []*x509.Certificate, *Client) {
+	dir, certs := makeLogDir(t, n)
+	defer os.RemoveAll(dir)
+	log, err := NewFakeLog(dir)
+	if err != nil {
+		t.Fatal("could not start fake log", err)
+	}
+	client := NewClient(log.URL)
+	client.Backoff = time.Millisecond
+	return log, certs, client
+}
+
+func TestGetSTHAndEntries(t *testing.T) {
+	log, certs, client := startFakeLog(t, 4)
+	defer log.Close()
+	sth, err := client.GetSTH()
+	if err != nil {
+		t.Fatal("get-sth failed", err)
+	}
+	if sth.TreeSize != uint64(len(certs)) {
+		t.Errorf("Expected tree size %d, got %d", len(certs), sth.TreeSize)
+	}
+	entries, err := client.GetEntries(1, 2)
+	if err != nil {
+		t.Fatal("get-entries failed", err)
+	}
+	if len(entries) != 2 || !bytes.Equal(entries[0].X509Cert, certs[1].Raw) {
+		t.Fatalf("Unexpected entries %v", entries)
+	}
+	if len(entries[0].ExtraCerts) != 1 ||
+		!bytes.Equal(entries[0].ExtraCerts[0], certs[0].Raw) {
+		t.Error("Expected the root as the chain")
+	}
+	if _, err := client.GetEntries(10, 11); err == nil {
+		t.Error("Expected an error past the end of the log")
+	}
+}
+
+func TestGetRoots(t *testing.T) {
+	log, certs, client := startFakeLog(t, 1)
+	defer log.Close()
+	roots, err := client.GetRoots()
+	if err != nil {
+		t.Fatal("get-roots failed", err)
+	}
+	if len(roots) != 1 || !bytes.Equal(roots[0], certs[0].Raw) {
+		t.Error("Expected the root certificate")
+	}
+}
+
+func TestGetProofByHash(t *testing.T) {
+	log, _, client := startFakeLog(t, 6)
+	defer log.Close()
+	sth, err := client.GetSTH()
+	if err != nil {
+		t.Fatal("get-sth failed", err)
+	}
+	index, path, err := client.GetProofByHash(log.leafHashes[3], sth.TreeSize)
+	if err != nil {
+		t.Fatal("get-proof-by-hash failed", err)
+	}
+	if index != 3 || !VerifyInclusion(index, sth.TreeSize, log.leafHashes[3], path,
+		sth.SHA256RootHash) {
+		t.Error("Inclusion proof didn't verify")
+	}
+	if _, _, err := client.GetProofByHash(make([]byte, 32), sth.TreeSize); err == nil {
+		t.Error("Expected an error for an unknown hash")
+	}
+}
+
+func TestScan(t *testing.T) {
+	log, certs, client := startFakeLog(t, 9)
+	defer log.Close()
+	log.MaxBatchSize = 2
+	client.BatchSize = 3
+	var lock sync.Mutex
+	seen := make(map[uint64]bool)
+	err := client.Map(func(ent *certificatetransparency.EntryAndPosition, err error) {
+		if err != nil {
+			t.Error("unexpected error", err)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if !bytes.Equal(ent.Entry.X509Cert, certs[ent.Index].Raw) {
+			t.Errorf("Wrong cert at %d", ent.Index)
+		}
+		seen[ent.Index] = true
+	}, 8)
+	if err != nil {
+		t.Fatal("scan failed", err)
+	}
+	if len(seen) != 8 {
+		t.Errorf("Expected 8 entries, saw %d", len(seen))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	log, _, client := startFakeLog(t, 1)
+	defer log.Close()
+	client.MaxRetries = 2
+	log.FailNextRequests(2)
+	if _, err := client.GetSTH(); err != nil {
+		t.Error("Expected get-sth to succeed after retrying", err)
+	}
+	log.FailNextRequests(3)
+	_, err := client.GetSTH()
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != 503 {
+		t.Errorf("Expected a 503 after running out of retries, got %v", err)
+	}
+	// Client errors aren't retried.
+	log.FailNextRequests(0)
+	if _, err := client.GetEntries(5, 4); err == nil {
+		t.Error("Expected an error for a bad range")
+	}
+}
+
+func TestVerifiedMap(t *testing.T) {
+	log, certs, client := startFakeLog(t, 5)
+	defer log.Close()
+	client.PublicKey = log.PublicKey
+	client.BatchSize = 2
+	ignore := func(*certificatetransparency.EntryAndPosition, error) {}
+	sth, err := client.VerifiedMap(nil, ignore, 0)
+	if err != nil {
+		t.Fatal("Expected the log to verify", err)
+	}
+	// Partial scans are checked with a consistency proof.
+	if _, err := client.VerifiedMap(sth, ignore, 3); err != nil {
+		t.Error("Expected a partial scan to verify", err)
+	}
+
+	log.AddCert(certs[1])
+	newSTH, err := client.VerifiedMap(sth, ignore, 0)
+	if err != nil {
+		t.Fatal("Expected the grown log to be consistent", err)
+	}
+	if newSTH.TreeSize != sth.TreeSize+1 {
+		t.Errorf("Expected tree size %d, got %d", sth.TreeSize+1, newSTH.TreeSize)
+	}
+
+	forked := *sth
+	forked.SHA256RootHash = LeafHash(nil)
+	if _, err := client.VerifiedMap(&forked, ignore, 0); err == nil {
+		t.Error("Expected an error for an inconsistent earlier tree head")
+	}
+	shrunk := *newSTH
+	shrunk.TreeSize += 10
+	if _, err := client.VerifiedMap(&shrunk, ignore, 0); err == nil {
+		t.Error("Expected an error for a log that shrank")
+	}
+
+	// Serve an entry that isn't the one the tree head commits to.
+	log.lock.Lock()
+	log.leaves[2] = marshalX509Leaf(1, certs[0].Raw)
+	log.lock.Unlock()
+	if _, err := client.VerifiedMap(nil, ignore, 0); err == nil {
+		t.Error("Expected an error for a tampered entry")
+	}
+}
+
+func TestResume(t *testing.T) {
+	log, certs, client := startFakeLog(t, 6)
+	defer log.Close()
+	var lock sync.Mutex
+	var seen []uint64
+	record := func(ent *certificatetransparency.EntryAndPosition, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		seen = append(seen, ent.Index)
+	}
+
+	// Crash while committing the second batch.
+	var saved Checkpoint
+	var savedHashes [][]byte
+	_, err := client.Resume(nil, record, 0, 3, func(checkpoint *Checkpoint) error {
+		if checkpoint.NextIndex > 3 {
+			return errors.New("crash")
+		}
+		saved = *checkpoint
+		savedHashes = checkpoint.Tree.Hashes()
+		return nil
+	})
+	if err == nil || saved.NextIndex != 3 {
+		t.Fatalf("Expected to crash after committing 3 entries, got %v at %d", err,
+			saved.NextIndex)
+	}
+
+	tree, err := NewMerkleTreeFromHashes(saved.NextIndex, savedHashes)
+	if err != nil {
+		t.Fatal("could not restore tree", err)
+	}
+	saved.Tree = tree
+	seen = nil
+	var commits []uint64
+	checkpoint, err := client.Resume(&saved, record, 0, 3,
+		func(checkpoint *Checkpoint) error {
+			commits = append(commits, checkpoint.NextIndex)
+			return nil
+		})
+	if err != nil {
+		t.Fatal("could not resume", err)
+	}
+	if len(seen) != 4 || checkpoint.NextIndex != 7 || len(commits) != 2 ||
+		commits[0] != 6 || commits[1] != 7 {
+		t.Errorf("Unexpected resumed scan: saw %v, committed %v", seen, commits)
+	}
+
+	// Nothing new: the checkpoint is just re-verified.
+	seen = nil
+	checkpoint, err = client.Resume(checkpoint, record, 0, 3, nil)
+	if err != nil || len(seen) != 0 {
+		t.Errorf("Expected no new entries, saw %v (%v)", seen, err)
+	}
+
+	log.AddCert(certs[2])
+	checkpoint, err = client.Resume(checkpoint, record, 0, 3, nil)
+	if err != nil || len(seen) != 1 || seen[0] != 7 || checkpoint.TreeHead.TreeSize != 8 {
+		t.Errorf("Expected only the new entry, saw %v (%v)", seen, err)
+	}
+}
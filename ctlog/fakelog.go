@@ -0,0 +1,277 @@
+package ctlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// An in-process CT log serving the RFC 6962 API, for tests. It logs every
+// certificate in a directory as an X.509 entry, with whatever chain to a
+// root can be built from the other certificates in the directory.
+type FakeLog struct {
+	URL string
+	// The key tree heads are signed with
+	PublicKey *ecdsa.PublicKey
+	// get-entries returns at most this many entries at once, to exercise
+	// clients' batching. 0 means no limit.
+	MaxBatchSize uint64
+
+	server     *httptest.Server
+	key        *ecdsa.PrivateKey
+	lock       sync.Mutex
+	certs      []*x509.Certificate
+	roots      [][]byte
+	leaves     [][]byte
+	extraData  [][]byte
+	leafHashes [][]byte
+	timestamp  uint64
+	// Number of upcoming requests to fail with 503
+	failures int
+}
+
+// Returns the certificates in filename, which can be DER or any number of
+// PEM blocks.
+func readCertificates(filename string) ([]*x509.Certificate, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(contents, []byte("-----BEGIN")) {
+		cert, err := x509.ParseCertificate(contents)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// Starts a fake log of the certificates in dir, in file name order.
+func NewFakeLog(dir string) (*FakeLog, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	log := &FakeLog{PublicKey: &key.PublicKey, key: key}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		certs, err := readCertificates(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		log.certs = append(log.certs, certs...)
+	}
+	for _, cert := range log.certs {
+		if cert.IsCA && bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			log.roots = append(log.roots, cert.Raw)
+		}
+	}
+	for _, cert := range log.certs {
+		log.addCert(cert)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ct/v1/get-sth", log.handle(log.getSTH))
+	mux.HandleFunc("/ct/v1/get-entries", log.handle(log.getEntries))
+	mux.HandleFunc("/ct/v1/get-roots", log.handle(log.getRoots))
+	mux.HandleFunc("/ct/v1/get-proof-by-hash", log.handle(log.getProofByHash))
+	mux.HandleFunc("/ct/v1/get-sth-consistency", log.handle(log.getSTHConsistency))
+	log.server = httptest.NewServer(mux)
+	log.URL = log.server.URL
+	return log, nil
+}
+
+func (log *FakeLog) Close() {
+	log.server.Close()
+}
+
+// Logs another certificate, growing the tree by one.
+func (log *FakeLog) AddCert(cert *x509.Certificate) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.addCert(cert)
+}
+
+func (log *FakeLog) addCert(cert *x509.Certificate) {
+	// Timestamps only need to be increasing.
+	log.timestamp = uint64(time.Now().UnixNano()/int64(time.Millisecond)) +
+		uint64(len(log.leaves))
+	leaf := marshalX509Leaf(log.timestamp, cert.Raw)
+	log.leaves = append(log.leaves, leaf)
+	log.extraData = append(log.extraData, appendCertificateChain(nil, log.chainFor(cert)))
+	log.leafHashes = append(log.leafHashes, LeafHash(leaf))
+}
+
+// Returns the chain from cert's issuer to a root, as far as it can be built
+// from the log's certificates.
+func (log *FakeLog) chainFor(cert *x509.Certificate) [][]byte {
+	var chain [][]byte
+	for len(chain) < 10 && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		var issuer *x509.Certificate
+		for _, candidate := range log.certs {
+			if bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer.Raw)
+		cert = issuer
+	}
+	return chain
+}
+
+// Makes the next n requests fail with 503 Service Unavailable.
+func (log *FakeLog) FailNextRequests(n int) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.failures = n
+}
+
+type httpError struct {
+	status  int
+	message string
+}
+
+// Wraps a handler that returns a JSON response, or an error.
+func (log *FakeLog) handle(handler func(r *http.Request) (interface{}, *httpError)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.lock.Lock()
+		defer log.lock.Unlock()
+		if log.failures > 0 {
+			log.failures--
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		response, err := handler(r)
+		if err != nil {
+			http.Error(w, err.message, err.status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func badRequest(message string) *httpError {
+	return &httpError{http.StatusBadRequest, message}
+}
+
+func (log *FakeLog) getSTH(r *http.Request) (interface{}, *httpError) {
+	sth := &SignedTreeHead{
+		TreeSize:       uint64(len(log.leaves)),
+		Timestamp:      log.timestamp,
+		SHA256RootHash: RootHash(log.leafHashes),
+	}
+	hash := sha256.Sum256(treeHeadSignatureInput(sth))
+	rInt, sInt, err := ecdsa.Sign(rand.Reader, log.key, hash[:])
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, err.Error()}
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{rInt, sInt})
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, err.Error()}
+	}
+	// DigitallySigned: SHA-256 with ECDSA
+	sth.TreeHeadSignature = appendVector([]byte{4, 3}, signature, 2)
+	return sth, nil
+}
+
+func (log *FakeLog) getEntries(r *http.Request) (interface{}, *httpError) {
+	start, err := strconv.ParseUint(r.FormValue("start"), 10, 64)
+	if err != nil {
+		return nil, badRequest("bad start")
+	}
+	end, err := strconv.ParseUint(r.FormValue("end"), 10, 64)
+	if err != nil || end < start || start >= uint64(len(log.leaves)) {
+		return nil, badRequest("bad range")
+	}
+	if end >= uint64(len(log.leaves)) {
+		end = uint64(len(log.leaves)) - 1
+	}
+	if log.MaxBatchSize > 0 && end-start+1 > log.MaxBatchSize {
+		end = start + log.MaxBatchSize - 1
+	}
+	var response getEntriesResponse
+	for i := start; i <= end; i++ {
+		response.Entries = append(response.Entries,
+			leafEntry{log.leaves[i], log.extraData[i]})
+	}
+	return response, nil
+}
+
+func (log *FakeLog) getRoots(r *http.Request) (interface{}, *httpError) {
+	return map[string][][]byte{"certificates": log.roots}, nil
+}
+
+func (log *FakeLog) getProofByHash(r *http.Request) (interface{}, *httpError) {
+	hash, err := base64.StdEncoding.DecodeString(r.FormValue("hash"))
+	if err != nil {
+		return nil, badRequest("bad hash")
+	}
+	treeSize, err := strconv.ParseUint(r.FormValue("tree_size"), 10, 64)
+	if err != nil || treeSize == 0 || treeSize > uint64(len(log.leaves)) {
+		return nil, badRequest("bad tree_size")
+	}
+	for i, leafHash := range log.leafHashes[:treeSize] {
+		if bytes.Equal(leafHash, hash) {
+			return map[string]interface{}{
+				"leaf_index": i,
+				"audit_path": auditPath(uint64(i), log.leafHashes[:treeSize]),
+			}, nil
+		}
+	}
+	return nil, &httpError{http.StatusNotFound, "hash not found"}
+}
+
+func (log *FakeLog) getSTHConsistency(r *http.Request) (interface{}, *httpError) {
+	first, err := strconv.ParseUint(r.FormValue("first"), 10, 64)
+	if err != nil {
+		return nil, badRequest("bad first")
+	}
+	second, err := strconv.ParseUint(r.FormValue("second"), 10, 64)
+	if err != nil || first > second || second > uint64(len(log.leaves)) {
+		return nil, badRequest("bad second")
+	}
+	return map[string][][]byte{
+		"consistency": consistencyProof(first, log.leafHashes[:second]),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package ctlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Signs template with signer (or self-signs it, if parent is nil).
+func makeCert(t *testing.T, template, parent *x509.Certificate,
+	signer *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	if parent == nil {
+		parent, signer = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent,
+		&key.PublicKey, signer)
+	if err != nil {
+		t.Fatal("could not create certificate", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("could not parse certificate", err)
+	}
+	return cert, key
+}
+
+// Writes a root and n leaves issued by it, one PEM file each, to a new
+// temporary directory. The root comes first in file name order.
+func makeLogDir(t *testing.T, n int) (string, []*x509.Certificate) {
+	dir, err := ioutil.TempDir("", "fakelog")
+	if err != nil {
+		t.Fatal("could not create temp dir", err)
+	}
+	now := time.Now()
+	root, rootKey := makeCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake Root"},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	certs := []*x509.Certificate{root}
+	for i := 0; i < n; i++ {
+		leaf, _ := makeCert(t, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(100 + i)),
+			Subject:      pkix.Name{CommonName: fmt.Sprintf("%d.example.com", i)},
+			NotBefore:    now,
+			NotAfter:     now.AddDate(1, 0, 0),
+		}, root, rootKey)
+		certs = append(certs, leaf)
+	}
+	for i, cert := range certs {
+		name := filepath.Join(dir, fmt.Sprintf("%03d.pem", i))
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+		if err := ioutil.WriteFile(name, pem.EncodeToMemory(block), 0644); err != nil {
+			t.Fatal("could not write certificate", err)
+		}
+	}
+	return dir, certs
+}
+
+func TestNewFakeLog(t *testing.T) {
+	dir, certs := makeLogDir(t, 3)
+	defer os.RemoveAll(dir)
+	// Non-certificate PEM blocks are skipped.
+	ioutil.WriteFile(filepath.Join(dir, "999.pem"),
+		[]byte("-----BEGIN JUNK-----\nAAAA\n-----END JUNK-----\n"), 0644)
+	log, err := NewFakeLog(dir)
+	if err != nil {
+		t.Fatal("could not start fake log", err)
+	}
+	defer log.Close()
+	if len(log.leaves) != len(certs) {
+		t.Errorf("Expected %d entries, got %d", len(certs), len(log.leaves))
+	}
+	if len(log.roots) != 1 {
+		t.Errorf("Expected 1 root, got %d", len(log.roots))
+	}
+	if _, err := NewFakeLog(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
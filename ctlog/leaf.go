@@ -0,0 +1,150 @@
+package ctlog
+
+import (
+	"errors"
+	"github.com/monicachew/certificatetransparency"
+)
+
+var errMalformedEntry = errors.New("malformed log entry")
+
+// Reads a vector with an n-byte big-endian length prefix from the start of
+// data. Returns the contents and the rest of data.
+func readVector(data []byte, n int) ([]byte, []byte, error) {
+	if len(data) < n {
+		return nil, nil, errMalformedEntry
+	}
+	length := 0
+	for _, b := range data[:n] {
+		length = length<<8 | int(b)
+	}
+	data = data[n:]
+	if len(data) < length {
+		return nil, nil, errMalformedEntry
+	}
+	return data[:length], data[length:], nil
+}
+
+// Appends contents to b with an n-byte big-endian length prefix.
+func appendVector(b []byte, contents []byte, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(len(contents)>>uint(8*i)))
+	}
+	return append(b, contents...)
+}
+
+func readUint(data []byte, n int) (uint64, []byte, error) {
+	if len(data) < n {
+		return 0, nil, errMalformedEntry
+	}
+	value := uint64(0)
+	for _, b := range data[:n] {
+		value = value<<8 | uint64(b)
+	}
+	return value, data[n:], nil
+}
+
+func appendUint(b []byte, value uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(value>>uint(8*i)))
+	}
+	return b
+}
+
+// Reads a list of certificates, each with a 3-byte length, from a vector
+// with a 3-byte length at the start of data.
+func readCertificateChain(data []byte) ([][]byte, []byte, error) {
+	list, rest, err := readVector(data, 3)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chain [][]byte
+	for len(list) > 0 {
+		var cert []byte
+		cert, list, err = readVector(list, 3)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, cert)
+	}
+	return chain, rest, nil
+}
+
+func appendCertificateChain(b []byte, chain [][]byte) []byte {
+	var list []byte
+	for _, cert := range chain {
+		list = appendVector(list, cert, 3)
+	}
+	return appendVector(b, list, 3)
+}
+
+// An entry returned by get-entries. ExtraCerts is only the certificate chain,
+// as in the entry's extra_data; the precertificate a precert entry was
+// logged from (RFC 6962 3.1) is kept apart from it, since it isn't a CA.
+type Entry struct {
+	certificatetransparency.LogEntry
+	// The DER precertificate of a precert entry, nil for an X.509 entry
+	Precertificate []byte
+}
+
+// Parses the leaf_input and extra_data of an entry returned by get-entries
+// (a MerkleTreeLeaf and its certificate chain, RFC 6962 3.4 and 4.6).
+func ParseEntry(leafInput, extraData []byte) (*Entry, error) {
+	if len(leafInput) < 2 || leafInput[0] != 0 || leafInput[1] != 0 {
+		// Only v1 timestamped entries exist.
+		return nil, errMalformedEntry
+	}
+	entry := new(Entry)
+	timestamp, rest, err := readUint(leafInput[2:], 8)
+	if err != nil {
+		return nil, err
+	}
+	entry.Timestamp = timestamp
+	entryType, rest, err := readUint(rest, 2)
+	if err != nil {
+		return nil, err
+	}
+	entry.Type = certificatetransparency.LogEntryType(entryType)
+	switch entry.Type {
+	case certificatetransparency.X509Entry:
+		entry.X509Cert, rest, err = readVector(rest, 3)
+		if err != nil {
+			return nil, err
+		}
+		entry.ExtraCerts, _, err = readCertificateChain(extraData)
+	case certificatetransparency.PrecertEntry:
+		if len(rest) < 32 {
+			return nil, errMalformedEntry
+		}
+		entry.Precert = new(certificatetransparency.Precertificate)
+		copy(entry.Precert.IssuerKeyHash[:], rest[:32])
+		entry.Precert.TBSCertificate, rest, err = readVector(rest[32:], 3)
+		if err != nil {
+			return nil, err
+		}
+		// The extra data is the precertificate itself followed by its chain.
+		entry.Precertificate, extraData, err = readVector(extraData, 3)
+		if err != nil {
+			return nil, err
+		}
+		entry.ExtraCerts, _, err = readCertificateChain(extraData)
+	default:
+		return nil, errMalformedEntry
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Whatever is left are the CtExtensions.
+	if _, _, err := readVector(rest, 2); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Returns the MerkleTreeLeaf for an X.509 entry logged at timestamp.
+func marshalX509Leaf(timestamp uint64, cert []byte) []byte {
+	leaf := []byte{0, 0}
+	leaf = appendUint(leaf, timestamp, 8)
+	leaf = appendUint(leaf, uint64(certificatetransparency.X509Entry), 2)
+	leaf = appendVector(leaf, cert, 3)
+	return appendVector(leaf, nil, 2)
+}
@@ -0,0 +1,47 @@
+package ctlog
+
+import (
+	"bytes"
+	"github.com/monicachew/certificatetransparency"
+	"testing"
+)
+
+func TestParseX509Entry(t *testing.T) {
+	leaf := marshalX509Leaf(1234, []byte("cert"))
+	extraData := appendCertificateChain(nil, [][]byte{[]byte("issuer"), []byte("root")})
+	entry, err := ParseEntry(leaf, extraData)
+	if err != nil {
+		t.Fatal("could not parse entry", err)
+	}
+	if entry.Type != certificatetransparency.X509Entry || entry.Timestamp != 1234 ||
+		string(entry.X509Cert) != "cert" || len(entry.ExtraCerts) != 2 ||
+		string(entry.ExtraCerts[1]) != "root" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if _, err := ParseEntry(leaf[:len(leaf)-3], extraData); err == nil {
+		t.Error("Expected an error for a truncated entry")
+	}
+}
+
+func TestParsePrecertEntry(t *testing.T) {
+	issuerKeyHash := bytes.Repeat([]byte{7}, 32)
+	leaf := []byte{0, 0}
+	leaf = appendUint(leaf, 1234, 8)
+	leaf = appendUint(leaf, uint64(certificatetransparency.PrecertEntry), 2)
+	leaf = append(leaf, issuerKeyHash...)
+	leaf = appendVector(leaf, []byte("tbs"), 3)
+	leaf = appendVector(leaf, nil, 2)
+	extraData := appendVector(nil, []byte("precert"), 3)
+	extraData = appendCertificateChain(extraData, [][]byte{[]byte("issuer")})
+	entry, err := ParseEntry(leaf, extraData)
+	if err != nil {
+		t.Fatal("could not parse entry", err)
+	}
+	if entry.Type != certificatetransparency.PrecertEntry ||
+		!bytes.Equal(entry.Precert.IssuerKeyHash[:], issuerKeyHash) ||
+		string(entry.Precert.TBSCertificate) != "tbs" ||
+		string(entry.Precertificate) != "precert" || len(entry.ExtraCerts) != 1 ||
+		string(entry.ExtraCerts[0]) != "issuer" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
@@ -0,0 +1,211 @@
+package ctlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Returns the Merkle tree hash of a single leaf (RFC 6962 2.1).
+func LeafHash(leaf []byte) []byte {
+	hash := sha256.Sum256(append([]byte{0}, leaf...))
+	return hash[:]
+}
+
+func hashChildren(left, right []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{1})
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
+// Returns the largest power of two smaller than n, for n > 1.
+func splitPoint(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// Returns the Merkle tree hash of the tree with the given leaf hashes.
+func RootHash(leafHashes [][]byte) []byte {
+	switch len(leafHashes) {
+	case 0:
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	case 1:
+		return leafHashes[0]
+	}
+	k := splitPoint(uint64(len(leafHashes)))
+	return hashChildren(RootHash(leafHashes[:k]), RootHash(leafHashes[k:]))
+}
+
+// Returns the audit path for the leaf at index in the tree with the given
+// leaf hashes (RFC 6962 2.1.1).
+func auditPath(index uint64, leafHashes [][]byte) [][]byte {
+	n := uint64(len(leafHashes))
+	if n <= 1 {
+		return nil
+	}
+	k := splitPoint(n)
+	if index < k {
+		return append(auditPath(index, leafHashes[:k]), RootHash(leafHashes[k:]))
+	}
+	return append(auditPath(index-k, leafHashes[k:]), RootHash(leafHashes[:k]))
+}
+
+// Returns whether path proves that leafHash is at index in the tree of the
+// given size with the given root hash (RFC 9162 2.1.3.2).
+func VerifyInclusion(index, treeSize uint64, leafHash []byte, path [][]byte,
+	rootHash []byte) bool {
+	if index >= treeSize {
+		return false
+	}
+	fn, sn := index, treeSize-1
+	hash := leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = hashChildren(p, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = hashChildren(hash, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(hash, rootHash)
+}
+
+// Returns the consistency proof between the tree made of the first m of
+// leafHashes and the tree made of all of them (RFC 6962 2.1.2).
+func consistencyProof(m uint64, leafHashes [][]byte) [][]byte {
+	if m == 0 || m >= uint64(len(leafHashes)) {
+		return nil
+	}
+	return subproof(m, leafHashes, true)
+}
+
+func subproof(m uint64, leafHashes [][]byte, complete bool) [][]byte {
+	n := uint64(len(leafHashes))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{RootHash(leafHashes)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(subproof(m, leafHashes[:k], complete), RootHash(leafHashes[k:]))
+	}
+	return append(subproof(m-k, leafHashes[k:], false), RootHash(leafHashes[:k]))
+}
+
+// Returns whether proof shows that the tree of size first with root
+// firstRoot is a prefix of the tree of size second with root secondRoot
+// (RFC 9162 2.1.4.2).
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte,
+	proof [][]byte) bool {
+	switch {
+	case first > second:
+		return false
+	case first == second:
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	case first == 0:
+		// Everything is consistent with the empty tree.
+		return len(proof) == 0
+	}
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return false
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr)
+			sr = hashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = hashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
+
+// Computes the root of a Merkle tree as leaves are added to it, keeping only
+// the roots of its largest complete subtrees.
+type MerkleTree struct {
+	size uint64
+	// Subtree roots, largest (leftmost) first
+	hashes [][]byte
+}
+
+func NewMerkleTree() *MerkleTree {
+	return new(MerkleTree)
+}
+
+// Restores a tree of the given size from its Hashes.
+func NewMerkleTreeFromHashes(size uint64, hashes [][]byte) (*MerkleTree, error) {
+	count := 0
+	for s := size; s > 0; s >>= 1 {
+		count += int(s & 1)
+	}
+	if len(hashes) != count {
+		return nil, fmt.Errorf("a tree of size %d needs %d hashes, not %d", size,
+			count, len(hashes))
+	}
+	return &MerkleTree{size, append([][]byte{}, hashes...)}, nil
+}
+
+// Returns the state of the tree, for NewMerkleTreeFromHashes.
+func (tree *MerkleTree) Hashes() [][]byte {
+	return append([][]byte{}, tree.hashes...)
+}
+
+func (tree *MerkleTree) Size() uint64 {
+	return tree.size
+}
+
+// Adds the leaf with the given hash (see LeafHash) to the right of the tree.
+func (tree *MerkleTree) AddLeafHash(leafHash []byte) {
+	tree.hashes = append(tree.hashes, leafHash)
+	for s := tree.size; s&1 == 1; s >>= 1 {
+		n := len(tree.hashes)
+		tree.hashes[n-2] = hashChildren(tree.hashes[n-2], tree.hashes[n-1])
+		tree.hashes = tree.hashes[:n-1]
+	}
+	tree.size++
+}
+
+func (tree *MerkleTree) RootHash() []byte {
+	if tree.size == 0 {
+		return RootHash(nil)
+	}
+	hash := tree.hashes[len(tree.hashes)-1]
+	for i := len(tree.hashes) - 2; i >= 0; i-- {
+		hash = hashChildren(tree.hashes[i], hash)
+	}
+	return hash
+}
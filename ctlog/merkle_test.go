@@ -0,0 +1,92 @@
+package ctlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestRootHash(t *testing.T) {
+	// From the RFC 6962 test vectors in certificate-transparency-go
+	if hex.EncodeToString(RootHash(nil)) !=
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Error("Unexpected empty tree hash")
+	}
+	if hex.EncodeToString(RootHash([][]byte{LeafHash(nil)})) !=
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Error("Unexpected hash of a tree with one empty leaf")
+	}
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	var leafHashes [][]byte
+	for n := 1; n <= 20; n++ {
+		leafHashes = append(leafHashes, LeafHash([]byte(fmt.Sprint(n))))
+		root := RootHash(leafHashes)
+		for i := range leafHashes {
+			path := auditPath(uint64(i), leafHashes)
+			if !VerifyInclusion(uint64(i), uint64(n), leafHashes[i], path, root) {
+				t.Errorf("Leaf %d of %d didn't verify", i, n)
+			}
+			if n > 1 && VerifyInclusion(uint64(i), uint64(n),
+				leafHashes[(i+1)%n], path, root) {
+				t.Errorf("Wrong leaf verified at %d of %d", i, n)
+			}
+		}
+	}
+	if VerifyInclusion(5, 5, leafHashes[0], nil, leafHashes[0]) {
+		t.Error("Index past the end of the tree shouldn't verify")
+	}
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	var leafHashes [][]byte
+	for n := 1; n <= 20; n++ {
+		leafHashes = append(leafHashes, LeafHash([]byte(fmt.Sprint(n))))
+	}
+	for n := 1; n <= 20; n++ {
+		root := RootHash(leafHashes[:n])
+		for m := 1; m <= n; m++ {
+			proof := consistencyProof(uint64(m), leafHashes[:n])
+			firstRoot := RootHash(leafHashes[:m])
+			if !VerifyConsistency(uint64(m), uint64(n), firstRoot, root, proof) {
+				t.Errorf("%d and %d weren't consistent", m, n)
+			}
+			if m < n && VerifyConsistency(uint64(m), uint64(n), root, root, proof) {
+				t.Errorf("%d and %d were consistent with the wrong root", m, n)
+			}
+		}
+	}
+}
+
+func TestMerkleTree(t *testing.T) {
+	tree := NewMerkleTree()
+	var leafHashes [][]byte
+	for n := 0; n <= 20; n++ {
+		if !bytes.Equal(tree.RootHash(), RootHash(leafHashes)) || tree.Size() != uint64(n) {
+			t.Errorf("Wrong root for %d leaves", n)
+		}
+		leafHashes = append(leafHashes, LeafHash([]byte(fmt.Sprint(n))))
+		tree.AddLeafHash(leafHashes[n])
+	}
+}
+
+func TestNewMerkleTreeFromHashes(t *testing.T) {
+	tree := NewMerkleTree()
+	for n := 0; n < 11; n++ {
+		tree.AddLeafHash(LeafHash([]byte(fmt.Sprint(n))))
+	}
+	restored, err := NewMerkleTreeFromHashes(tree.Size(), tree.Hashes())
+	if err != nil {
+		t.Fatal("could not restore tree", err)
+	}
+	restored.AddLeafHash(LeafHash(nil))
+	tree.AddLeafHash(LeafHash(nil))
+	if !bytes.Equal(restored.RootHash(), tree.RootHash()) {
+		t.Error("Restored tree has the wrong root")
+	}
+	if _, err := NewMerkleTreeFromHashes(4, tree.Hashes()); err == nil {
+		t.Error("Expected an error for the wrong number of hashes")
+	}
+}
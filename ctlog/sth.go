@@ -0,0 +1,101 @@
+package ctlog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+)
+
+var (
+	errBadSTHSignature   = errors.New("tree head signature doesn't verify")
+	errUnknownSignature  = errors.New("unsupported tree head signature algorithm")
+	errNoPublicKeyInFile = errors.New("no PUBLIC KEY block found")
+)
+
+// A signed tree head, as returned by get-sth (RFC 6962 4.3).
+type SignedTreeHead struct {
+	TreeSize uint64 `json:"tree_size"`
+	// Milliseconds since the epoch
+	Timestamp         uint64 `json:"timestamp"`
+	SHA256RootHash    []byte `json:"sha256_root_hash"`
+	TreeHeadSignature []byte `json:"tree_head_signature"`
+}
+
+// Returns the data a log signs to produce sth's TreeHeadSignature (RFC 6962
+// 3.5).
+func treeHeadSignatureInput(sth *SignedTreeHead) []byte {
+	// version v1, signature type tree_hash
+	input := []byte{0, 1}
+	input = appendUint(input, sth.Timestamp, 8)
+	input = appendUint(input, sth.TreeSize, 8)
+	return append(input, sth.SHA256RootHash...)
+}
+
+// Returns an error unless sth's signature was made by publicKey, which must
+// be an ECDSA or RSA key.
+func VerifySTHSignature(sth *SignedTreeHead, publicKey crypto.PublicKey) error {
+	// DigitallySigned (RFC 5246 4.7): hash algorithm, signature algorithm,
+	// then the signature.
+	if len(sth.TreeHeadSignature) < 2 {
+		return errBadSTHSignature
+	}
+	hashAlgorithm := sth.TreeHeadSignature[0]
+	signatureAlgorithm := sth.TreeHeadSignature[1]
+	signature, rest, err := readVector(sth.TreeHeadSignature[2:], 2)
+	if err != nil || len(rest) > 0 {
+		return errBadSTHSignature
+	}
+	// RFC 6962 2.1.4: logs use SHA-256 with either ECDSA or RSA.
+	if hashAlgorithm != 4 {
+		return errUnknownSignature
+	}
+	digest := sha256.Sum256(treeHeadSignatureInput(sth))
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct{ R, S *big.Int }
+		if signatureAlgorithm != 3 {
+			return errUnknownSignature
+		}
+		if _, err := asn1.Unmarshal(signature, &ecdsaSignature); err != nil {
+			return errBadSTHSignature
+		}
+		if !ecdsa.Verify(key, digest[:], ecdsaSignature.R, ecdsaSignature.S) {
+			return errBadSTHSignature
+		}
+	case *rsa.PublicKey:
+		if signatureAlgorithm != 1 {
+			return errUnknownSignature
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return errBadSTHSignature
+		}
+	default:
+		return errUnknownSignature
+	}
+	return nil
+}
+
+// Reads a log's public key from a PEM file, as published by logs.
+func LoadPublicKey(filename string) (crypto.PublicKey, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			return nil, errNoPublicKeyInFile
+		}
+		if block.Type == "PUBLIC KEY" {
+			return x509.ParsePKIXPublicKey(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ctlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerifySTHSignature(t *testing.T) {
+	log, _, client := startFakeLog(t, 2)
+	defer log.Close()
+	sth, err := client.GetSTH()
+	if err != nil {
+		t.Fatal("get-sth failed", err)
+	}
+	if err := VerifySTHSignature(sth, log.PublicKey); err != nil {
+		t.Error("Expected the signature to verify", err)
+	}
+	sth.TreeSize++
+	if err := VerifySTHSignature(sth, log.PublicKey); err == nil {
+		t.Error("Expected an error for a modified tree head")
+	}
+	sth.TreeSize--
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	if err := VerifySTHSignature(sth, &otherKey.PublicKey); err == nil {
+		t.Error("Expected an error for the wrong key")
+	}
+	client.PublicKey = &otherKey.PublicKey
+	if _, err := client.GetSTH(); err == nil {
+		t.Error("Expected get-sth to check the signature")
+	}
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	log, _, _ := startFakeLog(t, 0)
+	defer log.Close()
+	der, err := x509.MarshalPKIXPublicKey(log.PublicKey)
+	if err != nil {
+		t.Fatal("could not marshal key", err)
+	}
+	f, err := ioutil.TempFile("", "log_key")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	f.Close()
+	key, err := LoadPublicKey(f.Name())
+	if err != nil {
+		t.Fatal("could not load key", err)
+	}
+	if !log.PublicKey.Equal(key) {
+		t.Error("Loaded the wrong key")
+	}
+}
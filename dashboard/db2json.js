@@ -3,14 +3,25 @@ var sqlite3 = require('sqlite3');
 var db = new sqlite3.Database('BRs.db');
 var fs = require('fs');
 
-var scorePrefixes = [
-  "validPeriodTooLong",
-  "deprecatedVersion",
-  "deprecatedSignatureAlgorithm",
-  "missingCNinSAN",
-  "keyTooShort",
-  "expTooSmall"
-];
+// The issuerReputation table has a <check>NormalizedScore and <check>RawScore
+// column for every check sunlight ran. These are read from the schema by
+// loadScorePrefixes.
+var scorePrefixes = [];
+
+function loadScorePrefixes(continuation) {
+  db.all("PRAGMA table_info(issuerReputation);", function(err, rows) {
+    if (err) {
+      throw err;
+    }
+    rows.forEach(function(row) {
+      var match = row.name.match(/^(.+)RawScore$/);
+      if (match) {
+        scorePrefixes.push(match[1]);
+      }
+    });
+    continuation();
+  });
+}
 
 try {
   fs.mkdirSync("data");
@@ -40,19 +51,36 @@ function formatFloat(val) {
 }
 
 function makeTimeseriesForIssuer(issuer, column, cb) {
-  var timeseries = { name: issuer, data: [] };
+  var timeseries = { name: issuer.issuer, data: [] };
   db.each("SELECT beginTime as t, " + column + " AS d " +
-          "FROM issuerReputation WHERE issuer=\"" + issuer +
-          "\" ORDER BY t",
+          "FROM " + reputationSource(issuer, null) + " ORDER BY t",
     function(err, row) {
       timeseries.data.push([row.t, formatFloat(row.d)]);
     },
     function() { cb(timeseries); });
 }
 
+// Issuers are identified by their issuerKey, and their reputation is in
+// issuerReputation. The same reputations rolled up to the roots the certs
+// chain to are in rootReputation, identified by the root's key, and to the
+// CA organisations that own the issuers in caOwnerReputation, identified by
+// the owner's name.
+//
+// Returns the table and condition to select an issuer's reputation from: the
+// reputation over all of its certs, or if rootProgram is given, over just
+// the certs that chain to that root program.
+function reputationSource(issuer, rootProgram) {
+  if (rootProgram) {
+    return "issuerReputationByRootProgram WHERE issuerKey=\"" +
+           issuer.issuerKey + "\" AND rootProgram=\"" + rootProgram + "\"";
+  }
+  return issuer.table + " WHERE issuerKey=\"" + issuer.issuerKey + "\"";
+}
+
 // Get all of the scores of a particular type (normalized, raw) for a given
-// issuer and fill in an array of { name: score, data: [[ts1, d1]] }
-function makeScoresForIssuer(issuer, type, continuation) {
+// issuer (and optionally root program, see reputationSource) and fill in an
+// array of { name: score, data: [[ts1, d1]] }
+function makeScoresForIssuer(issuer, rootProgram, type, continuation) {
   var timeseries = {};
   // expTooSmall -> expTooSmallNormalizedScore
   var scoreNames = scorePrefixes.map(function(p) { return p + type; });
@@ -61,7 +89,7 @@ function makeScoresForIssuer(issuer, type, continuation) {
     timeseries[score] = { name: score, data: [], yAxis: 0 };
   });
   var query = "SELECT beginTime AS t, " + scoreNames.join() +
-    " FROM issuerReputation WHERE issuer=\"" + issuer + "\" ORDER BY t;";
+    " FROM " + reputationSource(issuer, rootProgram) + " ORDER BY t;";
   db.each(query,
     function(err, row) {
       scoreNames.forEach(function(score) {
@@ -73,11 +101,11 @@ function makeScoresForIssuer(issuer, type, continuation) {
     });
 }
 
-function makeVolumesForIssuer(issuer, type, continuation) {
+function makeVolumesForIssuer(issuer, rootProgram, type, continuation) {
   var volumeSeries = { name: "Issuance Volume", data: [], yAxis: 1,
                        type: "area", zIndex: -1 };
   var volumeQuery = "SELECT " + type + "Count AS v, beginTime AS t " +
-                    "FROM issuerReputation WHERE issuer=\"" + issuer + "\" " +
+                    "FROM " + reputationSource(issuer, rootProgram) + " " +
                     "ORDER BY t;";
   db.each(volumeQuery,
     function(err, row) {
@@ -99,7 +127,8 @@ function initIssuerData(path) {
 }
 
 function makeExamplesForIssuer(issuer, callback) {
-  var query = "SELECT * FROM examples where issuer=\"" + issuer + "\"";
+  var query = "SELECT * FROM examples where issuerKey=\"" +
+              issuer.issuerKey + "\"";
   var examples;
   db.each(query, function(err, row) {
     examples = row; // this should only happen once
@@ -108,88 +137,186 @@ function makeExamplesForIssuer(issuer, callback) {
   });
 }
 
-// Given an issuer name and a filename to output to, dumps the JSON
-// representation of a list of timeseries objects with the following
+// Calls continuation with a list of timeseries objects for an issuer (and
+// optionally root program, see reputationSource) with the following
 // properties:
 //   name: a string representing the series (e.g. 'validPeriodTooLongRawScore')
 //   data: a list of [time in milliseconds, data point value] list pairs
 //   yAxis: which axis to render to (0 or 1 - differentiates scores from
 //          issuance volume)
-function dumpScoresVolumeAndExamplesForIssuer(issuer, issuerFilename) {
+function makeSeriesForIssuer(issuer, rootProgram, continuation) {
   // scoreSeries is a map of score type to Highstock data series that needs to
   // be converted to a list of Highstock data series
-  makeScoresForIssuer(issuer, "RawScore", function(scoreSeries) {
-    makeVolumesForIssuer(issuer, "raw", function(volumeSeries) {
+  makeScoresForIssuer(issuer, rootProgram, "RawScore", function(scoreSeries) {
+    makeVolumesForIssuer(issuer, rootProgram, "raw", function(volumeSeries) {
       var allSeries = [];
       Object.keys(scoreSeries).forEach(function(key) {
         allSeries.push(scoreSeries[key]);
       });
       allSeries.push(volumeSeries);
+      continuation(allSeries);
+    });
+  });
+}
+
+// Given an issuer, the root programs its certs chain to and a filename to
+// output to, dumps the JSON representation of the issuer's timeseries (see
+// makeSeriesForIssuer), the same timeseries for each root program and
+// examples of its certs.
+function dumpScoresVolumeAndExamplesForIssuer(issuer, rootPrograms,
+                                              issuerFilename) {
+  makeSeriesForIssuer(issuer, null, function(allSeries) {
+    var byRootProgram = {};
+    var remaining = rootPrograms.length;
+    function dumpWhenDone() {
+      if (remaining > 0) {
+        return;
+      }
       makeExamplesForIssuer(issuer, function(examples) {
-        var data = { series: allSeries, examples: examples };
+        var data = { series: allSeries, byRootProgram: byRootProgram,
+                     examples: examples };
         fs.writeFileSync(issuerFilename, JSON.stringify(data));
       });
+    }
+    rootPrograms.forEach(function(rootProgram) {
+      makeSeriesForIssuer(issuer, rootProgram, function(programSeries) {
+        byRootProgram[rootProgram] = programSeries;
+        remaining--;
+        dumpWhenDone();
+      });
     });
+    dumpWhenDone();
   });
 }
 
-var allIssuers = [];
-db.each("SELECT issuer, issuerInMozillaDB, sum(rawCount) AS totalIssuance " +
-        "FROM issuerReputation GROUP BY issuer;",
-  function(err, row) {
-    // convert {0,1} to {false,true}
-    if (row.issuerInMozillaDB == 0) {
-      row.issuerInMozillaDB = false;
-    } else if (row.issuerInMozillaDB == 1) {
-      row.issuerInMozillaDB = true;
-    }
-    if (row.issuer.length > 0) { // this will be fixed by issue #57
-      allIssuers.push(row);
+// Calls continuation with the issuers (or roots or CA owners) in table, each
+// { issuer: name for display, issuerKey, table, rootPrograms: the root
+// programs any of its certs chain to, totalIssuance }, by issuerKey. Each
+// month of a reputation has the number of its certs that chain to each root
+// program.
+function loadIssuers(table, continuation) {
+  var issuers = {};
+  db.each("SELECT issuerKey, issuer, rootPrograms, rawCount FROM " + table +
+          ";",
+    function(err, row) {
+      if (row.issuer.length == 0) { // this will be fixed by issue #57
+        return;
+      }
+      var issuer = issuers[row.issuerKey];
+      if (!issuer) {
+        issuer = { issuer: row.issuer, issuerKey: row.issuerKey, table: table,
+                   rootPrograms: [], totalIssuance: 0 };
+        issuers[row.issuerKey] = issuer;
+      }
+      issuer.totalIssuance += row.rawCount;
+      Object.keys(JSON.parse(row.rootPrograms || "{}")).forEach(
+        function(rootProgram) {
+          if (issuer.rootPrograms.indexOf(rootProgram) == -1) {
+            issuer.rootPrograms.push(rootProgram);
+          }
+        });
+    },
+    function() {
+      continuation(issuers);
+    });
+}
+
+// Gives each issuer (or root) in issuers a distinct name: prefix and its DN,
+// followed by the start of its key if others have the same DN (e.g. a
+// re-keyed intermediate).
+function nameIssuers(issuers, prefix) {
+  var dnCounts = {};
+  Object.keys(issuers).forEach(function(key) {
+    var dn = issuers[key].issuer;
+    dnCounts[dn] = (dnCounts[dn] || 0) + 1;
+  });
+  Object.keys(issuers).forEach(function(key) {
+    var issuer = issuers[key];
+    if (dnCounts[issuer.issuer] > 1) {
+      issuer.issuer += " (key " + issuer.issuerKey.substring(0, 12) + ")";
     }
-  },
-  function(err, numRows) {
-    var maxIssuance = 0;
-    console.log("var issuers = {");
-    allIssuers.forEach(function(issuer) {
-      if (issuer.totalIssuance > maxIssuance) {
-        maxIssuance = issuer.totalIssuance;
+    issuer.issuer = prefix + issuer.issuer;
+  });
+}
+
+// Dumps the timeseries of the issuers picked by query, which selects their
+// issuerKey, as the list name.
+function dumpIssuerList(name, query, issuers) {
+  var list = [];
+  db.each(query,
+    function(err, row) {
+      var issuer = issuers[row.issuerKey];
+      if (issuer) {
+        list.push(issuer.issuer);
+        makeTimeseriesForIssuer(issuer, "rawScore", printTimeseries);
       }
-      var escapedName = escapeName(issuer.issuer);
-      console.log(escapedName + ": " + JSON.stringify(issuer) + ",");
-      var issuerFilename = "data/" + escapedName + ".json";
-      initIssuerData(issuerFilename);
-      dumpScoresVolumeAndExamplesForIssuer(issuer.issuer, issuerFilename);
+    },
+    function() {
+      completionDump(name, list);
+    }
+  );
+}
+
+// Dumps the issuers, roots and CA owners (see loadIssuers), which are listed
+// together, so roots and CA owners are named after what they are.
+function dumpIssuers(issuers, roots, owners) {
+  nameIssuers(issuers, "");
+  nameIssuers(roots, "Root: ");
+  nameIssuers(owners, "CA owner: ");
+  var allIssuers = [];
+  var allRootPrograms = {};
+  [issuers, roots, owners].forEach(function(map) {
+    Object.keys(map).forEach(function(key) {
+      allIssuers.push(map[key]);
+      map[key].rootPrograms.forEach(function(rootProgram) {
+        allRootPrograms[rootProgram] = true;
+      });
     });
-    console.log("};");
-    console.log("var maxIssuance = " + maxIssuance + ";");
-  }
-);
-
-console.log("var timeseries = {};");
-var topIssuers = [];
-db.each("SELECT issuer, sum(rawCount) AS n FROM issuerReputation " +
-        "WHERE issuerInMozillaDB GROUP BY issuer ORDER BY n DESC LIMIT 10;",
-  function(err, row) {
-    topIssuers.push(row.issuer);
-    makeTimeseriesForIssuer(row.issuer, "rawScore", printTimeseries);
-  },
-  function() {
-    completionDump("topIssuers", topIssuers);
-  }
-);
-
-var worstIssuers = [];
-// We can't restrict the query based on aliases (e.g., SUM(col)) so make a
-// subquery instead.
-db.each("SELECT issuer, n FROM " +
-           "(SELECT issuer, rawScore AS n, SUM(rawCount) AS s " +
-           " FROM issuerReputation WHERE issuerInMozillaDB GROUP BY issuer) " +
-        "AS NEWTABLE WHERE s > 1000 AND issuer != \"\" ORDER BY n LIMIT 10;",
-  function(err, row) {
-    worstIssuers.push(row.issuer);
-    makeTimeseriesForIssuer(row.issuer, "rawScore", printTimeseries);
-  },
-  function() {
-    completionDump("worstIssuers", worstIssuers);
-  }
-);
+  });
+
+  var maxIssuance = 0;
+  console.log("var issuers = {");
+  allIssuers.forEach(function(issuer) {
+    if (issuer.totalIssuance > maxIssuance) {
+      maxIssuance = issuer.totalIssuance;
+    }
+    var escapedName = escapeName(issuer.issuer);
+    console.log(escapedName + ": " + JSON.stringify(issuer) + ",");
+    var issuerFilename = "data/" + escapedName + ".json";
+    initIssuerData(issuerFilename);
+    // Only issuers have their reputation broken down by root program.
+    dumpScoresVolumeAndExamplesForIssuer(issuer,
+      issuer.table == "issuerReputation" ? issuer.rootPrograms : [],
+      issuerFilename);
+  });
+  console.log("};");
+  console.log("var maxIssuance = " + maxIssuance + ";");
+  completionDump("rootPrograms", Object.keys(allRootPrograms).sort());
+
+  console.log("var timeseries = {};");
+  dumpIssuerList("topIssuers",
+    "SELECT issuerKey, sum(rawCount) AS n FROM issuerReputation " +
+    "WHERE rootPrograms != \"{}\" GROUP BY issuerKey " +
+    "ORDER BY n DESC LIMIT 10;", issuers);
+  // We can't restrict the query based on aliases (e.g., SUM(col)) so make
+  // a subquery instead.
+  dumpIssuerList("worstIssuers",
+    "SELECT issuerKey, n FROM " +
+      "(SELECT issuerKey, issuer, rawScore AS n, SUM(rawCount) AS s " +
+      " FROM issuerReputation WHERE rootPrograms != \"{}\"" +
+      " GROUP BY issuerKey) " +
+    "AS NEWTABLE WHERE s > 1000 AND issuer != \"\" ORDER BY n LIMIT 10;",
+    issuers);
+}
+
+function dumpAll() {
+  loadIssuers("issuerReputation", function(issuers) {
+    loadIssuers("rootReputation", function(roots) {
+      loadIssuers("caOwnerReputation", function(owners) {
+        dumpIssuers(issuers, roots, owners);
+      });
+    });
+  });
+}
+
+loadScorePrefixes(dumpAll);
@@ -7,6 +7,27 @@ for (i = 0; i < topIssuers.length; i++) {
   top10series.push(timeseries[topIssuers[i]]);
 }
 
+var rootProgramSelect = document.getElementById("rootProgram");
+rootPrograms.forEach(function(rootProgram) {
+  var option = document.createElement("option");
+  option.value = rootProgram;
+  option.textContent = rootProgram;
+  rootProgramSelect.appendChild(option);
+});
+
+// Returns whether issuer is one of the issuers selected by rootProgram: ""
+// for issuers in any root program, "none" for issuers in none, or the name of
+// a root program.
+function inRootProgram(issuer, rootProgram) {
+  if (rootProgram == "") {
+    return issuer.rootPrograms.length > 0;
+  }
+  if (rootProgram == "none") {
+    return issuer.rootPrograms.length == 0;
+  }
+  return issuer.rootPrograms.indexOf(rootProgram) != -1;
+}
+
 var filteredIssuers = [];
 function filterIssuers() {
   // clear filteredIssuers but keep aliases to it
@@ -21,12 +42,12 @@ function filterIssuers() {
   var output = document.getElementById("minimumIssuanceOutput");
   output.value = minimumIssuance;
 
-  var issuerInMozillaDB = document.getElementById("issuerInMozillaDB").checked;
+  var rootProgram = rootProgramSelect.value;
 
   for (var index in issuers) {
     var issuer = issuers[index];
     if (issuer.totalIssuance >= minimumIssuance &&
-        issuer.issuerInMozillaDB == issuerInMozillaDB) {
+        inRootProgram(issuer, rootProgram)) {
       filteredIssuers.push(issuer.issuer);
     }
   }
@@ -83,14 +104,23 @@ function makeChart(name) {
     document.getElementById("autocomplete").value = name;
   } else {
     getChartData(name, function(seriesAndExamples) {
+      var issuer = issuers[escapeName(name)];
+      if (!inRootProgram(issuer, rootProgramSelect.value)) {
+        rootProgramSelect.value = issuer.rootPrograms.length > 0 ? "" : "none";
+      }
+      // With a root program selected, only the issuer's certs that chain to
+      // it are scored.
+      var series = seriesAndExamples.series;
+      if (seriesAndExamples.byRootProgram &&
+          seriesAndExamples.byRootProgram[rootProgramSelect.value]) {
+        series = seriesAndExamples.byRootProgram[rootProgramSelect.value];
+      }
       new Highcharts.StockChart({
         legend: commonLegend,
-        series: seriesAndExamples.series,
+        series: series,
         yAxis: commonYAxis
       });
       makeExamples(seriesAndExamples.examples);
-      var checkbox = document.getElementById("issuerInMozillaDB");
-      checkbox.checked = issuers[escapeName(name)].issuerInMozillaDB;
     });
   }
   document.getElementById("autocomplete").value = name;
@@ -98,6 +128,11 @@ function makeChart(name) {
   history.replaceState(null, "", location.origin + location.pathname + search);
 }
 
+function selectRootProgram() {
+  filterIssuers();
+  makeChart(document.getElementById("autocomplete").value);
+}
+
 function clearChildren(id) {
   var element = document.getElementById(id);
   while (element.children.length > 0) {
@@ -0,0 +1,161 @@
+package sunlight
+
+import (
+	"code.google.com/p/go.net/idna"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// CA/B Forum Ballot SC12: certificates containing underscores may not be
+// issued after April 30, 2019.
+var underscoresSunsetDate = time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// Returns the names in cert that must be valid DNS names: every dNSName SAN
+// entry and, for subscriber certificates, the Common Name if it isn't an IP
+// address.
+func dnsNamesToCheck(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.DNSNames)+1)
+	names = append(names, cert.DNSNames...)
+	cn := cert.Subject.CommonName
+	if len(cn) > 0 && !cert.IsCA && net.ParseIP(cn) == nil {
+		names = append(names, cn)
+	}
+	return names
+}
+
+// Returns the labels of name, ignoring a single trailing dot (which is
+// reported by DNSNameTrailingDot).
+func dnsLabels(name string) []string {
+	return strings.Split(strings.TrimSuffix(name, "."), ".")
+}
+
+func hasUnderscore(name string) bool {
+	return strings.Contains(name, "_")
+}
+
+func hasEmptyLabel(name string) bool {
+	for _, label := range dnsLabels(name) {
+		if len(label) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RFC 1035 2.3.4: labels are 63 octets or less.
+func hasLabelTooLong(name string) bool {
+	for _, label := range dnsLabels(name) {
+		if len(label) > 63 {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTrailingDot(name string) bool {
+	return strings.HasSuffix(name, ".")
+}
+
+// e.g. "www.*.example.com"
+func hasWildcardNotLeftmost(name string) bool {
+	for _, label := range dnsLabels(name)[1:] {
+		if strings.Contains(label, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// e.g. "w*.example.com"
+func hasPartialLabelWildcard(name string) bool {
+	label := dnsLabels(name)[0]
+	return strings.Contains(label, "*") && label != "*"
+}
+
+// e.g. "*.com" or "*.co.uk"
+func hasWildcardOnPublicSuffix(name string) bool {
+	if !strings.HasPrefix(name, "*.") {
+		return false
+	}
+	return IsPublicSuffix(name[2:])
+}
+
+// Returns why name isn't a valid IDN, or nil if it is: either it can't be
+// converted to ASCII at all, or it has an "xn--" label that doesn't survive a
+// round trip through its Unicode form. The conversion itself doesn't check
+// the latter.
+func punycodeError(name string) error {
+	ascii, err := idna.ToASCII(name)
+	if err != nil {
+		return err
+	}
+	for _, label := range dnsLabels(ascii) {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		unicode, err := idna.ToUnicode(label)
+		if err != nil {
+			return err
+		}
+		roundTripped, err := idna.ToASCII(unicode)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(roundTripped, label) {
+			return fmt.Errorf("label %s decodes to %q, which encodes as %s", label,
+				unicode, roundTripped)
+		}
+	}
+	return nil
+}
+
+// Returns true if name isn't a valid IDN (see punycodeError).
+func hasInvalidPunycode(name string) bool {
+	return punycodeError(name) != nil
+}
+
+// dnsNameCheck flags certs where invalid returns true for any of the names
+// returned by dnsNamesToCheck.
+type dnsNameCheck struct {
+	checkInfo
+	invalid func(name string) bool
+}
+
+func (check dnsNameCheck) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, name := range dnsNamesToCheck(cert) {
+		if check.invalid(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterCheck(dnsNameCheck{checkInfo{
+		DNS_NAME_UNDERSCORE, "7.1.4.2.1", SEVERITY_ERROR, underscoresSunsetDate},
+		hasUnderscore})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		DNS_NAME_EMPTY_LABEL, "7.1.4.2.1", SEVERITY_ERROR, time.Time{}},
+		hasEmptyLabel})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		DNS_NAME_LABEL_TOO_LONG, "7.1.4.2.1", SEVERITY_ERROR, time.Time{}},
+		hasLabelTooLong})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		DNS_NAME_TRAILING_DOT, "7.1.4.2.1", SEVERITY_WARNING, time.Time{}},
+		hasTrailingDot})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		WILDCARD_NOT_LEFTMOST, "1.6.1", SEVERITY_ERROR, time.Time{}},
+		hasWildcardNotLeftmost})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		PARTIAL_LABEL_WILDCARD, "1.6.1", SEVERITY_ERROR, time.Time{}},
+		hasPartialLabelWildcard})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		WILDCARD_ON_PUBLIC_SUFFIX, "11.1.3", SEVERITY_ERROR, time.Time{}},
+		hasWildcardOnPublicSuffix})
+	RegisterCheck(dnsNameCheck{checkInfo{
+		INVALID_PUNYCODE, "7.1.4.2.1", SEVERITY_ERROR, time.Time{}},
+		hasInvalidPunycode})
+}
@@ -0,0 +1,64 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSNameChecks(t *testing.T) {
+	cases := []struct {
+		name     string
+		violated string
+	}{
+		{"www.example.com", ""},
+		{"*.example.com", ""},
+		{"xn--bcher-kva.example.com", ""},
+		{"under_score.example.com", DNS_NAME_UNDERSCORE},
+		{"www..example.com", DNS_NAME_EMPTY_LABEL},
+		{".example.com", DNS_NAME_EMPTY_LABEL},
+		{strings.Repeat("a", 64) + ".example.com", DNS_NAME_LABEL_TOO_LONG},
+		{"www.example.com.", DNS_NAME_TRAILING_DOT},
+		{"www.*.example.com", WILDCARD_NOT_LEFTMOST},
+		{"w*.example.com", PARTIAL_LABEL_WILDCARD},
+		{"*.co.uk", WILDCARD_ON_PUBLIC_SUFFIX},
+		{"xn--abc-.example.com", INVALID_PUNYCODE},
+	}
+	dnsNameChecks := []string{DNS_NAME_UNDERSCORE, DNS_NAME_EMPTY_LABEL,
+		DNS_NAME_LABEL_TOO_LONG, DNS_NAME_TRAILING_DOT, WILDCARD_NOT_LEFTMOST,
+		PARTIAL_LABEL_WILDCARD, WILDCARD_ON_PUBLIC_SUFFIX, INVALID_PUNYCODE}
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range cases {
+		cert := &x509.Certificate{NotBefore: notBefore, DNSNames: []string{c.name}}
+		for _, id := range dnsNameChecks {
+			check := CheckByID(id)
+			violated := CheckApplies(check, cert) && check.Run(cert, nil)
+			if violated != (id == c.violated) {
+				t.Errorf("%s for %s: expected %v", id, c.name, id == c.violated)
+			}
+		}
+	}
+}
+
+func TestDNSNameChecksIncludeCN(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "bad_name.example.com"}}
+	if !CheckByID(DNS_NAME_UNDERSCORE).Run(cert, nil) {
+		t.Error("The CN of subscriber certs should be checked")
+	}
+	cert.IsCA = true
+	if CheckByID(DNS_NAME_UNDERSCORE).Run(cert, nil) {
+		t.Error("The CN of CA certs isn't a DNS name")
+	}
+}
+
+func TestUnderscoresAllowedBeforeSC12(t *testing.T) {
+	cert := &x509.Certificate{
+		NotBefore: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:  []string{"under_score.example.com"},
+	}
+	if CheckApplies(CheckByID(DNS_NAME_UNDERSCORE), cert) {
+		t.Error("Underscores should only be checked after April 2019")
+	}
+}
@@ -0,0 +1,48 @@
+package sunlight
+
+import (
+	"fmt"
+)
+
+// An error reading one of the files the package loads its data from (root
+// lists, weak key lists, log lists, ...).
+type FileError struct {
+	Filename string
+	Err      error
+}
+
+func (err *FileError) Error() string {
+	return fmt.Sprintf("can't read %s: %s", err.Filename, err.Err)
+}
+
+// An error in the contents of a loaded file or of a certificate: What is
+// the file or part of the certificate that couldn't be parsed.
+type ParseError struct {
+	What string
+	Err  error
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("can't parse %s: %s", err.What, err.Err)
+}
+
+// An error that kept a check from being evaluated for a certificate. The
+// certificate may or may not violate the check's rule.
+type CheckError struct {
+	ID  string
+	Err error
+}
+
+func (err *CheckError) Error() string {
+	return fmt.Sprintf("can't evaluate %s: %s", err.ID, err.Err)
+}
+
+// An error looking up the reputation of one of a certificate's names.
+type ReputationError struct {
+	Host string
+	Err  error
+}
+
+func (err *ReputationError) Error() string {
+	return fmt.Sprintf("can't rank %s: %s", err.Host, err.Err)
+}
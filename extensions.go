@@ -0,0 +1,145 @@
+package sunlight
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+)
+
+var oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+// Returns true if cert asserts CA:true. Everything else is treated as a
+// subscriber (end-entity) certificate.
+func isCACert(cert *x509.Certificate) bool {
+	return cert.BasicConstraintsValid && cert.IsCA
+}
+
+// Returns cert's extension with the given OID, or nil if it doesn't have
+// one.
+func findExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) *pkix.Extension {
+	for i := range cert.Extensions {
+		if cert.Extensions[i].Id.Equal(oid) {
+			return &cert.Extensions[i]
+		}
+	}
+	return nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+type missingServerAuthEKU struct{ checkInfo }
+
+// BR 7.1.2.3 (f): subscriber certs must have id-kp-serverAuth.
+func (missingServerAuthEKU) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return !isCACert(cert) && !hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth)
+}
+
+type anyExtendedKeyUsage struct{ checkInfo }
+
+func (anyExtendedKeyUsage) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return !isCACert(cert) && hasExtKeyUsage(cert, x509.ExtKeyUsageAny)
+}
+
+type inappropriateKeyUsage struct{ checkInfo }
+
+// Subscriber certs must not be able to sign certificates or CRLs, and the
+// usages they do have must make sense for TLS with their key type: RSA keys
+// may be used for signatures and key encipherment, other keys only for
+// signatures and key agreement.
+func (inappropriateKeyUsage) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	usage := cert.KeyUsage
+	if isCACert(cert) || usage == 0 {
+		return false
+	}
+	if usage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return true
+	}
+	_, isRSA := cert.PublicKey.(*rsa.PublicKey)
+	if !isRSA && usage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+		return true
+	}
+	if usage&x509.KeyUsageDigitalSignature != 0 {
+		return false
+	}
+	return !(isRSA && usage&x509.KeyUsageKeyEncipherment != 0)
+}
+
+type subscriberCATrue struct{ checkInfo }
+
+// BR 7.1.2.3 (d): if present, basicConstraints must have CA:false. A cert
+// that claims CA:true and names DNS hosts is a subscriber cert with the wrong
+// basicConstraints if it can't sign certificates, or if it's for TLS servers
+// (even with keyCertSign set).
+func (subscriberCATrue) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return isCACert(cert) && len(cert.DNSNames) > 0 &&
+		(cert.KeyUsage&x509.KeyUsageCertSign == 0 ||
+			hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth))
+}
+
+// Returns the certificates in chain that act as CAs for cert. A log entry's
+// chain can also hold cert itself or the precertificate it was logged from,
+// which aren't CAs, and a version 1 root, which can't have the extensions CA
+// certs must have but is trusted as it is.
+func chainCAs(cert *x509.Certificate, chain []*x509.Certificate) []*x509.Certificate {
+	var cas []*x509.Certificate
+	for _, ca := range chain {
+		if bytes.Equal(ca.Raw, cert.Raw) || IsPrecertificate(ca) ||
+			(ca.Version < 3 && bytes.Equal(ca.RawIssuer, ca.RawSubject)) {
+			continue
+		}
+		cas = append(cas, ca)
+	}
+	return cas
+}
+
+type caBasicConstraintsNotCritical struct{ checkInfo }
+
+// BR 7.1.2.1 (b), 7.1.2.2 (d): CA certs must have a critical
+// basicConstraints extension with CA:true. Missing the extension entirely is
+// also a violation.
+func (caBasicConstraintsNotCritical) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, ca := range chainCAs(cert, chain) {
+		ext := findExtension(ca, oidExtensionBasicConstraints)
+		if ext == nil || !ext.Critical || !ca.IsCA {
+			return true
+		}
+	}
+	return false
+}
+
+type caMissingKeyCertSign struct{ checkInfo }
+
+// BR 7.1.2.1 (c), 7.1.2.2 (e): CA certs must have keyCertSign.
+func (caMissingKeyCertSign) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, ca := range chainCAs(cert, chain) {
+		if ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterCheck(missingServerAuthEKU{checkInfo{
+		MISSING_SERVER_AUTH_EKU, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(anyExtendedKeyUsage{checkInfo{
+		ANY_EXTENDED_KEY_USAGE, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(inappropriateKeyUsage{checkInfo{
+		INAPPROPRIATE_KEY_USAGE, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(subscriberCATrue{checkInfo{
+		SUBSCRIBER_CA_TRUE, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(caBasicConstraintsNotCritical{checkInfo{
+		CA_BASIC_CONSTRAINTS_NOT_CRITICAL, "7.1.2.2", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(caMissingKeyCertSign{checkInfo{
+		CA_MISSING_KEY_CERT_SIGN, "7.1.2.2", SEVERITY_ERROR, time.Time{}}})
+}
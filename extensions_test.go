@@ -0,0 +1,179 @@
+package sunlight
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+)
+
+func caTemplate(notBefore time.Time) *x509.Certificate {
+	template := subscriberTemplate(notBefore)
+	template.Subject.CommonName = "Test CA"
+	template.DNSNames = nil
+	template.ExtKeyUsage = nil
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return template
+}
+
+func TestSubscriberExtensionChecks(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		modify   func(template *x509.Certificate)
+		violated string
+	}{
+		{func(template *x509.Certificate) {}, ""},
+		{func(template *x509.Certificate) {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}, MISSING_SERVER_AUTH_EKU},
+		{func(template *x509.Certificate) {
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageAny)
+		}, ANY_EXTENDED_KEY_USAGE},
+		{func(template *x509.Certificate) {
+			template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}, INAPPROPRIATE_KEY_USAGE},
+		{func(template *x509.Certificate) {
+			template.IsCA = true
+		}, SUBSCRIBER_CA_TRUE},
+		// keyCertSign doesn't make a TLS server cert a CA.
+		{func(template *x509.Certificate) {
+			template.IsCA = true
+			template.KeyUsage |= x509.KeyUsageCertSign
+		}, SUBSCRIBER_CA_TRUE},
+	}
+	extensionChecks := []string{MISSING_SERVER_AUTH_EKU, ANY_EXTENDED_KEY_USAGE,
+		INAPPROPRIATE_KEY_USAGE, SUBSCRIBER_CA_TRUE,
+		CA_BASIC_CONSTRAINTS_NOT_CRITICAL, CA_MISSING_KEY_CERT_SIGN}
+	ca := makeCert(t, caTemplate(now))
+	for i, c := range cases {
+		template := subscriberTemplate(now)
+		c.modify(template)
+		cert := makeCert(t, template)
+		summary, _ := CalculateCertSummary(cert, 0, nil, []*x509.Certificate{ca}, nil)
+		for _, id := range extensionChecks {
+			if summary.Violations[id] != (id == c.violated) {
+				t.Errorf("case %d: %s expected %v", i, id, id == c.violated)
+			}
+		}
+	}
+}
+
+func TestCAExtensionChecks(t *testing.T) {
+	now := time.Now()
+	leaf := makeCert(t, subscriberTemplate(now))
+
+	template := caTemplate(now)
+	template.KeyUsage = x509.KeyUsageCRLSign
+	noCertSign := makeCert(t, template)
+	if !CheckByID(CA_MISSING_KEY_CERT_SIGN).Run(leaf, []*x509.Certificate{noCertSign}) {
+		t.Error("Expected CA without keyCertSign to be flagged")
+	}
+
+	template = caTemplate(now)
+	template.BasicConstraintsValid = false
+	template.IsCA = false
+	noBasicConstraints := makeCert(t, template)
+	if !CheckByID(CA_BASIC_CONSTRAINTS_NOT_CRITICAL).Run(leaf,
+		[]*x509.Certificate{noBasicConstraints}) {
+		t.Error("Expected CA without basicConstraints to be flagged")
+	}
+}
+
+// Returns a self-signed version 1 certificate for template, like an old root:
+// the one x509.CreateCertificate makes, without its version and extensions.
+func makeV1Cert(t *testing.T, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	v3 := makeCertWithKey(t, template, &key.PublicKey, key)
+	var tbs asn1.RawValue
+	if _, err := asn1.Unmarshal(v3.RawTBSCertificate, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	var fields []byte
+	for rest := tbs.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			t.Fatal(err)
+		}
+		// The version is [0] and the extensions are [3].
+		if field.Class != asn1.ClassContextSpecific {
+			fields = append(fields, field.FullBytes...)
+		}
+	}
+	v1TBS, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true,
+		Bytes: fields})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(v1TBS)
+	signature, err := key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outer struct {
+		TBS       asn1.RawValue
+		Algorithm asn1.RawValue
+		Signature asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(v3.Raw, &outer); err != nil {
+		t.Fatal(err)
+	}
+	outer.TBS = asn1.RawValue{FullBytes: v1TBS}
+	outer.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	der, err := asn1.Marshal(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("could not parse certificate", err)
+	}
+	return cert, key
+}
+
+func TestCAExtensionChecksLogEntry(t *testing.T) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Version 1 Root"
+	root, rootKey := makeV1Cert(t, template)
+	if root.Version != 1 || len(root.Extensions) != 0 {
+		t.Fatalf("Expected a version 1 root, got version %d", root.Version)
+	}
+	template.Subject.CommonName = "Intermediate"
+	intermediate, intermediateKey := issueCert(t, template, root, rootKey)
+
+	// A precert entry: the logged TBS and the precertificate it came from,
+	// followed by the chain.
+	tbs, precert := makePrecert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		intermediate, intermediateKey)
+	parsed, err := ParsePrecertificate(tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := []*x509.Certificate{precert, intermediate, root}
+	summary, _ := CalculatePrecertSummary(parsed, 0, nil, chain, nil)
+	for _, id := range []string{CA_BASIC_CONSTRAINTS_NOT_CRITICAL, CA_MISSING_KEY_CERT_SIGN} {
+		if summary.Violations[id] {
+			t.Errorf("%s shouldn't be flagged for the precertificate or the v1 root", id)
+		}
+		if CheckByID(id).Run(precert, chain) {
+			t.Errorf("%s shouldn't be flagged for a cert in its own chain", id)
+		}
+	}
+
+	template = caTemplate(notBefore)
+	template.KeyUsage = x509.KeyUsageCRLSign
+	noCertSign, _ := issueCert(t, template, root, rootKey)
+	if !CheckByID(CA_MISSING_KEY_CERT_SIGN).Run(parsed,
+		[]*x509.Certificate{precert, noCertSign, root}) {
+		t.Error("Expected an intermediate without keyCertSign to be flagged")
+	}
+}
@@ -0,0 +1,133 @@
+package sunlight
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidNamedCurveP224 = asn1.ObjectIdentifier{1, 3, 132, 0, 33}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// BR 6.1.5 and the Mozilla Root Store Policy only permit these curves.
+var allowedCurves = map[string]bool{
+	oidNamedCurveP256.String(): true,
+	oidNamedCurveP384.String(): true,
+	oidNamedCurveP521.String(): true,
+}
+
+var curveNames = map[string]string{
+	oidNamedCurveP224.String(): "P-224",
+	oidNamedCurveP256.String(): "P-256",
+	oidNamedCurveP384.String(): "P-384",
+	oidNamedCurveP521.String(): "P-521",
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// Returns the OID of the named curve in cert's subject public key info, or nil
+// if the key isn't an ECDSA key with a named curve.
+func namedCurveOID(cert *x509.Certificate) asn1.ObjectIdentifier {
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &curve); err != nil {
+		return nil
+	}
+	return curve
+}
+
+// Returns the name of the curve cert's key is on ("P-256", etc.), the dotted
+// OID for curves we don't have a name for, or "" for non-ECDSA keys.
+func CurveName(cert *x509.Certificate) string {
+	curve := namedCurveOID(cert)
+	if curve == nil {
+		return ""
+	}
+	if name, ok := curveNames[curve.String()]; ok {
+		return name
+	}
+	return curve.String()
+}
+
+// Fills in the KeyAlgorithm, Curve, KeySize and Exp fields of summary. KeySize
+// is the modulus size for RSA keys and the curve size for ECDSA keys. Fields
+// that don't apply to the key type are -1 (or "" for Curve).
+func summarizeKey(cert *x509.Certificate, summary *CertSummary) {
+	summary.KeyAlgorithm = cert.PublicKeyAlgorithm.String()
+	summary.Curve = CurveName(cert)
+	summary.KeySize = -1
+	summary.Exp = -1
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		summary.KeySize = key.N.BitLen()
+		summary.Exp = key.E
+	case *ecdsa.PublicKey:
+		summary.KeySize = key.Curve.Params().BitSize
+	case *dsa.PublicKey:
+		summary.KeySize = key.P.BitLen()
+	}
+}
+
+type disallowedCurve struct{ checkInfo }
+
+func (disallowedCurve) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if cert.PublicKeyAlgorithm != x509.ECDSA {
+		return false
+	}
+	curve := namedCurveOID(cert)
+	// Explicit curve parameters aren't allowed either.
+	return curve == nil || !allowedCurves[curve.String()]
+}
+
+type invalidECPoint struct{ checkInfo }
+
+// crypto/x509 won't parse most malformed points, but double check that the
+// point is a valid, non-infinity point on the curve.
+func (invalidECPoint) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	if key.X == nil || key.Y == nil || (key.X.Sign() == 0 && key.Y.Sign() == 0) {
+		return true
+	}
+	p := key.Curve.Params().P
+	if key.X.Sign() < 0 || key.Y.Sign() < 0 || key.X.Cmp(p) >= 0 || key.Y.Cmp(p) >= 0 {
+		return true
+	}
+	return !key.Curve.IsOnCurve(key.X, key.Y)
+}
+
+type dsaKey struct{ checkInfo }
+
+func (dsaKey) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.PublicKeyAlgorithm == x509.DSA
+}
+
+func init() {
+	RegisterCheck(disallowedCurve{checkInfo{
+		DISALLOWED_CURVE, "6.1.5", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(invalidECPoint{checkInfo{
+		INVALID_EC_POINT, "6.1.6", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(dsaKey{checkInfo{
+		DSA_KEY, "6.1.5", SEVERITY_ERROR, time.Time{}}})
+}
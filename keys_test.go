@@ -0,0 +1,65 @@
+package sunlight
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestECDSAKeySummary(t *testing.T) {
+	cert := makeCert(t, subscriberTemplate(time.Now()))
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	if summary.KeyAlgorithm != "ECDSA" || summary.Curve != "P-256" {
+		t.Errorf("Expected ECDSA P-256, got %s %s", summary.KeyAlgorithm,
+			summary.Curve)
+	}
+	if summary.KeySize != 256 || summary.Exp != -1 {
+		t.Errorf("Unexpected key size %d or exponent %d", summary.KeySize,
+			summary.Exp)
+	}
+	for _, id := range []string{DISALLOWED_CURVE, INVALID_EC_POINT, DSA_KEY} {
+		if summary.Violations[id] {
+			t.Errorf("P-256 key should not violate %s", id)
+		}
+	}
+}
+
+func TestDisallowedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	cert := makeCertWithKey(t, subscriberTemplate(time.Now()), &key.PublicKey, key)
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	if summary.Curve != "P-224" {
+		t.Error("Expected P-224, got", summary.Curve)
+	}
+	if !summary.Violations[DISALLOWED_CURVE] {
+		t.Error("P-224 should be a disallowed curve")
+	}
+}
+
+func TestInvalidECPoint(t *testing.T) {
+	cert := &x509.Certificate{
+		PublicKeyAlgorithm: x509.ECDSA,
+		PublicKey: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     big.NewInt(1),
+			Y:     big.NewInt(1),
+		},
+	}
+	if !CheckByID(INVALID_EC_POINT).Run(cert, nil) {
+		t.Error("(1, 1) is not on P-256")
+	}
+}
+
+func TestDSAKey(t *testing.T) {
+	cert := &x509.Certificate{PublicKeyAlgorithm: x509.DSA}
+	if !CheckByID(DSA_KEY).Run(cert, nil) {
+		t.Error("DSA keys should be flagged")
+	}
+}
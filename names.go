@@ -0,0 +1,137 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+	"time"
+)
+
+// BR 9.2.1: As of the Effective Date (July 1, 2012), CAs shouldn't issue
+// certificates containing internal names or reserved IP addresses that expire
+// after November 1, 2015.
+var (
+	internalNamesEffectiveDate = time.Date(2012, 7, 1, 0, 0, 0, 0, time.UTC)
+	internalNamesSunsetDate    = time.Date(2015, 11, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// IANA IPv4 and IPv6 special-purpose address blocks, plus multicast and the
+// IPv4 class E space. Addresses in these ranges can't be validated as
+// belonging to a subscriber.
+var reservedIPNets []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"192.88.99.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"64:ff9b::/96",
+		"100::/64",
+		"2001::/23",
+		"2001:db8::/32",
+		"2002::/16",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("sunlight: bad reserved IP range " + cidr)
+		}
+		reservedIPNets = append(reservedIPNets, ipNet)
+	}
+}
+
+// Returns true if ip is in one of the IANA reserved ranges.
+func IsReservedIP(ip net.IP) bool {
+	// IPv4-mapped IPv6 addresses are checked as the IPv4 address they map to.
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, ipNet := range reservedIPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if name (a dNSName, possibly a wildcard) isn't resolvable in
+// the public DNS: either it has a single label, or its top-level domain
+// isn't one delegated by IANA (e.g. ".local" or ".corp").
+func IsInternalName(name string) bool {
+	name = normalizeDNSName(strings.TrimPrefix(name, "*."))
+	if !strings.Contains(name, ".") {
+		return true
+	}
+	return !HasPublicTLD(name)
+}
+
+// Certs that expire before the sunset date were still allowed.
+func expiresAfterInternalNamesSunset(cert *x509.Certificate) bool {
+	return cert.NotAfter.After(internalNamesSunsetDate)
+}
+
+type internalName struct{ checkInfo }
+
+func (internalName) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if !expiresAfterInternalNamesSunset(cert) {
+		return false
+	}
+	for _, name := range cert.DNSNames {
+		// IP addresses are covered by IPAddressInDNSName.
+		if net.ParseIP(name) == nil && IsInternalName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+type reservedIPAddress struct{ checkInfo }
+
+func (reservedIPAddress) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if !expiresAfterInternalNamesSunset(cert) {
+		return false
+	}
+	for _, ip := range cert.IPAddresses {
+		if IsReservedIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type ipAddressInDNSName struct{ checkInfo }
+
+// IP addresses must be in iPAddress entries, not dNSName ones.
+func (ipAddressInDNSName) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, name := range cert.DNSNames {
+		if net.ParseIP(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterCheck(internalName{checkInfo{
+		INTERNAL_NAME, "9.2.1", SEVERITY_ERROR, internalNamesEffectiveDate}})
+	RegisterCheck(reservedIPAddress{checkInfo{
+		RESERVED_IP_ADDRESS, "9.2.1", SEVERITY_ERROR, internalNamesEffectiveDate}})
+	RegisterCheck(ipAddressInDNSName{checkInfo{
+		IP_ADDRESS_IN_DNS_NAME, "9.2.1", SEVERITY_ERROR, time.Time{}}})
+}
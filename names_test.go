@@ -0,0 +1,63 @@
+package sunlight
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIsInternalName(t *testing.T) {
+	internal := []string{"localhost", "server.local", "mail.corp",
+		"*.example.internal", "printer"}
+	public := []string{"example.com", "www.example.co.uk", "*.example.org",
+		"example.com.", "EXAMPLE.COM", "xn--fiqs8s.xn--fiqs8s"}
+	for _, name := range internal {
+		if !IsInternalName(name) {
+			t.Errorf("%s should be an internal name", name)
+		}
+	}
+	for _, name := range public {
+		if IsInternalName(name) {
+			t.Errorf("%s should not be an internal name", name)
+		}
+	}
+}
+
+func TestIsReservedIP(t *testing.T) {
+	reserved := []string{"10.1.2.3", "172.20.0.1", "192.168.1.1", "127.0.0.1",
+		"169.254.1.1", "::1", "fe80::1", "fd00::1", "::ffff:10.0.0.1"}
+	public := []string{"8.8.8.8", "93.184.216.34", "2606:2800:220:1::1"}
+	for _, ip := range reserved {
+		if !IsReservedIP(net.ParseIP(ip)) {
+			t.Errorf("%s should be reserved", ip)
+		}
+	}
+	for _, ip := range public {
+		if IsReservedIP(net.ParseIP(ip)) {
+			t.Errorf("%s should not be reserved", ip)
+		}
+	}
+}
+
+func TestInternalNameChecks(t *testing.T) {
+	template := subscriberTemplate(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	template.DNSNames = []string{"test.example.com", "server.local", "10.0.0.1"}
+	template.IPAddresses = []net.IP{net.ParseIP("192.168.0.1")}
+	cert := makeCert(t, template)
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	for _, id := range []string{INTERNAL_NAME, RESERVED_IP_ADDRESS,
+		IP_ADDRESS_IN_DNS_NAME} {
+		if !summary.Violations[id] {
+			t.Errorf("Expected %s to be violated", id)
+		}
+	}
+
+	// Certs expiring before the sunset date were allowed.
+	template.NotBefore = time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template.NotAfter = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert = makeCert(t, template)
+	summary, _ = CalculateCertSummary(cert, 0, nil, nil, nil)
+	if summary.Violations[INTERNAL_NAME] || summary.Violations[RESERVED_IP_ADDRESS] {
+		t.Error("Internal names were allowed in certs expiring before the sunset date")
+	}
+}
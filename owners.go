@@ -0,0 +1,173 @@
+package sunlight
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Maps CA certificates (intermediates and roots) to the CA organisations that
+// own them, which is who incidents are filed against. A root store only says
+// who owns its roots, and an intermediate can be operated by another
+// organisation than its root's.
+type OwnerMap struct {
+	bySPKIHash map[string]string
+	bySubject  map[string]string
+}
+
+func NewOwnerMap() *OwnerMap {
+	return &OwnerMap{make(map[string]string), make(map[string]string)}
+}
+
+// Records that the CA certificates with the key hash (see SPKIHash) are owned
+// by owner.
+func (owners *OwnerMap) AddSPKIHash(hash string, owner string) {
+	owners.bySPKIHash[hash] = owner
+}
+
+// Records that the CA certificates with the RFC 4514 subject DN dn are owned
+// by owner. These are only used for certificates whose key isn't in the map.
+func (owners *OwnerMap) AddSubject(dn string, owner string) {
+	owners.bySubject[dn] = owner
+}
+
+// Returns the number of keys and DNs in the map.
+func (owners *OwnerMap) Len() int {
+	if owners == nil {
+		return 0
+	}
+	return len(owners.bySPKIHash) + len(owners.bySubject)
+}
+
+// Returns the owner of the CA certificate with the key hash and subject DN
+// dn, by its key if that's in the map and otherwise by its DN, or "" if
+// neither is.
+func (owners *OwnerMap) Owner(hash string, dn string) string {
+	if owners == nil {
+		return ""
+	}
+	if owner, ok := owners.bySPKIHash[hash]; ok && len(hash) > 0 {
+		return owner
+	}
+	if owner, ok := owners.bySubject[dn]; ok && len(dn) > 0 {
+		return owner
+	}
+	return ""
+}
+
+// Sets summary's RootOwner and CAOwner from the map where it has the owners
+// of the cert's root and issuer. The issuer's owner takes precedence for
+// CAOwner, then the root's, then the one CalculateCertSummary found.
+func (owners *OwnerMap) Apply(summary *CertSummary) {
+	if owner := owners.Owner(summary.RootKey, summary.RootDN); len(owner) > 0 {
+		summary.RootOwner = owner
+		summary.CAOwner = owner
+	}
+	if owner := owners.Owner(summary.IssuerKey, summary.IssuerDN); len(owner) > 0 {
+		summary.CAOwner = owner
+	}
+}
+
+// Returns the owner mapping in filename, a CSV file in the style of CCADB's
+// certificate records reports, with a header row naming its columns. "CA
+// Owner" is the owner, unless "Subordinate CA Owner" names an organisation
+// that operates the certificate on its behalf. The certificate is given by
+// "SPKI SHA256", the sha256 hash of its public key in hex or base64, by
+// "Subject", its RFC 4514 subject DN, or by "PEM Info", the certificate
+// itself, which gives both. Lines starting with # are comments.
+func LoadOwnerMap(filename string) (*OwnerMap, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{filename, err}
+	}
+	owners, err := parseOwnerMap(data)
+	if err != nil {
+		return nil, &ParseError{filename, err}
+	}
+	return owners, nil
+}
+
+// Returns hash, the hex or base64 sha256 of a public key, in SPKIHash's
+// encoding.
+func normalizeSPKIHash(hash string) (string, error) {
+	hash = strings.Replace(strings.TrimSpace(hash), ":", "", -1)
+	var decoded []byte
+	var err error
+	if len(hash) == 64 {
+		decoded, err = hex.DecodeString(hash)
+	} else {
+		decoded, err = base64.StdEncoding.DecodeString(hash)
+	}
+	if err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("bad SPKI hash %s", hash)
+	}
+	return base64.StdEncoding.EncodeToString(decoded), nil
+}
+
+func parseOwnerMap(data []byte) (*OwnerMap, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["CA Owner"]; !ok {
+		return nil, fmt.Errorf("no CA Owner column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	owners := NewOwnerMap()
+	for i, record := range records[1:] {
+		owner := field(record, "Subordinate CA Owner")
+		if len(owner) == 0 {
+			owner = field(record, "CA Owner")
+		}
+		if len(owner) == 0 {
+			return nil, fmt.Errorf("row %d: no owner", i+1)
+		}
+		hash, subject := field(record, "SPKI SHA256"), field(record, "Subject")
+		if len(hash) > 0 {
+			if hash, err = normalizeSPKIHash(hash); err != nil {
+				return nil, fmt.Errorf("row %d: %s", i+1, err)
+			}
+		}
+		if pemInfo := field(record, "PEM Info"); len(pemInfo) > 0 {
+			block, _ := pem.Decode([]byte(strings.Trim(pemInfo, "'")))
+			if block == nil {
+				return nil, fmt.Errorf("row %d: no PEM", i+1)
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %s", i+1, err)
+			}
+			hash, subject = SPKIHash(cert), cert.Subject.String()
+		}
+		if len(hash) == 0 && len(subject) == 0 {
+			return nil, fmt.Errorf("row %d: no SPKI SHA256, Subject or PEM Info", i+1)
+		}
+		if len(hash) > 0 {
+			owners.AddSPKIHash(hash, owner)
+		}
+		if len(subject) > 0 {
+			owners.AddSubject(subject, owner)
+		}
+	}
+	return owners, nil
+}
@@ -0,0 +1,117 @@
+package sunlight
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadOwnerMap(t *testing.T) {
+	root1, root2, intermediate := makeRootStoreCerts(t)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spkiHash := sha256.Sum256(intermediate.RawSubjectPublicKeyInfo)
+	csv := "\"CA Owner\",\"Subordinate CA Owner\",\"SPKI SHA256\",\"Subject\",\"PEM Info\"\n" +
+		"# Externally operated\n" +
+		fmt.Sprintf("\"Acme\",\"Acme Subsidiary\",\"%s\",,\n",
+			strings.ToUpper(hex.EncodeToString(spkiHash[:]))) +
+		fmt.Sprintf("\"Acme\",,\"%s\",,\n", SPKIHash(root1)) +
+		"\"Example\",,,\"CN=Example Issuing CA,O=Example\",\n" +
+		fmt.Sprintf("\"Example\",,,,\"'%s'\"\n", strings.TrimSpace(string(pemEncode(root2))))
+	owners, err := LoadOwnerMap(writeTempFile(t, dir, "owners.csv", csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owners.Len() != 5 {
+		t.Errorf("Expected 5 keys and DNs, got %d", owners.Len())
+	}
+	if owner := owners.Owner(SPKIHash(intermediate), intermediate.Subject.String()); owner != "Acme Subsidiary" {
+		t.Errorf("The intermediate should be owned by its operator, not %s", owner)
+	}
+	if owner := owners.Owner(SPKIHash(root1), ""); owner != "Acme" {
+		t.Errorf("Root One should be owned by Acme, not %s", owner)
+	}
+	if owner := owners.Owner("keyid:01", "CN=Example Issuing CA,O=Example"); owner != "Example" {
+		t.Errorf("Expected an owner by DN, got %s", owner)
+	}
+	if owners.Owner(SPKIHash(root2), "") != "Example" ||
+		owners.Owner("", root2.Subject.String()) != "Example" {
+		t.Error("Root Two should be owned by Example by key and DN")
+	}
+	if owners.Owner("", "") != "" || owners.Owner("unknown", "CN=Unknown") != "" {
+		t.Error("Shouldn't know the owner of an unknown certificate")
+	}
+	var none *OwnerMap
+	if none.Owner(SPKIHash(root1), "") != "" || none.Len() != 0 {
+		t.Error("A nil map shouldn't know any owners")
+	}
+
+	for _, bad := range []string{
+		"\"Owner\",\"Subject\"\n\"Acme\",\"CN=Acme\"\n",
+		"\"CA Owner\",\"SPKI SHA256\"\n\"Acme\",\"abcd\"\n",
+		"\"CA Owner\",\"Subject\"\n\"Acme\",\n",
+		"\"CA Owner\",\"Subject\"\n,\"CN=Acme\"\n",
+	} {
+		_, err := LoadOwnerMap(writeTempFile(t, dir, "bad.csv", bad))
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Expected a ParseError for %q, got %v", bad, err)
+		}
+	}
+	if _, err := LoadOwnerMap("does-not-exist.csv"); err == nil {
+		t.Error("Expected an error for a missing file")
+	} else if _, ok := err.(*FileError); !ok {
+		t.Errorf("Expected a FileError, got %v", err)
+	}
+}
+
+func TestOwnerMapApply(t *testing.T) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Root"
+	root, rootKey := issueCert(t, template, nil, nil)
+	template.Subject.CommonName = "Intermediate"
+	intermediate, intermediateKey := issueCert(t, template, root, rootKey)
+	leaf, _ := issueCert(t, subscriberTemplate(notBefore.AddDate(0, 1, 0)),
+		intermediate, intermediateKey)
+	store := NewRootStore()
+	store.Add(&Root{Cert: root, Owner: "Acme", Websites: true})
+	programs := []RootProgram{{ROOT_PROGRAM_MOZILLA, store}}
+	chain := []*x509.Certificate{intermediate}
+
+	summary, _ := CalculateCertSummary(leaf, 0, nil, chain, programs)
+	if summary.RootKey != SPKIHash(root) || summary.RootDN != "CN=Root" ||
+		summary.RootOwner != "Acme" || summary.CAOwner != "Acme" {
+		t.Fatalf("Unexpected root %s %s %s %s", summary.RootKey, summary.RootDN,
+			summary.RootOwner, summary.CAOwner)
+	}
+
+	owners := NewOwnerMap()
+	owners.AddSubject("CN=Root", "Acme Holdings")
+	applied := *summary
+	owners.Apply(&applied)
+	if applied.RootOwner != "Acme Holdings" || applied.CAOwner != "Acme Holdings" {
+		t.Errorf("The root's owner should come from the map, not %s", applied.RootOwner)
+	}
+	owners.AddSPKIHash(SPKIHash(intermediate), "Acme Subsidiary")
+	applied = *summary
+	owners.Apply(&applied)
+	if applied.RootOwner != "Acme Holdings" || applied.CAOwner != "Acme Subsidiary" {
+		t.Errorf("The issuer's owner should take precedence, not %s", applied.CAOwner)
+	}
+
+	unrooted, _ := CalculateCertSummary(leaf, 0, nil, chain, nil)
+	owners.Apply(unrooted)
+	if len(unrooted.RootKey) != 0 || len(unrooted.RootOwner) != 0 ||
+		unrooted.CAOwner != "Acme Subsidiary" {
+		t.Error("A cert that doesn't chain to a root should only get its issuer's owner")
+	}
+}
@@ -0,0 +1,203 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	VALIDATION_LEVEL_DV      = "DV"
+	VALIDATION_LEVEL_OV      = "OV"
+	VALIDATION_LEVEL_IV      = "IV"
+	VALIDATION_LEVEL_EV      = "EV"
+	VALIDATION_LEVEL_UNKNOWN = "Unknown"
+)
+
+// CA/B Forum reserved certificate policy identifiers.
+var (
+	oidPolicyEV = asn1.ObjectIdentifier{2, 23, 140, 1, 1}
+	oidPolicyDV = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+	oidPolicyOV = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+	oidPolicyIV = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 3}
+)
+
+// Subject attributes that pkix.Name doesn't have fields for.
+var (
+	oidAttributeSurname                 = asn1.ObjectIdentifier{2, 5, 4, 4}
+	oidAttributeBusinessCategory        = asn1.ObjectIdentifier{2, 5, 4, 15}
+	oidAttributeGivenName               = asn1.ObjectIdentifier{2, 5, 4, 42}
+	oidAttributePseudonym               = asn1.ObjectIdentifier{2, 5, 4, 65}
+	oidAttributeJurisdictionCountryName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 60, 2, 1, 3}
+)
+
+var evPolicyOIDsLock sync.RWMutex
+
+// CA-specific policy OIDs that indicate EV, mapped to the CA that uses them.
+// More can be added with LoadEVPolicyOIDs.
+var evPolicyOIDs = map[string]string{
+	"1.3.6.1.4.1.14370.1.6":        "GeoTrust",
+	"1.3.6.1.4.1.4146.1.1":         "GlobalSign",
+	"1.3.6.1.4.1.6449.1.2.1.5.1":   "Comodo",
+	"1.3.6.1.4.1.782.1.2.1.8.1":    "Network Solutions",
+	"1.3.6.1.4.1.8024.0.2.100.1.2": "QuoVadis",
+	"2.16.578.1.26.1.3.3":          "Buypass",
+	"2.16.756.1.89.1.2.1.1":        "SwissSign",
+	"2.16.840.1.113733.1.7.23.6":   "VeriSign",
+	"2.16.840.1.113733.1.7.48.1":   "Thawte",
+	"2.16.840.1.114028.10.1.2":     "Entrust",
+	"2.16.840.1.114412.2.1":        "DigiCert",
+	"2.16.840.1.114413.1.7.23.3":   "Go Daddy",
+	"2.16.840.1.114414.1.7.23.3":   "Starfield",
+}
+
+// Adds the CA-specific EV policy OIDs in filename to the ones recognized by
+// ClassifyValidationLevel. Each line of the file is a dotted OID, optionally
+// followed by whitespace and the name of the CA. Lines starting with '#' are
+// ignored.
+func LoadEVPolicyOIDs(filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return &FileError{filename, err}
+	}
+	evPolicyOIDsLock.Lock()
+	defer evPolicyOIDsLock.Unlock()
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		evPolicyOIDs[fields[0]] = strings.Join(fields[1:], " ")
+	}
+	return nil
+}
+
+func isEVPolicyOID(oid asn1.ObjectIdentifier) bool {
+	if oid.Equal(oidPolicyEV) {
+		return true
+	}
+	evPolicyOIDsLock.RLock()
+	defer evPolicyOIDsLock.RUnlock()
+	_, ok := evPolicyOIDs[oid.String()]
+	return ok
+}
+
+// Returns the validation level cert claims through its certificate policies:
+// one of the VALIDATION_LEVEL_ constants. EV takes precedence over the other
+// levels if several are asserted.
+func ClassifyValidationLevel(cert *x509.Certificate) string {
+	level := VALIDATION_LEVEL_UNKNOWN
+	for _, oid := range cert.PolicyIdentifiers {
+		switch {
+		case isEVPolicyOID(oid):
+			return VALIDATION_LEVEL_EV
+		case oid.Equal(oidPolicyOV):
+			level = VALIDATION_LEVEL_OV
+		case oid.Equal(oidPolicyIV):
+			level = VALIDATION_LEVEL_IV
+		case oid.Equal(oidPolicyDV):
+			if level == VALIDATION_LEVEL_UNKNOWN {
+				level = VALIDATION_LEVEL_DV
+			}
+		}
+	}
+	return level
+}
+
+// Returns the dotted form of each of cert's policy OIDs.
+func policyOIDStrings(cert *x509.Certificate) []string {
+	var oids []string
+	for _, oid := range cert.PolicyIdentifiers {
+		oids = append(oids, oid.String())
+	}
+	return oids
+}
+
+func hasSubjectAttribute(name pkix.Name, oid asn1.ObjectIdentifier) bool {
+	for _, attribute := range name.Names {
+		if attribute.Type.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyCheck flags certs that claim the given validation level but whose
+// subject is inconsistent with it.
+type policyCheck struct {
+	checkInfo
+	level        string
+	inconsistent func(subject pkix.Name) bool
+}
+
+func (check policyCheck) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return ClassifyValidationLevel(cert) == check.level &&
+		check.inconsistent(cert.Subject)
+}
+
+// BR 7.1.6.1: DV certs must not contain organization or individual identity
+// information.
+func dvHasIdentity(subject pkix.Name) bool {
+	return len(subject.Organization) > 0 || len(subject.StreetAddress) > 0 ||
+		len(subject.Locality) > 0 || len(subject.Province) > 0 ||
+		len(subject.PostalCode) > 0 ||
+		hasSubjectAttribute(subject, oidAttributeGivenName) ||
+		hasSubjectAttribute(subject, oidAttributeSurname)
+}
+
+// BR 7.1.6.1: OV certs must contain the organization name, locality or
+// state/province, and country.
+func ovMissingOrganization(subject pkix.Name) bool {
+	return len(subject.Organization) == 0 || len(subject.Country) == 0 ||
+		(len(subject.Locality) == 0 && len(subject.Province) == 0)
+}
+
+// BR 7.1.6.1: IV certs must contain the individual's name (or a pseudonym)
+// and country.
+func ivMissingIndividual(subject pkix.Name) bool {
+	hasName := (hasSubjectAttribute(subject, oidAttributeGivenName) &&
+		hasSubjectAttribute(subject, oidAttributeSurname)) ||
+		hasSubjectAttribute(subject, oidAttributePseudonym)
+	return !hasName || len(subject.Country) == 0
+}
+
+// EV Guidelines 9.2.4: jurisdiction of incorporation.
+func evMissingJurisdiction(subject pkix.Name) bool {
+	return !hasSubjectAttribute(subject, oidAttributeJurisdictionCountryName)
+}
+
+// EV Guidelines 9.2.5: registration number.
+func evMissingSerialNumber(subject pkix.Name) bool {
+	return len(subject.SerialNumber) == 0
+}
+
+// EV Guidelines 9.2.3: business category.
+func evMissingBusinessCategory(subject pkix.Name) bool {
+	return !hasSubjectAttribute(subject, oidAttributeBusinessCategory)
+}
+
+func init() {
+	RegisterCheck(policyCheck{checkInfo{
+		DV_WITH_ORGANIZATION, "7.1.6.1", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_DV, dvHasIdentity})
+	RegisterCheck(policyCheck{checkInfo{
+		OV_MISSING_ORGANIZATION, "7.1.6.1", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_OV, ovMissingOrganization})
+	RegisterCheck(policyCheck{checkInfo{
+		IV_MISSING_INDIVIDUAL, "7.1.6.1", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_IV, ivMissingIndividual})
+	RegisterCheck(policyCheck{checkInfo{
+		EV_MISSING_JURISDICTION, "EV 9.2.4", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_EV, evMissingJurisdiction})
+	RegisterCheck(policyCheck{checkInfo{
+		EV_MISSING_SERIAL_NUMBER, "EV 9.2.5", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_EV, evMissingSerialNumber})
+	RegisterCheck(policyCheck{checkInfo{
+		EV_MISSING_BUSINESS_CATEGORY, "EV 9.2.3", SEVERITY_ERROR, time.Time{}},
+		VALIDATION_LEVEL_EV, evMissingBusinessCategory})
+}
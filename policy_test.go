@@ -0,0 +1,126 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClassifyValidationLevel(t *testing.T) {
+	cases := []struct {
+		policies []asn1.ObjectIdentifier
+		level    string
+	}{
+		{nil, VALIDATION_LEVEL_UNKNOWN},
+		{[]asn1.ObjectIdentifier{oidPolicyDV}, VALIDATION_LEVEL_DV},
+		{[]asn1.ObjectIdentifier{oidPolicyOV}, VALIDATION_LEVEL_OV},
+		{[]asn1.ObjectIdentifier{oidPolicyIV}, VALIDATION_LEVEL_IV},
+		{[]asn1.ObjectIdentifier{oidPolicyEV}, VALIDATION_LEVEL_EV},
+		{[]asn1.ObjectIdentifier{{2, 16, 840, 1, 114412, 2, 1}}, VALIDATION_LEVEL_EV},
+		{[]asn1.ObjectIdentifier{oidPolicyDV, oidPolicyOV}, VALIDATION_LEVEL_OV},
+	}
+	for _, c := range cases {
+		cert := &x509.Certificate{PolicyIdentifiers: c.policies}
+		if level := ClassifyValidationLevel(cert); level != c.level {
+			t.Errorf("%v: expected %s, got %s", c.policies, c.level, level)
+		}
+	}
+}
+
+func TestLoadEVPolicyOIDs(t *testing.T) {
+	f, err := ioutil.TempFile("", "ev_oids")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# test\n1.2.3.4.5\tExample CA\n")
+	f.Close()
+	cert := &x509.Certificate{
+		PolicyIdentifiers: []asn1.ObjectIdentifier{{1, 2, 3, 4, 5}},
+	}
+	if ClassifyValidationLevel(cert) == VALIDATION_LEVEL_EV {
+		t.Error("OID should not be EV before it is loaded")
+	}
+	if err := LoadEVPolicyOIDs(f.Name()); err != nil {
+		t.Fatal("could not load EV OIDs", err)
+	}
+	defer delete(evPolicyOIDs, "1.2.3.4.5")
+	if ClassifyValidationLevel(cert) != VALIDATION_LEVEL_EV {
+		t.Error("OID should be EV after it is loaded")
+	}
+}
+
+func TestPolicyConsistencyChecks(t *testing.T) {
+	cases := []struct {
+		policy   asn1.ObjectIdentifier
+		subject  pkix.Name
+		violated []string
+	}{
+		{oidPolicyDV, pkix.Name{CommonName: "test.example.com"}, nil},
+		{oidPolicyDV, pkix.Name{CommonName: "test.example.com",
+			Organization: []string{"Example Inc"}},
+			[]string{DV_WITH_ORGANIZATION}},
+		{oidPolicyOV, pkix.Name{CommonName: "test.example.com",
+			Organization: []string{"Example Inc"}, Locality: []string{"Springfield"},
+			Country: []string{"US"}}, nil},
+		{oidPolicyOV, pkix.Name{CommonName: "test.example.com"},
+			[]string{OV_MISSING_ORGANIZATION}},
+		{oidPolicyIV, pkix.Name{CommonName: "test.example.com"},
+			[]string{IV_MISSING_INDIVIDUAL}},
+		{oidPolicyEV, pkix.Name{CommonName: "test.example.com",
+			Organization: []string{"Example Inc"}, Country: []string{"US"},
+			SerialNumber: "1234",
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidAttributeJurisdictionCountryName, Value: "US"},
+				{Type: oidAttributeBusinessCategory, Value: "Private Organization"},
+			}}, nil},
+		{oidPolicyEV, pkix.Name{CommonName: "test.example.com",
+			Organization: []string{"Example Inc"}},
+			[]string{EV_MISSING_JURISDICTION, EV_MISSING_SERIAL_NUMBER,
+				EV_MISSING_BUSINESS_CATEGORY}},
+	}
+	policyChecks := []string{DV_WITH_ORGANIZATION, OV_MISSING_ORGANIZATION,
+		IV_MISSING_INDIVIDUAL, EV_MISSING_JURISDICTION, EV_MISSING_SERIAL_NUMBER,
+		EV_MISSING_BUSINESS_CATEGORY}
+	for i, c := range cases {
+		template := subscriberTemplate(time.Now())
+		template.Subject = c.subject
+		template.PolicyIdentifiers = []asn1.ObjectIdentifier{c.policy}
+		cert := makeCert(t, template)
+		summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+		for _, id := range policyChecks {
+			expected := false
+			for _, violated := range c.violated {
+				expected = expected || id == violated
+			}
+			if summary.Violations[id] != expected {
+				t.Errorf("case %d: %s expected %v", i, id, expected)
+			}
+		}
+	}
+}
+
+func TestIssuerReputationByValidationLevel(t *testing.T) {
+	issuer := NewIssuerReputation("honest-al", pkix.Name{CommonName: "Honest Al"}, 0)
+	issuer.Update(&CertSummary{ValidationLevel: VALIDATION_LEVEL_DV,
+		MaxReputation: -1, Violations: map[string]bool{KEY_TOO_SHORT: true}})
+	issuer.Update(&CertSummary{ValidationLevel: VALIDATION_LEVEL_EV,
+		MaxReputation: -1, Violations: map[string]bool{KEY_TOO_SHORT: false}})
+	issuer.Finish()
+	if issuer.Scores[KEY_TOO_SHORT].RawScore != 0.5 {
+		t.Error("Expected overall raw score of 0.5")
+	}
+	if issuer.ByValidationLevel[VALIDATION_LEVEL_DV].Scores[KEY_TOO_SHORT].RawScore != 0 {
+		t.Error("Expected DV raw score of 0")
+	}
+	if issuer.ByValidationLevel[VALIDATION_LEVEL_EV].Scores[KEY_TOO_SHORT].RawScore != 1 {
+		t.Error("Expected EV raw score of 1")
+	}
+	if issuer.ByValidationLevel[VALIDATION_LEVEL_EV].ByValidationLevel != nil {
+		t.Error("Validation level breakdowns shouldn't be nested")
+	}
+}
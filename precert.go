@@ -0,0 +1,292 @@
+package sunlight
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"github.com/monicachew/alexa"
+	"math/big"
+)
+
+const (
+	ENTRY_TYPE_X509    = "X509"
+	ENTRY_TYPE_PRECERT = "Precert"
+)
+
+// RFC 6962 3.1: the poison extension that makes a precertificate unusable,
+// and the extension final certificates carry their SCTs in.
+var (
+	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidExtensionSCTList  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	errNotTBSCertificate = errors.New("not a TBSCertificate")
+)
+
+// The parts of a TBSCertificate we need to take apart and put back together.
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	IssuerUniqueId     asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueId    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+type certificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+func parseTBSCertificate(tbs []byte) (*tbsCertificate, error) {
+	var parsed tbsCertificate
+	rest, err := asn1.Unmarshal(tbs, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errNotTBSCertificate
+	}
+	return &parsed, nil
+}
+
+// Parses the TBSCertificate of a precertificate log entry. The result has
+// no signature, but is otherwise a certificate that the checks can be run
+// on.
+func ParsePrecertificate(tbs []byte) (*x509.Certificate, error) {
+	parsed, err := parseTBSCertificate(tbs)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: parsed.SignatureAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(raw)
+}
+
+// Returns the hex-encoded SHA-256 hash of cert's TBSCertificate with the
+// poison and SCT list extensions removed. A final certificate and the
+// precertificate it was issued from should have the same hash.
+func PrecertTBSHash(cert *x509.Certificate) (string, error) {
+	parsed, err := parseTBSCertificate(cert.RawTBSCertificate)
+	if err != nil {
+		return "", err
+	}
+	var extensions []pkix.Extension
+	for _, extension := range parsed.Extensions {
+		if !extension.Id.Equal(oidExtensionCTPoison) &&
+			!extension.Id.Equal(oidExtensionSCTList) {
+			extensions = append(extensions, extension)
+		}
+	}
+	parsed.Raw = nil
+	parsed.Extensions = extensions
+	tbs, err := asn1.Marshal(*parsed)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(tbs)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Returns whether cert is a precertificate as issued by a CA, i.e. has the
+// poison extension. A log removes the poison from the TBSCertificate it logs
+// (RFC 6962 3.2), so this isn't true of those from ParsePrecertificate.
+func IsPrecertificate(cert *x509.Certificate) bool {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oidExtensionCTPoison) {
+			return true
+		}
+	}
+	return false
+}
+
+// As CalculateCertSummary, for a precertificate from ParsePrecertificate.
+func CalculatePrecertSummary(precert *x509.Certificate, timestamp uint64,
+	ranker *alexa.AlexaRank, certChain []*x509.Certificate,
+	rootPrograms []RootProgram) (*CertSummary, error) {
+	summary, err := CalculateCertSummary(precert, timestamp, ranker, certChain,
+		rootPrograms)
+	if summary == nil {
+		return nil, err
+	}
+	summary.EntryType = ENTRY_TYPE_PRECERT
+	// Precerts are what SCTs are issued for, so they never have any.
+	summary.Violations[INSUFFICIENT_SCTS] = false
+	return summary, err
+}
+
+// A final certificate whose TBSCertificate differs from that of the
+// precertificate with the same issuer and serial number by more than the
+// poison and SCT list extensions. The issuer is identified by its IssuerKey,
+// so that CAs with the same name aren't confused.
+type PrecertMismatch struct {
+	IssuerKey         string
+	SerialNumber      string
+	Sha256Fingerprint string
+	Timestamp         uint64
+}
+
+// Where the PrecertTBSHashes of the certificates PrecertPairs has seen are
+// kept, so that they can be looked up without holding every one in memory
+// (e.g. a DB table indexed by issuer and serial number).
+type PrecertHashStore interface {
+	// Returns the PrecertTBSHash of the first precertificate and of the first
+	// final certificate recorded for the issuer with the key and the serial
+	// number (in hex), or "" for either that hasn't been, and the details of
+	// that final certificate.
+	Hashes(issuerKey, serialNumber string) (precertHash string, finalHash string,
+		final PrecertMismatch, err error)
+	// Records the PrecertTBSHash of a precertificate.
+	AddPrecertHash(issuerKey, serialNumber, hash string) error
+	// Records the PrecertTBSHash of the final certificate described by final.
+	AddFinalHash(hash string, final PrecertMismatch) error
+}
+
+type precertPair struct {
+	precertHash string
+	finalHash   string
+	// Details of the final certificate, for reporting a mismatch
+	final PrecertMismatch
+}
+
+// A PrecertHashStore in memory, for when there are few enough certificates.
+type MemoryPrecertHashStore struct {
+	pairs map[string]*precertPair
+}
+
+func NewMemoryPrecertHashStore() *MemoryPrecertHashStore {
+	return &MemoryPrecertHashStore{make(map[string]*precertPair)}
+}
+
+func (store *MemoryPrecertHashStore) pairFor(issuerKey, serialNumber string) *precertPair {
+	key := issuerKey + ":" + serialNumber
+	if store.pairs[key] == nil {
+		store.pairs[key] = new(precertPair)
+	}
+	return store.pairs[key]
+}
+
+func (store *MemoryPrecertHashStore) Hashes(issuerKey, serialNumber string) (string,
+	string, PrecertMismatch, error) {
+	pair := store.pairs[issuerKey+":"+serialNumber]
+	if pair == nil {
+		return "", "", PrecertMismatch{}, nil
+	}
+	return pair.precertHash, pair.finalHash, pair.final, nil
+}
+
+func (store *MemoryPrecertHashStore) AddPrecertHash(issuerKey, serialNumber,
+	hash string) error {
+	pair := store.pairFor(issuerKey, serialNumber)
+	if len(pair.precertHash) == 0 {
+		pair.precertHash = hash
+	}
+	return nil
+}
+
+func (store *MemoryPrecertHashStore) AddFinalHash(hash string, final PrecertMismatch) error {
+	pair := store.pairFor(final.IssuerKey, final.SerialNumber)
+	if len(pair.finalHash) == 0 {
+		pair.finalHash = hash
+		pair.final = final
+	}
+	return nil
+}
+
+// Pairs precertificates with their final certificates, by issuer and serial
+// number, and keeps track of the pairs whose TBSCertificates don't match.
+// Only the first precertificate and final certificate recorded in the store
+// for each issuer and serial number are compared, when the second of them is
+// added.
+type PrecertPairs struct {
+	// Count of precertificates whose final certificate has been seen
+	PairedCount uint64
+	// The mismatches found since the PrecertPairs was made
+	Mismatches []PrecertMismatch
+	store      PrecertHashStore
+}
+
+func NewPrecertPairs(store PrecertHashStore) *PrecertPairs {
+	pairs := new(PrecertPairs)
+	pairs.store = store
+	return pairs
+}
+
+// Records a precertificate from the issuer identified by issuerKey (see
+// IssuerKey). See AddFinal.
+func (pairs *PrecertPairs) AddPrecert(precert *x509.Certificate, issuerKey string) error {
+	hash, err := PrecertTBSHash(precert)
+	if err != nil {
+		return err
+	}
+	return pairs.AddPrecertHash(issuerKey, precert.SerialNumber.Text(16), hash)
+}
+
+// As AddPrecert, for a precertificate from the issuer identified by
+// issuerKey with the given serial number (in hex) and PrecertTBSHash.
+func (pairs *PrecertPairs) AddPrecertHash(issuerKey, serialNumber, hash string) error {
+	precertHash, finalHash, final, err := pairs.store.Hashes(issuerKey, serialNumber)
+	if err == nil {
+		err = pairs.store.AddPrecertHash(issuerKey, serialNumber, hash)
+	}
+	if err != nil {
+		return err
+	}
+	if len(precertHash) == 0 && len(finalHash) > 0 {
+		pairs.compare(hash, finalHash, final)
+	}
+	return nil
+}
+
+// Records a final certificate from the issuer identified by issuerKey with
+// the given fingerprint, logged at timestamp. If its precertificate has been
+// seen (or is seen later) and doesn't match, a PrecertMismatch is added.
+func (pairs *PrecertPairs) AddFinal(cert *x509.Certificate, issuerKey string,
+	fingerprint string, timestamp uint64) error {
+	hash, err := PrecertTBSHash(cert)
+	if err != nil {
+		return err
+	}
+	return pairs.AddFinalHash(hash, PrecertMismatch{
+		IssuerKey:         issuerKey,
+		SerialNumber:      cert.SerialNumber.Text(16),
+		Sha256Fingerprint: fingerprint,
+		Timestamp:         timestamp,
+	})
+}
+
+// As AddFinal, for the final certificate described by final with the given
+// PrecertTBSHash.
+func (pairs *PrecertPairs) AddFinalHash(hash string, final PrecertMismatch) error {
+	precertHash, finalHash, _, err := pairs.store.Hashes(final.IssuerKey,
+		final.SerialNumber)
+	if err == nil {
+		err = pairs.store.AddFinalHash(hash, final)
+	}
+	if err != nil {
+		return err
+	}
+	if len(finalHash) == 0 && len(precertHash) > 0 {
+		pairs.compare(precertHash, hash, final)
+	}
+	return nil
+}
+
+func (pairs *PrecertPairs) compare(precertHash, finalHash string, final PrecertMismatch) {
+	pairs.PairedCount += 1
+	if precertHash != finalHash {
+		pairs.Mismatches = append(pairs.Mismatches, final)
+	}
+}
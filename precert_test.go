@@ -0,0 +1,166 @@
+package sunlight
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+)
+
+// Returns the TBSCertificate a log puts in the entry for precert: precert's,
+// with the poison extension removed (RFC 6962 3.2).
+func logEntryTBS(t *testing.T, precert *x509.Certificate) []byte {
+	parsed, err := parseTBSCertificate(precert.RawTBSCertificate)
+	if err != nil {
+		t.Fatal("could not parse TBSCertificate", err)
+	}
+	var extensions []pkix.Extension
+	for _, extension := range parsed.Extensions {
+		if !extension.Id.Equal(oidExtensionCTPoison) {
+			extensions = append(extensions, extension)
+		}
+	}
+	parsed.Raw = nil
+	parsed.Extensions = extensions
+	tbs, err := asn1.Marshal(*parsed)
+	if err != nil {
+		t.Fatal("could not marshal TBSCertificate", err)
+	}
+	return tbs
+}
+
+// Returns the precertificate log entry TBS for template, and the final
+// certificate issued from it with an SCT list extension added.
+func makePrecertAndFinal(t *testing.T, template *x509.Certificate) ([]byte,
+	*x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: oidExtensionCTPoison, Critical: true, Value: []byte{0x05, 0x00}},
+	}
+	precert := makeCertWithKey(t, template, &key.PublicKey, key)
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: oidExtensionSCTList, Value: []byte{0x04, 0x02, 0x00, 0x00}},
+	}
+	return logEntryTBS(t, precert),
+		makeCertWithKey(t, template, &key.PublicKey, key)
+}
+
+// Returns the precertificate log entry TBS for template issued by parent
+// (signed with parentKey), and the precertificate itself.
+func makePrecert(t *testing.T, template *x509.Certificate, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) ([]byte, *x509.Certificate) {
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: oidExtensionCTPoison, Critical: true, Value: []byte{0x05, 0x00}},
+	}
+	precert, _ := issueCert(t, template, parent, parentKey)
+	return logEntryTBS(t, precert), precert
+}
+
+func TestParsePrecertificate(t *testing.T) {
+	tbs, _ := makePrecertAndFinal(t, subscriberTemplate(time.Now()))
+	precert, err := ParsePrecertificate(tbs)
+	if err != nil {
+		t.Fatal("could not parse precertificate", err)
+	}
+	if precert.Subject.CommonName != "test.example.com" {
+		t.Errorf("Unexpected subject %v", precert.Subject)
+	}
+	summary, err := CalculatePrecertSummary(precert, 0, nil, nil, nil)
+	if err != nil {
+		t.Fatal("could not summarize precertificate", err)
+	}
+	if summary.EntryType != ENTRY_TYPE_PRECERT {
+		t.Errorf("Expected entry type %s, got %s", ENTRY_TYPE_PRECERT,
+			summary.EntryType)
+	}
+	if _, err := ParsePrecertificate([]byte{0x30, 0x00}); err == nil {
+		t.Error("Expected an error parsing an empty TBSCertificate")
+	}
+}
+
+func TestPrecertPairs(t *testing.T) {
+	store := NewMemoryPrecertHashStore()
+	pairs := NewPrecertPairs(store)
+
+	template := subscriberTemplate(time.Now())
+	tbs, final := makePrecertAndFinal(t, template)
+	precert, err := ParsePrecertificate(tbs)
+	if err != nil {
+		t.Fatal("could not parse precertificate", err)
+	}
+	if IsPrecertificate(final) {
+		t.Error("Final certificate isn't a precertificate")
+	}
+	if err := pairs.AddPrecert(precert, "honest-al"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pairs.AddFinal(final, "honest-al", "matching", 1); err != nil {
+		t.Fatal(err)
+	}
+	// Seeing the final certificate again shouldn't count as another pair.
+	pairs.AddFinal(final, "honest-al", "matching", 2)
+
+	// Final certificate seen first, with different SANs than the precert.
+	template = subscriberTemplate(time.Now())
+	template.SerialNumber.SetInt64(1234567890123)
+	tbs, _ = makePrecertAndFinal(t, template)
+	template.DNSNames = append(template.DNSNames, "other.example.com")
+	_, final = makePrecertAndFinal(t, template)
+	precert, err = ParsePrecertificate(tbs)
+	if err != nil {
+		t.Fatal("could not parse precertificate", err)
+	}
+	pairs.AddFinal(final, "honest-al", "mismatched", 3)
+	pairs.AddPrecert(precert, "honest-al")
+	// Another CA with the same name and serial number
+	pairs.AddPrecert(precert, "impostor")
+
+	if pairs.PairedCount != 2 {
+		t.Errorf("Expected 2 pairs, got %d", pairs.PairedCount)
+	}
+	if len(pairs.Mismatches) != 1 ||
+		pairs.Mismatches[0].Sha256Fingerprint != "mismatched" ||
+		pairs.Mismatches[0].Timestamp != 3 {
+		t.Errorf("Unexpected mismatches %v", pairs.Mismatches)
+	}
+
+	// Pairs made later with the same store (as in a later run) find the
+	// certificates seen before by looking them up in the store.
+	resumed := NewPrecertPairs(store)
+	if err := resumed.AddFinal(final, "impostor", "impostor", 4); err != nil {
+		t.Fatal(err)
+	}
+	resumed.AddPrecert(precert, "honest-al")
+	if resumed.PairedCount != 1 || len(resumed.Mismatches) != 1 ||
+		resumed.Mismatches[0].Sha256Fingerprint != "impostor" {
+		t.Errorf("Expected only the impostor's pair, got %d %v", resumed.PairedCount,
+			resumed.Mismatches)
+	}
+}
+
+func TestPrecertPairsFromHashes(t *testing.T) {
+	pairs := NewPrecertPairs(NewMemoryPrecertHashStore())
+	final := PrecertMismatch{IssuerKey: "honest-al", SerialNumber: "1f",
+		Sha256Fingerprint: "final", Timestamp: 4}
+	pairs.AddFinalHash("aaaa", final)
+	pairs.AddPrecertHash("honest-al", "20", "aaaa")
+	if pairs.PairedCount != 0 {
+		t.Error("Certificates with different serial numbers shouldn't pair")
+	}
+	pairs.AddPrecertHash("other-issuer", "1f", "aaaa")
+	if pairs.PairedCount != 0 {
+		t.Error("Certificates from different issuers shouldn't pair")
+	}
+	pairs.AddPrecertHash("honest-al", "1f", "bbbb")
+	if pairs.PairedCount != 1 || len(pairs.Mismatches) != 1 ||
+		pairs.Mismatches[0] != final {
+		t.Errorf("Unexpected mismatches %v", pairs.Mismatches)
+	}
+}
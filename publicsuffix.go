@@ -0,0 +1,117 @@
+package sunlight
+
+import (
+	"code.google.com/p/go.net/idna"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// A parsed copy of the ICANN section of the Public Suffix List.
+type publicSuffixList struct {
+	// Normal rules, e.g. "co.uk"
+	rules map[string]bool
+	// Wildcard rules, keyed by what follows the "*.", e.g. "ck" for "*.ck"
+	wildcards map[string]bool
+	// Exception rules, keyed by what follows the "!", e.g. "www.ck"
+	exceptions map[string]bool
+	// The top-level domain of every rule
+	tlds map[string]bool
+}
+
+var publicSuffixesLock sync.RWMutex
+var publicSuffixes *publicSuffixList
+
+func init() {
+	publicSuffixes = parsePublicSuffixList(bundledPublicSuffixList)
+}
+
+func parsePublicSuffixList(contents string) *publicSuffixList {
+	list := &publicSuffixList{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+		tlds:       make(map[string]bool),
+	}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		// Private domains (blogspot.com and the like) are registrable by
+		// anyone, so they don't count as public suffixes for our purposes.
+		if strings.Contains(line, "===BEGIN PRIVATE DOMAINS===") {
+			break
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+		// Rules end at the first whitespace.
+		line = strings.Fields(line)[0]
+		rules := list.rules
+		if strings.HasPrefix(line, "*.") {
+			rules = list.wildcards
+			line = line[2:]
+		} else if strings.HasPrefix(line, "!") {
+			rules = list.exceptions
+			line = line[1:]
+		}
+		ascii, err := idna.ToASCII(line)
+		if err != nil {
+			continue
+		}
+		ascii = strings.ToLower(ascii)
+		rules[ascii] = true
+		list.tlds[ascii[strings.LastIndex(ascii, ".")+1:]] = true
+	}
+	return list
+}
+
+// Replaces the bundled Public Suffix List with the one in filename (in the
+// format of https://publicsuffix.org/list/public_suffix_list.dat). Only the
+// ICANN section of the file is used.
+func LoadPublicSuffixList(filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return &FileError{filename, err}
+	}
+	list := parsePublicSuffixList(string(contents))
+	publicSuffixesLock.Lock()
+	defer publicSuffixesLock.Unlock()
+	publicSuffixes = list
+	return nil
+}
+
+func currentPublicSuffixList() *publicSuffixList {
+	publicSuffixesLock.RLock()
+	defer publicSuffixesLock.RUnlock()
+	return publicSuffixes
+}
+
+// Lower-cases name and strips any trailing dot.
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Returns true if name (in ASCII form) is itself a public suffix, e.g. "com"
+// or "co.uk". Unknown single-label names are public suffixes by the list's
+// implicit "*" rule.
+func IsPublicSuffix(name string) bool {
+	name = normalizeDNSName(name)
+	list := currentPublicSuffixList()
+	if list.exceptions[name] {
+		return false
+	}
+	if list.rules[name] {
+		return true
+	}
+	dot := strings.Index(name, ".")
+	if dot == -1 {
+		return len(name) > 0
+	}
+	return list.wildcards[name[dot+1:]]
+}
+
+// Returns true if the last label of name (in ASCII form) is a top-level
+// domain delegated by IANA.
+func HasPublicTLD(name string) bool {
+	name = normalizeDNSName(name)
+	return currentPublicSuffixList().tlds[name[strings.LastIndex(name, ".")+1:]]
+}
@@ -0,0 +1,49 @@
+package sunlight
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestIsPublicSuffix(t *testing.T) {
+	suffixes := []string{"com", "co.uk", "anything.ck", "unknowntld"}
+	notSuffixes := []string{"example.com", "www.ck", "example.co.uk"}
+	for _, name := range suffixes {
+		if !IsPublicSuffix(name) {
+			t.Errorf("%s should be a public suffix", name)
+		}
+	}
+	for _, name := range notSuffixes {
+		if IsPublicSuffix(name) {
+			t.Errorf("%s should not be a public suffix", name)
+		}
+	}
+}
+
+func TestLoadPublicSuffixList(t *testing.T) {
+	f, err := ioutil.TempFile("", "public_suffix_list.dat")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("// ===BEGIN ICANN DOMAINS===\ncom\nexample\n公司.cn\n" +
+		"// ===END ICANN DOMAINS===\n// ===BEGIN PRIVATE DOMAINS===\n" +
+		"blogspot.com\n")
+	f.Close()
+
+	saved := currentPublicSuffixList()
+	defer func() { publicSuffixes = saved }()
+	if err := LoadPublicSuffixList(f.Name()); err != nil {
+		t.Fatal("could not load public suffix list", err)
+	}
+	if !HasPublicTLD("foo.example") || HasPublicTLD("foo.uk") {
+		t.Error("TLDs should come from the loaded list")
+	}
+	if !IsPublicSuffix("xn--55qx5d.cn") {
+		t.Error("Unicode rules should be converted to punycode")
+	}
+	if IsPublicSuffix("blogspot.com") {
+		t.Error("Private domains should be ignored")
+	}
+}
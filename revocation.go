@@ -0,0 +1,70 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Returns true if rawURL is an absolute URL with a scheme and a host.
+func isWellFormedURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return len(parsed.Scheme) > 0 && len(parsed.Host) > 0 &&
+		strings.TrimSpace(rawURL) == rawURL
+}
+
+func hasHTTPURL(urls []string) bool {
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err == nil && strings.EqualFold(parsed.Scheme, "http") && len(parsed.Host) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type missingRevocationPointer struct{ checkInfo }
+
+// BR 7.1.2.3 (b), (c): subscriber certs must have an OCSP responder URL or a
+// CRL distribution point, and relying parties can only be expected to fetch
+// these over plain HTTP.
+func (missingRevocationPointer) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if isCACert(cert) {
+		return false
+	}
+	return !hasHTTPURL(cert.OCSPServer) && !hasHTTPURL(cert.CRLDistributionPoints)
+}
+
+type missingIssuingCertificateURL struct{ checkInfo }
+
+// BR 7.1.2.3 (c): subscriber certs should have a caIssuers URL.
+func (missingIssuingCertificateURL) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return !isCACert(cert) && len(cert.IssuingCertificateURL) == 0
+}
+
+type malformedRevocationURL struct{ checkInfo }
+
+func (malformedRevocationURL) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, urls := range [][]string{cert.OCSPServer, cert.CRLDistributionPoints,
+		cert.IssuingCertificateURL} {
+		for _, rawURL := range urls {
+			if !isWellFormedURL(rawURL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func init() {
+	RegisterCheck(missingRevocationPointer{checkInfo{
+		MISSING_REVOCATION_POINTER, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(missingIssuingCertificateURL{checkInfo{
+		MISSING_ISSUING_CERTIFICATE_URL, "7.1.2.3", SEVERITY_WARNING, time.Time{}}})
+	RegisterCheck(malformedRevocationURL{checkInfo{
+		MALFORMED_REVOCATION_URL, "7.1.2.3", SEVERITY_ERROR, time.Time{}}})
+}
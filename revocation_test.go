@@ -0,0 +1,71 @@
+package sunlight
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocationChecks(t *testing.T) {
+	cases := []struct {
+		ocsp      []string
+		crl       []string
+		caIssuers []string
+		violated  []string
+	}{
+		{[]string{"http://ocsp.example.com"}, nil,
+			[]string{"http://ca.example.com/ca.crt"}, nil},
+		{nil, []string{"http://crl.example.com/ca.crl"},
+			[]string{"http://ca.example.com/ca.crt"}, nil},
+		{nil, nil, []string{"http://ca.example.com/ca.crt"},
+			[]string{MISSING_REVOCATION_POINTER}},
+		{[]string{"https://ocsp.example.com"}, nil,
+			[]string{"http://ca.example.com/ca.crt"},
+			[]string{MISSING_REVOCATION_POINTER}},
+		{[]string{"http://ocsp.example.com"}, nil, nil,
+			[]string{MISSING_ISSUING_CERTIFICATE_URL}},
+		{[]string{"http://ocsp.example.com"}, []string{"crl.example.com/ca.crl"},
+			[]string{"http://ca.example.com/ca.crt"},
+			[]string{MALFORMED_REVOCATION_URL}},
+	}
+	revocationChecks := []string{MISSING_REVOCATION_POINTER,
+		MISSING_ISSUING_CERTIFICATE_URL, MALFORMED_REVOCATION_URL}
+	for i, c := range cases {
+		template := subscriberTemplate(time.Now())
+		template.OCSPServer = c.ocsp
+		template.CRLDistributionPoints = c.crl
+		template.IssuingCertificateURL = c.caIssuers
+		cert := makeCert(t, template)
+		summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+		for _, id := range revocationChecks {
+			expected := false
+			for _, violated := range c.violated {
+				expected = expected || id == violated
+			}
+			if summary.Violations[id] != expected {
+				t.Errorf("case %d: %s expected %v", i, id, expected)
+			}
+		}
+		if len(summary.OCSPServers) != len(c.ocsp) ||
+			len(summary.CRLDistributionPoints) != len(c.crl) ||
+			len(summary.IssuingCertificateURLs) != len(c.caIssuers) {
+			t.Errorf("case %d: URLs should be recorded in the summary", i)
+		}
+	}
+}
+
+func TestIssuerReputationRevocationEndpoints(t *testing.T) {
+	template := subscriberTemplate(time.Now())
+	template.OCSPServer = []string{"http://ocsp.example.com"}
+	template.CRLDistributionPoints = []string{"http://crl.example.com/ca.crl"}
+	cert := makeCert(t, template)
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	issuer := NewIssuerReputation(IssuerKey(cert, nil), cert.Issuer, 0)
+	issuer.Update(summary)
+	issuer.Update(summary)
+	if issuer.OCSPServers["http://ocsp.example.com"] != 2 {
+		t.Error("Expected OCSP server to be counted twice")
+	}
+	if issuer.CRLDistributionPoints["http://crl.example.com/ca.crl"] != 2 {
+		t.Error("Expected CRL distribution point to be counted twice")
+	}
+}
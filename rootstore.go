@@ -0,0 +1,473 @@
+package sunlight
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The names of the major root programs, for RootProgram.Name. Any other
+// name works too.
+const (
+	ROOT_PROGRAM_MOZILLA   = "Mozilla"
+	ROOT_PROGRAM_MICROSOFT = "Microsoft"
+	ROOT_PROGRAM_APPLE     = "Apple"
+	ROOT_PROGRAM_CHROME    = "Chrome"
+)
+
+// A root certificate in a root store, with what the store trusts it for.
+type Root struct {
+	Cert *x509.Certificate
+	// The label or name the store gives the root
+	Name string
+	// The CA that owns the root, if the store says
+	Owner    string
+	SPKIHash string
+	// Whether the root is trusted to issue TLS server and S/MIME certificates
+	Websites bool
+	Email    bool
+	// Certificates issued after these dates aren't trusted, if they're set
+	WebsitesDistrustAfter time.Time
+	EmailDistrustAfter    time.Time
+}
+
+// A set of root certificates, e.g. the roots in Mozilla's root program.
+type RootStore struct {
+	roots         []*Root
+	byFingerprint map[string]*Root
+	bySPKIHash    map[string][]*Root
+	bySubject     map[string][]*Root
+	// Why each certificate in the file that isn't in the store was skipped
+	skipped []error
+}
+
+// A root program and the roots in its store.
+type RootProgram struct {
+	Name  string
+	Roots *RootStore
+}
+
+// Returns the base64 sha256 hash of cert's SubjectPublicKeyInfo, which
+// identifies its key whatever name it's issued to.
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func NewRootStore() *RootStore {
+	return &RootStore{
+		byFingerprint: make(map[string]*Root),
+		bySPKIHash:    make(map[string][]*Root),
+		bySubject:     make(map[string][]*Root),
+	}
+}
+
+// Adds root to the store, unless its certificate is already there. Fills in
+// root.SPKIHash.
+func (store *RootStore) Add(root *Root) {
+	fingerprint := Sha256Fingerprint(root.Cert)
+	if store.byFingerprint[fingerprint] != nil {
+		return
+	}
+	root.SPKIHash = SPKIHash(root.Cert)
+	store.roots = append(store.roots, root)
+	store.byFingerprint[fingerprint] = root
+	store.bySPKIHash[root.SPKIHash] = append(store.bySPKIHash[root.SPKIHash], root)
+	subject := string(root.Cert.RawSubject)
+	store.bySubject[subject] = append(store.bySubject[subject], root)
+}
+
+// Returns the roots in the order they were added.
+func (store *RootStore) Roots() []*Root {
+	if store == nil {
+		return nil
+	}
+	return store.roots
+}
+
+func (store *RootStore) Len() int {
+	return len(store.Roots())
+}
+
+// Returns the errors for the certificates in the store's file that were
+// skipped because they couldn't be read, so that one bad root doesn't lose
+// the rest of the store.
+func (store *RootStore) Skipped() []error {
+	if store == nil {
+		return nil
+	}
+	return store.skipped
+}
+
+// Returns the roots with the given SPKIHash (several certificates can share
+// a key).
+func (store *RootStore) BySPKIHash(hash string) []*Root {
+	if store == nil {
+		return nil
+	}
+	return store.bySPKIHash[hash]
+}
+
+// Returns the roots that could have issued cert: those whose subject is
+// cert's issuer and, where both certificates say, whose key identifier is
+// cert's authority key identifier.
+func (store *RootStore) IssuersOf(cert *x509.Certificate) []*Root {
+	if store == nil {
+		return nil
+	}
+	var issuers []*Root
+	for _, root := range store.bySubject[string(cert.RawIssuer)] {
+		if len(cert.AuthorityKeyId) > 0 && len(root.Cert.SubjectKeyId) > 0 &&
+			!bytes.Equal(cert.AuthorityKeyId, root.Cert.SubjectKeyId) {
+			continue
+		}
+		issuers = append(issuers, root)
+	}
+	return issuers
+}
+
+// Returns whether root is trusted to issue TLS server certificates with the
+// given notBefore.
+func (root *Root) TrustedForWebsites(notBefore time.Time) bool {
+	return root.Websites &&
+		(root.WebsitesDistrustAfter.IsZero() || !notBefore.After(root.WebsitesDistrustAfter))
+}
+
+// As TrustedForWebsites, for S/MIME certificates.
+func (root *Root) TrustedForEmail(notBefore time.Time) bool {
+	return root.Email &&
+		(root.EmailDistrustAfter.IsZero() || !notBefore.After(root.EmailDistrustAfter))
+}
+
+// Returns the roots in filename, which can be an NSS certdata.txt, a CCADB
+// CSV export (recognized by its PEM Info column) or a PEM bundle.
+func LoadRootStore(filename string) (*RootStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{filename, err}
+	}
+	header := data
+	if end := bytes.IndexByte(data, '\n'); end >= 0 {
+		header = data[:end]
+	}
+	var store *RootStore
+	switch {
+	case bytes.Contains(data, []byte("CKA_CLASS")):
+		store, err = parseNSSCertdata(data)
+	case bytes.Contains(header, []byte("PEM Info")):
+		store, err = parseCCADBCSV(data)
+	default:
+		store, err = parsePEMRootBundle(data)
+	}
+	if err != nil {
+		return nil, &ParseError{filename, err}
+	}
+	return store, nil
+}
+
+// Returns the roots in an NSS certdata.txt, e.g. Mozilla's from
+// https://hg.mozilla.org/mozilla-central/raw-file/tip/security/nss/lib/ckfw/builtins/certdata.txt
+func LoadNSSCertdata(filename string) (*RootStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{filename, err}
+	}
+	store, err := parseNSSCertdata(data)
+	if err != nil {
+		return nil, &ParseError{filename, err}
+	}
+	return store, nil
+}
+
+// Returns the roots in a PEM bundle, e.g. a system's CA file. A bundle
+// doesn't say what its roots are trusted for, so they're all taken to be
+// trusted for websites only.
+func LoadPEMRootBundle(filename string) (*RootStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{filename, err}
+	}
+	store, err := parsePEMRootBundle(data)
+	if err != nil {
+		return nil, &ParseError{filename, err}
+	}
+	return store, nil
+}
+
+// Returns the roots in a CCADB CSV export with PEM, e.g. Mozilla's included
+// CA certificate report from
+// https://ccadb.my.salesforce-sites.com/mozilla/IncludedCACertificateReportPEMCSV
+func LoadCCADBCSV(filename string) (*RootStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{filename, err}
+	}
+	store, err := parseCCADBCSV(data)
+	if err != nil {
+		return nil, &ParseError{filename, err}
+	}
+	return store, nil
+}
+
+func parsePEMRootBundle(data []byte) (*RootStore, error) {
+	store := NewRootStore()
+	// Certificates are numbered from 1 in the order they're in the bundle.
+	count := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		count += 1
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			store.skipped = append(store.skipped,
+				&ParseError{fmt.Sprintf("certificate %d", count), err})
+			continue
+		}
+		store.Add(&Root{Cert: cert, Name: DistinguishedNameToString(cert.Subject),
+			Websites: true})
+	}
+	if store.Len() == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	return store, nil
+}
+
+// One attribute of a certdata.txt object: its type (e.g. CK_BBOOL or
+// MULTILINE_OCTAL) and value.
+type nssAttribute struct {
+	Type  string
+	Value string
+	Bytes []byte
+}
+
+// Returns the objects in a certdata.txt, each a map of attribute name (e.g.
+// CKA_CLASS) to attribute. Each object starts at its CKA_CLASS.
+func parseNSSObjects(data []byte) ([]map[string]nssAttribute, error) {
+	var objects []map[string]nssAttribute
+	var object map[string]nssAttribute
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "CKA_") {
+			// e.g. BEGINDATA
+			continue
+		}
+		if fields[0] == "CKA_CLASS" {
+			object = make(map[string]nssAttribute)
+			objects = append(objects, object)
+		}
+		if object == nil {
+			return nil, fmt.Errorf("line %d: attribute outside an object", lineNumber)
+		}
+		attribute := nssAttribute{Type: fields[1]}
+		if len(fields) == 3 {
+			attribute.Value = fields[2]
+		}
+		if attribute.Type == "MULTILINE_OCTAL" {
+			for {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated %s", lineNumber, fields[0])
+				}
+				lineNumber += 1
+				octal := strings.TrimSpace(scanner.Text())
+				if octal == "END" {
+					break
+				}
+				decoded, err := decodeOctal(octal)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+				}
+				attribute.Bytes = append(attribute.Bytes, decoded...)
+			}
+		}
+		object[fields[0]] = attribute
+	}
+	return objects, scanner.Err()
+}
+
+// Decodes a line of certdata.txt octal escapes, e.g. "\060\202".
+func decodeOctal(line string) ([]byte, error) {
+	var decoded []byte
+	for _, escape := range strings.Split(line, "\\")[1:] {
+		value, err := strconv.ParseUint(escape, 8, 8)
+		if err != nil || len(escape) != 3 {
+			return nil, fmt.Errorf("bad octal escape \\%s", escape)
+		}
+		decoded = append(decoded, byte(value))
+	}
+	return decoded, nil
+}
+
+// Returns the time in a CKA_NSS_*_DISTRUST_AFTER attribute, which is either
+// CK_BBOOL CK_FALSE or a UTCTime.
+func nssDistrustAfter(attribute nssAttribute) (time.Time, error) {
+	if attribute.Type != "MULTILINE_OCTAL" {
+		return time.Time{}, nil
+	}
+	return time.Parse("060102150405Z", string(attribute.Bytes))
+}
+
+func parseNSSCertdata(data []byte) (*RootStore, error) {
+	objects, err := parseNSSObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	// Trust objects refer to their certificate by its sha1 hash.
+	trust := make(map[string]map[string]nssAttribute)
+	for _, object := range objects {
+		if object["CKA_CLASS"].Value == "CKO_NSS_TRUST" {
+			trust[string(object["CKA_CERT_SHA1_HASH"].Bytes)] = object
+		}
+	}
+	store := NewRootStore()
+	for _, object := range objects {
+		if object["CKA_CLASS"].Value != "CKO_CERTIFICATE" {
+			continue
+		}
+		label := strings.Trim(object["CKA_LABEL"].Value, "\"")
+		what := fmt.Sprintf("certificate %q", label)
+		cert, err := x509.ParseCertificate(object["CKA_VALUE"].Bytes)
+		if err != nil {
+			store.skipped = append(store.skipped, &ParseError{what, err})
+			continue
+		}
+		root := &Root{Cert: cert, Name: label}
+		if root.WebsitesDistrustAfter, err =
+			nssDistrustAfter(object["CKA_NSS_SERVER_DISTRUST_AFTER"]); err == nil {
+			root.EmailDistrustAfter, err =
+				nssDistrustAfter(object["CKA_NSS_EMAIL_DISTRUST_AFTER"])
+		}
+		if err != nil {
+			store.skipped = append(store.skipped, &ParseError{what, err})
+			continue
+		}
+		hash := sha1.Sum(cert.Raw)
+		if certTrust := trust[string(hash[:])]; certTrust != nil {
+			root.Websites = certTrust["CKA_TRUST_SERVER_AUTH"].Value == "CKT_NSS_TRUSTED_DELEGATOR"
+			root.Email = certTrust["CKA_TRUST_EMAIL_PROTECTION"].Value == "CKT_NSS_TRUSTED_DELEGATOR"
+		}
+		store.Add(root)
+	}
+	if store.Len() == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	return store, nil
+}
+
+// Returns the date in a CCADB distrust-after column, or the zero time if
+// it's empty.
+func ccadbDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006.01.02", "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", value)
+}
+
+func parseCCADBCSV(data []byte) (*RootStore, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	pemColumn, ok := columns["PEM Info"]
+	if !ok {
+		return nil, fmt.Errorf("no PEM Info column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	// Returns the root in record, or why it can't be read.
+	parseRecord := func(record []string) (*Root, error) {
+		if pemColumn >= len(record) {
+			return nil, fmt.Errorf("no PEM")
+		}
+		block, _ := pem.Decode([]byte(strings.Trim(record[pemColumn], "'")))
+		if block == nil {
+			return nil, fmt.Errorf("no PEM")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		root := &Root{Cert: cert, Owner: field(record, "Owner"),
+			Name: field(record, "Common Name or Certificate Name")}
+		if len(root.Name) == 0 {
+			root.Name = DistinguishedNameToString(cert.Subject)
+		}
+		if fingerprint := field(record, "SHA-256 Fingerprint"); len(fingerprint) > 0 {
+			hash := sha256.Sum256(cert.Raw)
+			if !strings.EqualFold(fingerprint, hex.EncodeToString(hash[:])) {
+				return nil, fmt.Errorf("PEM doesn't match fingerprint")
+			}
+		}
+		for _, bit := range strings.Split(field(record, "Trust Bits"), ";") {
+			switch strings.TrimSpace(bit) {
+			case "Websites":
+				root.Websites = true
+			case "Email":
+				root.Email = true
+			}
+		}
+		if root.WebsitesDistrustAfter, err =
+			ccadbDate(field(record, "Distrust for TLS After Date")); err != nil {
+			return nil, err
+		}
+		if root.EmailDistrustAfter, err =
+			ccadbDate(field(record, "Distrust for S/MIME After Date")); err != nil {
+			return nil, err
+		}
+		return root, nil
+	}
+	store := NewRootStore()
+	for i, record := range records[1:] {
+		root, err := parseRecord(record)
+		if err != nil {
+			store.skipped = append(store.skipped,
+				&ParseError{fmt.Sprintf("row %d", i+1), err})
+			continue
+		}
+		store.Add(root)
+	}
+	if store.Len() == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	return store, nil
+}
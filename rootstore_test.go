@@ -0,0 +1,270 @@
+package sunlight
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns data as certdata.txt octal escapes, 16 bytes to a line.
+func encodeOctal(data []byte) string {
+	var buffer bytes.Buffer
+	for i, b := range data {
+		fmt.Fprintf(&buffer, "\\%03o", b)
+		if i%16 == 15 || i == len(data)-1 {
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.String()
+}
+
+// Returns a certdata.txt certificate object and trust object for cert.
+func certdataEntry(label string, cert *x509.Certificate, serverTrust, emailTrust,
+	serverDistrustAfter string) string {
+	hash := sha1.Sum(cert.Raw)
+	distrust := "CKA_NSS_SERVER_DISTRUST_AFTER CK_BBOOL CK_FALSE\n"
+	if len(serverDistrustAfter) > 0 {
+		distrust = "CKA_NSS_SERVER_DISTRUST_AFTER MULTILINE_OCTAL\n" +
+			encodeOctal([]byte(serverDistrustAfter)) + "END\n"
+	}
+	return fmt.Sprintf(`
+# Certificate "%[1]s"
+CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE
+CKA_TOKEN CK_BBOOL CK_TRUE
+CKA_LABEL UTF8 "%[1]s"
+CKA_VALUE MULTILINE_OCTAL
+%[2]sEND
+%[3]sCKA_NSS_EMAIL_DISTRUST_AFTER CK_BBOOL CK_FALSE
+
+# Trust for "%[1]s"
+CKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST
+CKA_LABEL UTF8 "%[1]s"
+CKA_CERT_SHA1_HASH MULTILINE_OCTAL
+%[4]sEND
+CKA_TRUST_SERVER_AUTH CK_TRUST %[5]s
+CKA_TRUST_EMAIL_PROTECTION CK_TRUST %[6]s
+CKA_TRUST_STEP_UP_APPROVED CK_BBOOL CK_FALSE
+`, label, encodeOctal(cert.Raw), distrust, encodeOctal(hash[:]), serverTrust, emailTrust)
+}
+
+// Returns two roots and an intermediate issued by the first.
+func makeRootStoreCerts(t *testing.T) (root1, root2, intermediate *x509.Certificate) {
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := caTemplate(notBefore)
+	template.Subject.CommonName = "Root One"
+	template.SubjectKeyId = []byte{1, 1, 1, 1}
+	root1, key := issueCert(t, template, nil, nil)
+
+	template = caTemplate(notBefore)
+	template.Subject.CommonName = "Root Two"
+	root2, _ = issueCert(t, template, nil, nil)
+
+	template = caTemplate(notBefore)
+	template.Subject.CommonName = "Intermediate"
+	intermediate, _ = issueCert(t, template, root1, key)
+	return root1, root2, intermediate
+}
+
+func writeTempFile(t *testing.T, dir, name, contents string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadNSSCertdata(t *testing.T) {
+	root1, root2, intermediate := makeRootStoreCerts(t)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certdata := "CVS_ID \"@(#) $RCSfile: certdata.txt $\"\nBEGINDATA\n" +
+		certdataEntry("Root One", root1, "CKT_NSS_TRUSTED_DELEGATOR",
+			"CKT_NSS_MUST_VERIFY_TRUST", "") +
+		certdataEntry("Root Two", root2, "CKT_NSS_TRUSTED_DELEGATOR",
+			"CKT_NSS_TRUSTED_DELEGATOR", "140630000000Z")
+	filename := writeTempFile(t, dir, "certdata.txt", certdata)
+
+	for _, load := range []func(string) (*RootStore, error){LoadNSSCertdata, LoadRootStore} {
+		store, err := load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if store.Len() != 2 {
+			t.Fatalf("Expected 2 roots, got %d", store.Len())
+		}
+		one, two := store.Roots()[0], store.Roots()[1]
+		if one.Name != "Root One" || !bytes.Equal(one.Cert.Raw, root1.Raw) {
+			t.Errorf("Unexpected first root %s", one.Name)
+		}
+		if !one.Websites || one.Email {
+			t.Error("Root One should only be trusted for websites")
+		}
+		if !two.Websites || !two.Email {
+			t.Error("Root Two should be trusted for websites and email")
+		}
+		distrustAfter := time.Date(2014, 6, 30, 0, 0, 0, 0, time.UTC)
+		if !two.WebsitesDistrustAfter.Equal(distrustAfter) {
+			t.Errorf("Unexpected distrust-after date %s", two.WebsitesDistrustAfter)
+		}
+		if !two.TrustedForWebsites(distrustAfter) ||
+			two.TrustedForWebsites(distrustAfter.AddDate(0, 0, 1)) {
+			t.Error("Root Two should only be trusted until its distrust-after date")
+		}
+		if !two.EmailDistrustAfter.IsZero() || !two.TrustedForEmail(distrustAfter.AddDate(1, 0, 0)) {
+			t.Error("Root Two shouldn't be distrusted for email")
+		}
+		if hashed := store.BySPKIHash(SPKIHash(root1)); len(hashed) != 1 || hashed[0] != one {
+			t.Error("Couldn't find Root One by SPKI hash")
+		}
+		if issuers := store.IssuersOf(intermediate); len(issuers) != 1 || issuers[0] != one {
+			t.Error("Root One should have issued the intermediate")
+		}
+	}
+
+	// A root that doesn't parse is skipped and reported, not fatal.
+	bad := strings.Replace(certdataEntry("Bad Root", root2, "CKT_NSS_TRUSTED_DELEGATOR",
+		"CKT_NSS_MUST_VERIFY_TRUST", ""), encodeOctal(root2.Raw),
+		encodeOctal([]byte("not a certificate")), 1)
+	store, err := LoadNSSCertdata(writeTempFile(t, dir, "bad.txt", certdata+bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected the 2 good roots, got %d", store.Len())
+	}
+	if skipped := store.Skipped(); len(skipped) != 1 ||
+		!strings.Contains(skipped[0].Error(), "Bad Root") {
+		t.Errorf("Expected Bad Root to be skipped, got %v", skipped)
+	}
+
+	truncated := writeTempFile(t, dir, "truncated.txt",
+		certdata[:strings.LastIndex(certdata, "END")])
+	if _, err := LoadNSSCertdata(truncated); err == nil {
+		t.Error("Expected an error for a truncated certdata.txt")
+	} else if _, ok := err.(*ParseError); !ok {
+		t.Errorf("Expected a ParseError, got %v", err)
+	}
+}
+
+func TestLoadPEMRootBundle(t *testing.T) {
+	root1, root2, intermediate := makeRootStoreCerts(t)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := writeTempFile(t, dir, "roots.pem", string(pemEncode(root1, root2, root1)))
+	for _, load := range []func(string) (*RootStore, error){LoadPEMRootBundle, LoadRootStore} {
+		store, err := load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if store.Len() != 2 {
+			t.Fatalf("Expected 2 roots (without the duplicate), got %d", store.Len())
+		}
+		for _, root := range store.Roots() {
+			if !root.Websites || root.Email {
+				t.Errorf("%s should only be trusted for websites", root.Name)
+			}
+		}
+		if len(store.IssuersOf(intermediate)) != 1 || len(store.IssuersOf(root2)) != 1 ||
+			len(store.IssuersOf(makeCert(t, subscriberTemplate(time.Now())))) != 0 {
+			t.Error("Unexpected issuers")
+		}
+	}
+	// A certificate that doesn't parse is skipped and reported, not fatal.
+	bad := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: []byte("not a certificate")})
+	store, err := LoadPEMRootBundle(writeTempFile(t, dir, "bad.pem",
+		string(pemEncode(root1))+string(bad)+string(pemEncode(root2))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected the 2 good roots, got %d", store.Len())
+	}
+	if skipped := store.Skipped(); len(skipped) != 1 ||
+		!strings.Contains(skipped[0].Error(), "certificate 2") {
+		t.Errorf("Expected the second certificate to be skipped, got %v", skipped)
+	}
+}
+
+func TestLoadCCADBCSV(t *testing.T) {
+	root1, root2, _ := makeRootStoreCerts(t)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	row := func(owner string, cert *x509.Certificate, trustBits, distrustTLS string) string {
+		hash := sha256.Sum256(cert.Raw)
+		return fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"'%s'\"\n", owner,
+			cert.Subject.CommonName, strings.ToUpper(hex.EncodeToString(hash[:])),
+			trustBits, distrustTLS, strings.TrimSpace(string(pemEncode(cert))))
+	}
+	csv := "\"Owner\",\"Common Name or Certificate Name\",\"SHA-256 Fingerprint\"," +
+		"\"Trust Bits\",\"Distrust for TLS After Date\",\"PEM Info\"\n" +
+		row("Acme", root1, "Email;Websites", "") +
+		row("Example", root2, "Email", "2014.06.30")
+	filename := writeTempFile(t, dir, "roots.csv", csv)
+	for _, load := range []func(string) (*RootStore, error){LoadCCADBCSV, LoadRootStore} {
+		store, err := load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if store.Len() != 2 {
+			t.Fatalf("Expected 2 roots, got %d", store.Len())
+		}
+		one, two := store.Roots()[0], store.Roots()[1]
+		if one.Owner != "Acme" || one.Name != "Root One" || !one.Websites || !one.Email {
+			t.Errorf("Unexpected first root %v", one)
+		}
+		if two.Owner != "Example" || two.Websites || !two.Email {
+			t.Errorf("Unexpected second root %v", two)
+		}
+		if !two.WebsitesDistrustAfter.Equal(time.Date(2014, 6, 30, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Unexpected distrust-after date %s", two.WebsitesDistrustAfter)
+		}
+	}
+
+	hash1, hash2 := sha256.Sum256(root1.Raw), sha256.Sum256(root2.Raw)
+	mismatched := writeTempFile(t, dir, "mismatched.csv", strings.Replace(csv,
+		strings.ToUpper(hex.EncodeToString(hash1[:])),
+		strings.ToUpper(hex.EncodeToString(hash2[:])), 1))
+	// A row that can't be read is skipped and reported, not fatal.
+	store, err := LoadCCADBCSV(mismatched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 1 || store.Roots()[0].Name != "Root Two" {
+		t.Errorf("Expected only Root Two, got %d roots", store.Len())
+	}
+	if skipped := store.Skipped(); len(skipped) != 1 ||
+		!strings.Contains(skipped[0].Error(), "row 1") {
+		t.Errorf("Expected the row with the wrong fingerprint to be skipped, got %v",
+			skipped)
+	}
+}
+
+func TestLoadRootStoreMissingFile(t *testing.T) {
+	store, err := LoadRootStore("does-not-exist.txt")
+	if fileErr, ok := err.(*FileError); !ok || fileErr.Filename != "does-not-exist.txt" {
+		t.Errorf("Expected a FileError, got %v", err)
+	}
+	if store != nil {
+		t.Error("Shouldn't get a root store")
+	}
+}
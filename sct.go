@@ -0,0 +1,221 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Chrome started requiring CT for all newly issued certs on 2018-04-30.
+var ctRequiredDate = time.Date(2018, 4, 30, 0, 0, 0, 0, time.UTC)
+
+var errMalformedSCTList = errors.New("malformed SCT list")
+
+// A signed certificate timestamp embedded in a certificate.
+type SCT struct {
+	Version uint8
+	// Base64 of the SHA-256 hash of the log's public key
+	LogID string
+	// Milliseconds since the epoch
+	Timestamp uint64
+	// The log's description and operator, if it's in the log list (see
+	// LoadCTLogList)
+	LogDescription string
+	LogOperator    string
+}
+
+// Reads a TLS-style vector with a two-byte length prefix from the start of
+// data. Returns the contents and the rest of data.
+func readUint16Vector(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errMalformedSCTList
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		return nil, nil, errMalformedSCTList
+	}
+	return data[2 : 2+length], data[2+length:], nil
+}
+
+// Returns the SCTs in cert's SCT list extension (RFC 6962 3.3), or nil if it
+// doesn't have one.
+func ParseEmbeddedSCTs(cert *x509.Certificate) ([]SCT, error) {
+	extension := findExtension(cert, oidExtensionSCTList)
+	if extension == nil {
+		return nil, nil
+	}
+	var listBytes []byte
+	if _, err := asn1.Unmarshal(extension.Value, &listBytes); err != nil {
+		return nil, err
+	}
+	list, rest, err := readUint16Vector(listBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errMalformedSCTList
+	}
+	var scts []SCT
+	for len(list) > 0 {
+		var serialized []byte
+		serialized, list, err = readUint16Vector(list)
+		if err != nil {
+			return nil, err
+		}
+		// version (1), log ID (32), timestamp (8), then the extensions and
+		// signature, which we don't look at.
+		if len(serialized) < 41 {
+			return nil, errMalformedSCTList
+		}
+		sct := SCT{
+			Version:   serialized[0],
+			LogID:     base64.StdEncoding.EncodeToString(serialized[1:33]),
+			Timestamp: binary.BigEndian.Uint64(serialized[33:41]),
+		}
+		if log, ok := CTLogByID(sct.LogID); ok {
+			sct.LogDescription = log.Description
+			sct.LogOperator = log.Operator
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// A CT log from the log list.
+type CTLog struct {
+	LogID       string
+	Description string
+	Operator    string
+	URL         string
+}
+
+var ctLogsLock sync.RWMutex
+var ctLogs = make(map[string]CTLog)
+
+// The parts of Chrome's log_list.json (version 3) that we use.
+type ctLogListFile struct {
+	Operators []struct {
+		Name string
+		Logs []struct {
+			Description string
+			LogID       string `json:"log_id"`
+			URL         string
+		}
+	}
+}
+
+// Loads a log list in the format of Chrome's log_list.json, so SCTs can be
+// attributed to the logs and operators that issued them.
+func LoadCTLogList(filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return &FileError{filename, err}
+	}
+	var list ctLogListFile
+	if err := json.Unmarshal(contents, &list); err != nil {
+		return &ParseError{filename, err}
+	}
+	ctLogsLock.Lock()
+	defer ctLogsLock.Unlock()
+	for _, operator := range list.Operators {
+		for _, log := range operator.Logs {
+			ctLogs[log.LogID] = CTLog{log.LogID, log.Description, operator.Name,
+				log.URL}
+		}
+	}
+	return nil
+}
+
+// Returns the log with the given base64 log ID, if it's in the log list.
+func CTLogByID(logID string) (CTLog, bool) {
+	ctLogsLock.RLock()
+	defer ctLogsLock.RUnlock()
+	log, ok := ctLogs[logID]
+	return log, ok
+}
+
+// Returns a name for the log that issued sct: its description if it's known,
+// and its ID otherwise.
+func (sct SCT) LogName() string {
+	if len(sct.LogDescription) > 0 {
+		return sct.LogDescription
+	}
+	return sct.LogID
+}
+
+// A CT policy requirement: certs with a lifetime of at most MaxLifetimeDays
+// days (or any lifetime, if it's 0) need at least MinSCTs embedded SCTs.
+type CTPolicyRule struct {
+	MaxLifetimeDays int
+	MinSCTs         int
+}
+
+var ctPolicyLock sync.RWMutex
+
+// Chrome's CT policy as of 2022. Rules are tried in order. Another policy can
+// be loaded with LoadCTPolicy.
+var ctPolicy = []CTPolicyRule{
+	{180, 2},
+	{0, 3},
+}
+
+// Replaces the CT policy with the JSON list of CTPolicyRules in filename.
+func LoadCTPolicy(filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return &FileError{filename, err}
+	}
+	var rules []CTPolicyRule
+	if err := json.Unmarshal(contents, &rules); err != nil {
+		return &ParseError{filename, err}
+	}
+	ctPolicyLock.Lock()
+	defer ctPolicyLock.Unlock()
+	ctPolicy = rules
+	return nil
+}
+
+// Returns how many embedded SCTs the CT policy requires of cert.
+func RequiredSCTCount(cert *x509.Certificate) int {
+	lifetimeDays := int(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)
+	ctPolicyLock.RLock()
+	defer ctPolicyLock.RUnlock()
+	for _, rule := range ctPolicy {
+		if rule.MaxLifetimeDays == 0 || lifetimeDays <= rule.MaxLifetimeDays {
+			return rule.MinSCTs
+		}
+	}
+	return 0
+}
+
+type insufficientSCTs struct{ checkInfo }
+
+func (check insufficientSCTs) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	violated, _ := check.Evaluate(cert, chain)
+	return violated
+}
+
+// SCTs can also be delivered in the TLS handshake or in OCSP responses,
+// which we can't see, so this is only a warning. A malformed SCT list can't
+// be counted, so it's an error rather than a violation.
+func (insufficientSCTs) Evaluate(cert *x509.Certificate, chain []*x509.Certificate) (bool, error) {
+	if isCACert(cert) {
+		return false, nil
+	}
+	scts, err := ParseEmbeddedSCTs(cert)
+	if err != nil {
+		return false, err
+	}
+	return len(scts) < RequiredSCTCount(cert), nil
+}
+
+func init() {
+	RegisterCheck(insufficientSCTs{checkInfo{
+		INSUFFICIENT_SCTS, "CT policy", SEVERITY_WARNING, ctRequiredDate}})
+}
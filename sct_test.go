@@ -0,0 +1,173 @@
+package sunlight
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func appendUint16Vector(b []byte, contents []byte) []byte {
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(contents)))
+	return append(append(b, length...), contents...)
+}
+
+// Returns an SCT list extension with an SCT from each log ID (a single byte
+// repeated), all with the given timestamp.
+func sctListExtension(t *testing.T, timestamp uint64, logIDs ...byte) pkix.Extension {
+	var list []byte
+	for _, logID := range logIDs {
+		sct := []byte{0}
+		for i := 0; i < 32; i++ {
+			sct = append(sct, logID)
+		}
+		ts := make([]byte, 8)
+		binary.BigEndian.PutUint64(ts, timestamp)
+		sct = append(sct, ts...)
+		// no extensions, then an empty ECDSA-SHA256 signature
+		sct = append(sct, 0, 0, 4, 3, 0, 0)
+		list = appendUint16Vector(list, sct)
+	}
+	value, err := asn1.Marshal(appendUint16Vector(nil, list))
+	if err != nil {
+		t.Fatal("could not encode SCT list", err)
+	}
+	return pkix.Extension{Id: oidExtensionSCTList, Value: value}
+}
+
+func TestParseEmbeddedSCTs(t *testing.T) {
+	template := subscriberTemplate(time.Now())
+	template.ExtraExtensions = []pkix.Extension{
+		sctListExtension(t, 1234, 0xaa, 0xbb)}
+	scts, err := ParseEmbeddedSCTs(makeCert(t, template))
+	if err != nil {
+		t.Fatal("could not parse SCTs", err)
+	}
+	if len(scts) != 2 || scts[0].Timestamp != 1234 || scts[1].Timestamp != 1234 {
+		t.Fatalf("Unexpected SCTs %v", scts)
+	}
+	logID := make([]byte, 32)
+	for i := range logID {
+		logID[i] = 0xaa
+	}
+	if scts[0].LogID != base64.StdEncoding.EncodeToString(logID) {
+		t.Errorf("Unexpected log ID %s", scts[0].LogID)
+	}
+
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: oidExtensionSCTList, Value: []byte{0x04, 0x03, 0x00, 0x05, 0x00}}}
+	if _, err := ParseEmbeddedSCTs(makeCert(t, template)); err == nil {
+		t.Error("Expected an error for a truncated SCT list")
+	}
+}
+
+func TestLoadCTLogList(t *testing.T) {
+	f, err := ioutil.TempFile("", "log_list")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	logID := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	f.WriteString(`{"operators": [{"name": "Example", "logs": [
+		{"description": "Example Log", "log_id": "` + logID + `",
+		 "url": "https://ct.example.com/"}]}]}`)
+	f.Close()
+	if err := LoadCTLogList(f.Name()); err != nil {
+		t.Fatal("could not load log list", err)
+	}
+	defer delete(ctLogs, logID)
+
+	template := subscriberTemplate(time.Now())
+	template.ExtraExtensions = []pkix.Extension{sctListExtension(t, 0, 0, 1)}
+	scts, _ := ParseEmbeddedSCTs(makeCert(t, template))
+	if scts[0].LogName() != "Example Log" || scts[0].LogOperator != "Example" {
+		t.Errorf("Unexpected log for %v", scts[0])
+	}
+	if scts[1].LogName() != scts[1].LogID {
+		t.Errorf("Unknown logs should be named by ID, got %s", scts[1].LogName())
+	}
+}
+
+func TestInsufficientSCTs(t *testing.T) {
+	notBefore := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		lifetimeDays int
+		logIDs       []byte
+		violated     bool
+	}{
+		{90, []byte{1, 2}, false},
+		{90, []byte{1}, true},
+		{365, []byte{1, 2}, true},
+		{365, []byte{1, 2, 3}, false},
+		{365, nil, true},
+	}
+	for _, c := range cases {
+		template := subscriberTemplate(notBefore)
+		template.NotAfter = notBefore.AddDate(0, 0, c.lifetimeDays)
+		if c.logIDs != nil {
+			template.ExtraExtensions = []pkix.Extension{
+				sctListExtension(t, 0, c.logIDs...)}
+		}
+		summary, _ := CalculateCertSummary(makeCert(t, template), 0, nil, nil, nil)
+		if summary.Violations[INSUFFICIENT_SCTS] != c.violated {
+			t.Errorf("%d days with %d SCTs: expected %v", c.lifetimeDays,
+				len(c.logIDs), c.violated)
+		}
+	}
+
+	// A malformed SCT list can't be evaluated, rather than having too few.
+	template := subscriberTemplate(notBefore)
+	template.ExtraExtensions = []pkix.Extension{
+		{Id: oidExtensionSCTList, Value: []byte{4, 1, 0}}}
+	summary, _ := CalculateCertSummary(makeCert(t, template), 0, nil, nil, nil)
+	if summary.Violations[INSUFFICIENT_SCTS] || len(summary.CheckErrors[INSUFFICIENT_SCTS]) == 0 {
+		t.Errorf("Expected a check error for a malformed SCT list, got %v",
+			summary.CheckErrors)
+	}
+
+	// Certs from before CT was required, and precerts, don't need SCTs.
+	template = subscriberTemplate(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	summary, _ = CalculateCertSummary(makeCert(t, template), 0, nil, nil, nil)
+	if summary.Violations[INSUFFICIENT_SCTS] {
+		t.Error("Certs from 2017 don't need SCTs")
+	}
+	tbs, _ := makePrecertAndFinal(t, subscriberTemplate(notBefore))
+	precert, err := ParsePrecertificate(tbs)
+	if err != nil {
+		t.Fatal("could not parse precertificate", err)
+	}
+	summary, _ = CalculatePrecertSummary(precert, 0, nil, nil, nil)
+	if summary.Violations[INSUFFICIENT_SCTS] {
+		t.Error("Precerts don't need SCTs")
+	}
+}
+
+func TestLoadCTPolicy(t *testing.T) {
+	f, err := ioutil.TempFile("", "ct_policy")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[{"MaxLifetimeDays": 0, "MinSCTs": 5}]`)
+	f.Close()
+	original := ctPolicy
+	defer func() { ctPolicy = original }()
+	if err := LoadCTPolicy(f.Name()); err != nil {
+		t.Fatal("could not load CT policy", err)
+	}
+	if required := RequiredSCTCount(subscriberTemplate(time.Now())); required != 5 {
+		t.Errorf("Expected 5 SCTs to be required, got %d", required)
+	}
+	ioutil.WriteFile(f.Name(), []byte("not JSON"), 0644)
+	if _, ok := LoadCTPolicy(f.Name()).(*ParseError); !ok {
+		t.Error("Expected a ParseError for a malformed policy")
+	}
+	if _, ok := LoadCTPolicy(f.Name() + ".missing").(*FileError); !ok {
+		t.Error("Expected a FileError for a missing policy")
+	}
+}
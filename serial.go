@@ -0,0 +1,169 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"math/big"
+	"time"
+)
+
+// BR 7.1 (after CA/B Forum Ballot 164): serial numbers must contain at least
+// 64 bits of output from a CSPRNG.
+var serialEntropyEffectiveDate = time.Date(2016, 9, 30, 0, 0, 0, 0, time.UTC)
+
+// Returns the length of the DER encoding of serial's contents, including the
+// leading zero byte needed when the high bit is set.
+func serialNumberLength(serial *big.Int) int {
+	b := serial.Bytes()
+	if len(b) == 0 {
+		return 1
+	}
+	if b[0]&0x80 != 0 {
+		return len(b) + 1
+	}
+	return len(b)
+}
+
+type serialNumberNotPositive struct{ checkInfo }
+
+// RFC 5280 4.1.2.2: serial numbers must be positive.
+func (serialNumberNotPositive) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.SerialNumber == nil || cert.SerialNumber.Sign() <= 0
+}
+
+type serialNumberTooLong struct{ checkInfo }
+
+// RFC 5280 4.1.2.2: serial numbers are at most 20 octets.
+func (serialNumberTooLong) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.SerialNumber != nil && serialNumberLength(cert.SerialNumber) > 20
+}
+
+type serialNumberLowEntropy struct{ checkInfo }
+
+// A serial with 64 random bits takes at least 9 octets once the sign bit is
+// accounted for, so anything shorter can't have enough entropy. (Longer
+// serials can, of course, still be predictable.)
+func (serialNumberLowEntropy) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	return cert.SerialNumber != nil && serialNumberLength(cert.SerialNumber) < 9
+}
+
+// Where the serial numbers issuers have used are kept, so that they can be
+// looked up without holding every serial in memory (e.g. a DB table indexed
+// by issuer and serial). Serials are hex strings.
+type SerialNumberStore interface {
+	// Returns the fingerprints of the certs the issuer with the key used
+	// serial for.
+	Fingerprints(issuerKey string, serial string) ([]string, error)
+	// Records that the issuer with the key used serial for the cert with the
+	// fingerprint.
+	Add(issuerKey string, serial string, fingerprint string) error
+}
+
+// A SerialNumberStore in memory, for when there are few enough serials.
+type MemorySerialNumberStore struct {
+	// Map of issuer key and serial number to the fingerprints of the certs
+	// that used it
+	fingerprints map[string][]string
+}
+
+func NewMemorySerialNumberStore() *MemorySerialNumberStore {
+	return &MemorySerialNumberStore{make(map[string][]string)}
+}
+
+func (store *MemorySerialNumberStore) Fingerprints(issuerKey string,
+	serial string) ([]string, error) {
+	return store.fingerprints[issuerKey+":"+serial], nil
+}
+
+func (store *MemorySerialNumberStore) Add(issuerKey string, serial string,
+	fingerprint string) error {
+	key := issuerKey + ":" + serial
+	store.fingerprints[key] = append(store.fingerprints[key], fingerprint)
+	return nil
+}
+
+// Keeps track of the serial numbers an issuer has used over a whole run, to
+// find serials that were reused or handed out sequentially. Unlike the checks
+// run by CalculateCertSummary, this needs to see every cert from the issuer.
+// The serials themselves are kept in a SerialNumberStore, which can be shared
+// by all issuers.
+type IssuerSerialNumbers struct {
+	// Identifies the issuer (see IssuerKey), so that CAs with the same name
+	// don't share serial numbers
+	IssuerKey string
+	// Total count of distinct certs seen from this issuer
+	CertCount uint64
+	// Count of certs whose serial number was already used by a different
+	// cert from this issuer
+	RepeatedCount uint64
+	// Count of certs whose serial number is one more or one less than that
+	// of another cert from this issuer
+	SequentialCount uint64
+	store           SerialNumberStore
+}
+
+func NewIssuerSerialNumbers(issuerKey string,
+	store SerialNumberStore) *IssuerSerialNumbers {
+	serials := new(IssuerSerialNumbers)
+	serials.IssuerKey = issuerKey
+	serials.store = store
+	return serials
+}
+
+// Returns whether the issuer used serial (as a hex string) for any cert.
+func (issuer *IssuerSerialNumbers) used(serial string) (bool, error) {
+	fingerprints, err := issuer.store.Fingerprints(issuer.IssuerKey, serial)
+	return len(fingerprints) > 0, err
+}
+
+// Records that the issuer issued the cert with the given serial number and
+// fingerprint. Returns whether the serial was repeated and whether it is
+// sequential with one seen before. Seeing the same cert again (e.g. because it
+// was logged twice) has no effect.
+func (issuer *IssuerSerialNumbers) Update(serial *big.Int,
+	fingerprint string) (repeated bool, sequential bool, err error) {
+	if serial == nil {
+		return false, false, nil
+	}
+	key := serial.Text(16)
+	fingerprints, err := issuer.store.Fingerprints(issuer.IssuerKey, key)
+	if err != nil {
+		return false, false, err
+	}
+	for _, seen := range fingerprints {
+		if seen == fingerprint {
+			return false, false, nil
+		}
+	}
+	repeated = len(fingerprints) > 0
+
+	one := big.NewInt(1)
+	sequential, err = issuer.used(new(big.Int).Sub(serial, one).Text(16))
+	if err == nil && !sequential {
+		sequential, err = issuer.used(new(big.Int).Add(serial, one).Text(16))
+	}
+	if err == nil {
+		err = issuer.store.Add(issuer.IssuerKey, key, fingerprint)
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	issuer.CertCount += 1
+	if repeated {
+		issuer.RepeatedCount += 1
+	}
+	if sequential {
+		issuer.SequentialCount += 1
+	}
+	return repeated, sequential, nil
+}
+
+func init() {
+	RegisterCheck(serialNumberNotPositive{checkInfo{
+		SERIAL_NUMBER_NOT_POSITIVE, "7.1", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(serialNumberTooLong{checkInfo{
+		SERIAL_NUMBER_TOO_LONG, "7.1", SEVERITY_ERROR, time.Time{}}})
+	RegisterCheck(serialNumberLowEntropy{checkInfo{
+		SERIAL_NUMBER_LOW_ENTROPY, "7.1", SEVERITY_WARNING,
+		serialEntropyEffectiveDate}})
+}
@@ -0,0 +1,92 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSerialNumberChecks(t *testing.T) {
+	cases := []struct {
+		serial   *big.Int
+		violated string
+	}{
+		{new(big.Int).SetBytes([]byte{0x01, 2, 3, 4, 5, 6, 7, 8, 9}), ""},
+		{big.NewInt(0), SERIAL_NUMBER_NOT_POSITIVE},
+		{big.NewInt(-5), SERIAL_NUMBER_NOT_POSITIVE},
+		{new(big.Int).Lsh(big.NewInt(1), 160), SERIAL_NUMBER_TOO_LONG},
+		// 20 octets including the leading zero for the sign bit
+		{new(big.Int).Lsh(big.NewInt(1), 151), ""},
+		{new(big.Int).Lsh(big.NewInt(1), 159), SERIAL_NUMBER_TOO_LONG},
+		{big.NewInt(1234567), SERIAL_NUMBER_LOW_ENTROPY},
+		// 8 bytes, but needs a 9th for the sign bit
+		{new(big.Int).SetBytes([]byte{0x81, 2, 3, 4, 5, 6, 7, 8}), ""},
+	}
+	serialChecks := []string{SERIAL_NUMBER_NOT_POSITIVE, SERIAL_NUMBER_TOO_LONG,
+		SERIAL_NUMBER_LOW_ENTROPY}
+	for _, c := range cases {
+		cert := &x509.Certificate{
+			SerialNumber: c.serial,
+			NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		for _, id := range serialChecks {
+			check := CheckByID(id)
+			violated := CheckApplies(check, cert) && check.Run(cert, nil)
+			// Non-positive serials are too short as well; only check the
+			// expected violation for those.
+			if c.serial.Sign() <= 0 && id == SERIAL_NUMBER_LOW_ENTROPY {
+				continue
+			}
+			if violated != (id == c.violated) {
+				t.Errorf("%s for %s: expected %v", id, c.serial, id == c.violated)
+			}
+		}
+	}
+}
+
+func TestIssuerSerialNumbers(t *testing.T) {
+	store := NewMemorySerialNumberStore()
+	serials := NewIssuerSerialNumbers("honest-al", store)
+	update := func(serial int64, fingerprint string) (bool, bool) {
+		repeated, sequential, err := serials.Update(big.NewInt(serial), fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repeated, sequential
+	}
+	if repeated, sequential := update(100, "a"); repeated || sequential {
+		t.Error("First serial can't be repeated or sequential")
+	}
+	if repeated, sequential := update(100, "a"); repeated || sequential {
+		t.Error("Seeing the same cert twice isn't a repeat")
+	}
+	if repeated, _ := update(100, "b"); !repeated {
+		t.Error("Different cert with the same serial should be a repeat")
+	}
+	if _, sequential := update(101, "c"); !sequential {
+		t.Error("101 should be sequential with 100")
+	}
+	if repeated, sequential := update(5000, "d"); repeated || sequential {
+		t.Error("5000 is neither repeated nor sequential")
+	}
+	if serials.CertCount != 4 || serials.RepeatedCount != 1 ||
+		serials.SequentialCount != 1 {
+		t.Errorf("Unexpected counts: %d %d %d", serials.CertCount,
+			serials.RepeatedCount, serials.SequentialCount)
+	}
+
+	// Another issuer sharing the store has its own serials.
+	other := NewIssuerSerialNumbers("other", store)
+	repeated, sequential, err := other.Update(big.NewInt(100), "e")
+	if err != nil || repeated || sequential {
+		t.Error("Serials of another issuer shouldn't be repeats")
+	}
+	// A new IssuerSerialNumbers for the issuer (as in a later run) finds the
+	// serials seen before by looking them up in the store.
+	resumed := NewIssuerSerialNumbers("honest-al", store)
+	repeated, sequential, err = resumed.Update(big.NewInt(5001), "f")
+	if err != nil || repeated || !sequential {
+		t.Error("5001 should be sequential with the 5000 seen before")
+	}
+}
@@ -0,0 +1,270 @@
+package sunlight
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/monicachew/certificatetransparency"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A source of certificates other than a CT log, e.g. an inventory of
+// certificates found by an internal scan. Map calls fn on each certificate
+// as an X.509 log entry, the way EntriesFile.Map does for a downloaded log,
+// so that the certificates go through the same processing as logged ones.
+// Entries are numbered in the order they're read. Since the certificates
+// weren't logged, each entry's timestamp is its certificate's notBefore.
+type CertSource interface {
+	Map(fn func(*certificatetransparency.EntryAndPosition, error), maxEntries uint64)
+}
+
+// Certificates read from an io.Reader (e.g. a PEM bundle on stdin), in any
+// of the formats splitCertificates understands.
+type CertReader struct {
+	io.Reader
+}
+
+// Certificates from a file, read as for CertReader.
+type CertFile struct {
+	Filename string
+}
+
+// Certificates from every file in a directory and its subdirectories, in
+// lexical order. Each file is read as for CertReader.
+type CertDirectory struct {
+	Dir string
+}
+
+// Certificates from every file in a zip, tar or gzipped tar archive, in the
+// order they're stored. Each file is read as for CertReader.
+type CertArchive struct {
+	Filename string
+}
+
+// Stops walking a CertDirectory.
+var errMaxEntries = errors.New("read maxEntries certificates")
+
+// Returns the DER certificates in data, which can be any number of PEM
+// blocks, a single DER certificate, or one base64 DER certificate per line.
+func splitCertificates(data []byte) ([][]byte, error) {
+	var certs [][]byte
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				return certs, nil
+			}
+			if block.Type == "CERTIFICATE" {
+				certs = append(certs, block.Bytes)
+			}
+		}
+	}
+	// A DER certificate starts with a SEQUENCE tag, which isn't base64.
+	if len(data) > 0 && data[0] == 0x30 {
+		return [][]byte{data}, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		cert, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Calls fn on the certificates in a series of files, numbering the entries
+// and stopping after maxEntries of them (unless it's 0).
+type certMapper struct {
+	fn         func(*certificatetransparency.EntryAndPosition, error)
+	maxEntries uint64
+	index      uint64
+}
+
+// Returns whether the mapper has reached maxEntries.
+func (mapper *certMapper) done() bool {
+	return mapper.maxEntries > 0 && mapper.index >= mapper.maxEntries
+}
+
+// Calls fn on the certificates in data, the contents of the file name, or
+// with err if the file couldn't be read. Returns false once maxEntries have
+// been mapped.
+func (mapper *certMapper) mapFile(name string, data []byte, err error) bool {
+	if err != nil {
+		err = &FileError{name, err}
+	} else {
+		var certs [][]byte
+		certs, err = splitCertificates(data)
+		for _, der := range certs {
+			if mapper.done() {
+				return false
+			}
+			mapper.mapCert(name, der)
+		}
+		if err != nil {
+			err = &ParseError{name, err}
+		}
+	}
+	if err != nil {
+		if mapper.done() {
+			return false
+		}
+		mapper.fn(&certificatetransparency.EntryAndPosition{Index: mapper.index}, err)
+		mapper.index += 1
+	}
+	return !mapper.done()
+}
+
+func (mapper *certMapper) mapCert(name string, der []byte) {
+	ent := &certificatetransparency.EntryAndPosition{Index: mapper.index, Raw: der}
+	mapper.index += 1
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		mapper.fn(ent, &ParseError{fmt.Sprintf("certificate %d in %s", ent.Index, name), err})
+		return
+	}
+	ent.Entry = &certificatetransparency.LogEntry{
+		Type:      certificatetransparency.X509Entry,
+		Timestamp: uint64(cert.NotBefore.UnixNano() / 1000000),
+		X509Cert:  der,
+	}
+	mapper.fn(ent, nil)
+}
+
+func (source CertReader) Map(fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) {
+	mapper := &certMapper{fn: fn, maxEntries: maxEntries}
+	data, err := ioutil.ReadAll(source.Reader)
+	mapper.mapFile("input", data, err)
+}
+
+func (source CertFile) Map(fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) {
+	mapper := &certMapper{fn: fn, maxEntries: maxEntries}
+	data, err := ioutil.ReadFile(source.Filename)
+	mapper.mapFile(source.Filename, data, err)
+}
+
+func (source CertDirectory) Map(fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) {
+	mapper := &certMapper{fn: fn, maxEntries: maxEntries}
+	filepath.Walk(source.Dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			return nil
+		}
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadFile(path)
+		}
+		if !mapper.mapFile(path, data, err) {
+			return errMaxEntries
+		}
+		return nil
+	})
+}
+
+func (source CertArchive) Map(fn func(*certificatetransparency.EntryAndPosition, error),
+	maxEntries uint64) {
+	mapper := &certMapper{fn: fn, maxEntries: maxEntries}
+	if strings.HasSuffix(source.Filename, ".zip") {
+		source.mapZip(mapper)
+	} else {
+		source.mapTar(mapper)
+	}
+}
+
+func (source CertArchive) mapZip(mapper *certMapper) {
+	archive, err := zip.OpenReader(source.Filename)
+	if err != nil {
+		mapper.mapFile(source.Filename, nil, err)
+		return
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		var data []byte
+		contents, err := file.Open()
+		if err == nil {
+			data, err = ioutil.ReadAll(contents)
+			contents.Close()
+		}
+		if !mapper.mapFile(file.Name, data, err) {
+			return
+		}
+	}
+}
+
+func (source CertArchive) mapTar(mapper *certMapper) {
+	file, err := os.Open(source.Filename)
+	if err != nil {
+		mapper.mapFile(source.Filename, nil, err)
+		return
+	}
+	defer file.Close()
+	var in io.Reader = file
+	if strings.HasSuffix(source.Filename, ".gz") || strings.HasSuffix(source.Filename, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			mapper.mapFile(source.Filename, nil, err)
+			return
+		}
+		defer gzipReader.Close()
+		in = gzipReader
+	}
+	archive := tar.NewReader(in)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			mapper.mapFile(source.Filename, nil, err)
+			return
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		data, err := ioutil.ReadAll(archive)
+		if !mapper.mapFile(header.Name, data, err) {
+			return
+		}
+	}
+}
+
+// Returns the CertSource for name: "-" for stdin, a directory, a .zip, .tar,
+// .tar.gz or .tgz archive, or otherwise a CertFile.
+func OpenCertSource(name string) (CertSource, error) {
+	if name == "-" {
+		return CertReader{os.Stdin}, nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return CertDirectory{name}, nil
+	}
+	for _, suffix := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, suffix) {
+			return CertArchive{name}, nil
+		}
+	}
+	return CertFile{name}, nil
+}
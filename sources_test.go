@@ -0,0 +1,183 @@
+package sunlight
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/monicachew/certificatetransparency"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns n certificates with distinct notBefore dates.
+func makeSourceCerts(t *testing.T, n int) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for i := 0; i < n; i++ {
+		notBefore := time.Date(2014, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC)
+		certs = append(certs, makeCert(t, subscriberTemplate(notBefore)))
+	}
+	return certs
+}
+
+func pemEncode(certs ...*x509.Certificate) []byte {
+	var buffer bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buffer, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buffer.Bytes()
+}
+
+// Returns the certificates source maps, checking that the entries are
+// numbered in order and timestamped with notBefore.
+func mapSource(t *testing.T, source CertSource, maxEntries uint64) [][]byte {
+	var certs [][]byte
+	source.Map(func(ent *certificatetransparency.EntryAndPosition, err error) {
+		if err != nil {
+			t.Error("unexpected error", err)
+			return
+		}
+		if ent.Index != uint64(len(certs)) {
+			t.Errorf("Expected entry %d, got %d", len(certs), ent.Index)
+		}
+		cert, err := x509.ParseCertificate(ent.Entry.X509Cert)
+		if err != nil {
+			t.Fatal("could not parse certificate", err)
+		}
+		if ent.Entry.Timestamp != uint64(cert.NotBefore.Unix())*1000 {
+			t.Errorf("Unexpected timestamp %d", ent.Entry.Timestamp)
+		}
+		certs = append(certs, ent.Entry.X509Cert)
+	}, maxEntries)
+	return certs
+}
+
+func rawCerts(certs ...*x509.Certificate) [][]byte {
+	var raw [][]byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw)
+	}
+	return raw
+}
+
+func TestCertReader(t *testing.T) {
+	certs := makeSourceCerts(t, 3)
+	bundle := CertReader{bytes.NewReader(pemEncode(certs...))}
+	if got := mapSource(t, bundle, 0); !reflect.DeepEqual(got, rawCerts(certs...)) {
+		t.Error("Didn't get the certificates in the PEM bundle")
+	}
+	bundle = CertReader{bytes.NewReader(pemEncode(certs...))}
+	if got := mapSource(t, bundle, 2); !reflect.DeepEqual(got, rawCerts(certs[:2]...)) {
+		t.Error("Didn't stop after maxEntries")
+	}
+	der := CertReader{bytes.NewReader(certs[0].Raw)}
+	if got := mapSource(t, der, 0); !reflect.DeepEqual(got, rawCerts(certs[0])) {
+		t.Error("Didn't get the DER certificate")
+	}
+	var lines bytes.Buffer
+	for _, cert := range certs {
+		lines.WriteString(base64.StdEncoding.EncodeToString(cert.Raw) + "\n\n")
+	}
+	b64 := CertReader{&lines}
+	if got := mapSource(t, b64, 0); !reflect.DeepEqual(got, rawCerts(certs...)) {
+		t.Error("Didn't get the base64 certificates")
+	}
+
+	errors := 0
+	CertReader{bytes.NewBufferString("not base64!\n")}.Map(
+		func(ent *certificatetransparency.EntryAndPosition, err error) {
+			if err == nil || ent.Index != 0 {
+				t.Error("Expected an error for entry 0")
+			}
+			errors += 1
+		}, 0)
+	if errors != 1 {
+		t.Error("Expected an error for garbage input")
+	}
+}
+
+func TestCertDirectory(t *testing.T) {
+	certs := makeSourceCerts(t, 4)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "b"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.pem"), pemEncode(certs[0], certs[1]), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b", "c.der"), certs[2].Raw, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "d.b64"),
+		[]byte(base64.StdEncoding.EncodeToString(certs[3].Raw)), 0644)
+
+	source, err := OpenCertSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mapSource(t, source, 0); !reflect.DeepEqual(got, rawCerts(certs...)) {
+		t.Error("Didn't get the certificates in the directory in order")
+	}
+	if got := mapSource(t, source, 3); !reflect.DeepEqual(got, rawCerts(certs[:3]...)) {
+		t.Error("Didn't stop after maxEntries")
+	}
+	source, err = OpenCertSource(filepath.Join(dir, "a.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mapSource(t, source, 0); !reflect.DeepEqual(got, rawCerts(certs[:2]...)) {
+		t.Error("Didn't get the certificates in the file")
+	}
+}
+
+func TestCertArchive(t *testing.T) {
+	certs := makeSourceCerts(t, 3)
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	for i, cert := range certs {
+		w, _ := zipWriter.Create(fmt.Sprintf("certs/%d.pem", i))
+		w.Write(pemEncode(cert))
+	}
+	zipWriter.Close()
+	zipFile := filepath.Join(dir, "certs.zip")
+	ioutil.WriteFile(zipFile, zipped.Bytes(), 0644)
+
+	var tarred bytes.Buffer
+	gzipWriter := gzip.NewWriter(&tarred)
+	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter.WriteHeader(&tar.Header{Name: "certs/", Typeflag: tar.TypeDir, Mode: 0755})
+	for i, cert := range certs {
+		tarWriter.WriteHeader(&tar.Header{Name: fmt.Sprintf("certs/%d.der", i),
+			Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(cert.Raw))})
+		tarWriter.Write(cert.Raw)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	tarFile := filepath.Join(dir, "certs.tar.gz")
+	ioutil.WriteFile(tarFile, tarred.Bytes(), 0644)
+
+	for _, filename := range []string{zipFile, tarFile} {
+		source, err := OpenCertSource(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := source.(CertArchive); !ok {
+			t.Errorf("%s should be an archive", filename)
+		}
+		if got := mapSource(t, source, 0); !reflect.DeepEqual(got, rawCerts(certs...)) {
+			t.Errorf("Didn't get the certificates in %s", filename)
+		}
+	}
+}
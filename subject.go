@@ -0,0 +1,215 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	oidAttributeCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidAttributeSerialNumber       = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidAttributeCountryName        = asn1.ObjectIdentifier{2, 5, 4, 6}
+	oidAttributeLocalityName       = asn1.ObjectIdentifier{2, 5, 4, 7}
+	oidAttributeStateOrProvince    = asn1.ObjectIdentifier{2, 5, 4, 8}
+	oidAttributeOrganizationName   = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidAttributeOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidAttributePostalCode         = asn1.ObjectIdentifier{2, 5, 4, 17}
+	oidAttributeEmailAddress       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+	oidAttributeDomainComponent    = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+)
+
+// RFC 5280 Appendix A upper bounds, in characters.
+var subjectFieldUpperBounds = map[string]int{
+	oidAttributeCommonName.String():         64,
+	oidAttributeSerialNumber.String():       64,
+	oidAttributeCountryName.String():        2,
+	oidAttributeLocalityName.String():       128,
+	oidAttributeStateOrProvince.String():    128,
+	oidAttributeOrganizationName.String():   64,
+	oidAttributeOrganizationalUnit.String(): 64,
+	oidAttributePostalCode.String():         40,
+	oidAttributeEmailAddress.String():       255,
+}
+
+// Attributes that RFC 5280 (and the EV Guidelines and RFC 4519) require to
+// be a PrintableString or IA5String.
+var subjectFieldRequiredTags = map[string]int{
+	oidAttributeCountryName.String():             asn1.TagPrintableString,
+	oidAttributeSerialNumber.String():            asn1.TagPrintableString,
+	oidAttributeJurisdictionCountryName.String(): asn1.TagPrintableString,
+	oidAttributeEmailAddress.String():            asn1.TagIA5String,
+	oidAttributeDomainComponent.String():         asn1.TagIA5String,
+}
+
+// Attributes that are DirectoryStrings, which must be a PrintableString or
+// UTF8String. Attributes that are neither these nor in
+// subjectFieldRequiredTags aren't checked, since their type isn't known.
+var directoryStringAttributes = map[string]bool{
+	oidAttributeCommonName.String():         true,
+	oidAttributeLocalityName.String():       true,
+	oidAttributeStateOrProvince.String():    true,
+	oidAttributeOrganizationName.String():   true,
+	oidAttributeOrganizationalUnit.String(): true,
+	oidAttributePostalCode.String():         true,
+	oidAttributeSurname.String():            true,
+	oidAttributeBusinessCategory.String():   true,
+	oidAttributeGivenName.String():          true,
+	oidAttributePseudonym.String():          true,
+}
+
+// Values that are obviously not real subject information: OpenSSL's
+// defaults and the various ways of saying "nothing here". BR 7.1.4.2.2 (j)
+// forbids metadata like this.
+var subjectPlaceholderValues = map[string]bool{
+	"-":                        true,
+	".":                        true,
+	"?":                        true,
+	"n/a":                      true,
+	"na":                       true,
+	"none":                     true,
+	"null":                     true,
+	"not applicable":           true,
+	"unknown":                  true,
+	"default city":             true,
+	"default company ltd":      true,
+	"some-state":               true,
+	"internet widgits pty ltd": true,
+}
+
+// ISO 3166-1 alpha-2 codes, plus "XX", which BR 7.1.4.2.2 (g) allows when
+// the subject's country isn't represented.
+var countryCodes = make(map[string]bool)
+
+func init() {
+	for _, code := range strings.Fields(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI
+		BJ BL BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN
+		CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK
+		FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM
+		HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN
+		KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK
+		ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP
+		NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF
+		TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI
+		VN VU WF WS YE YT ZA ZM ZW XX`) {
+		countryCodes[code] = true
+	}
+}
+
+// A single attribute of a distinguished name, with the ASN.1 string type it
+// was encoded as.
+type subjectAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Tag   int
+	Value string
+}
+
+type rawAttributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// As pkix.RelativeDistinguishedNameSET, but keeping the raw values. (The
+// name has to end in SET for encoding/asn1 to treat it as a SET OF.)
+type rawRelativeDistinguishedNameSET []rawAttributeTypeAndValue
+
+// Parses a DER-encoded distinguished name into its attributes, in order.
+// Values that can't be decoded as strings are returned as their raw bytes.
+func parseSubjectAttributes(rawName []byte) ([]subjectAttribute, error) {
+	var rdns []rawRelativeDistinguishedNameSET
+	if _, err := asn1.Unmarshal(rawName, &rdns); err != nil {
+		return nil, err
+	}
+	var attributes []subjectAttribute
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			var value string
+			if _, err := asn1.Unmarshal(atv.Value.FullBytes, &value); err != nil {
+				value = string(atv.Value.Bytes)
+			}
+			attributes = append(attributes,
+				subjectAttribute{atv.Type, atv.Value.Tag, value})
+		}
+	}
+	return attributes, nil
+}
+
+// subjectCheck flags certs where invalid returns true for any attribute of
+// the subject.
+type subjectCheck struct {
+	checkInfo
+	invalid func(attribute subjectAttribute) bool
+}
+
+func (check subjectCheck) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	violated, _ := check.Evaluate(cert, chain)
+	return violated
+}
+
+func (check subjectCheck) Evaluate(cert *x509.Certificate, chain []*x509.Certificate) (bool, error) {
+	attributes, err := parseSubjectAttributes(cert.RawSubject)
+	if err != nil {
+		return false, &ParseError{"subject", err}
+	}
+	for _, attribute := range attributes {
+		if check.invalid(attribute) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isInvalidCountryCode(attribute subjectAttribute) bool {
+	return attribute.Type.Equal(oidAttributeCountryName) &&
+		!countryCodes[attribute.Value]
+}
+
+func isSubjectFieldTooLong(attribute subjectAttribute) bool {
+	bound, ok := subjectFieldUpperBounds[attribute.Type.String()]
+	return ok && utf8.RuneCountInString(attribute.Value) > bound
+}
+
+// Country names are left to InvalidCountryCode: "NA" is Namibia, not "not
+// applicable". So is a jurisdiction country that's a real country code.
+func isSubjectPlaceholderValue(attribute subjectAttribute) bool {
+	if attribute.Type.Equal(oidAttributeCountryName) ||
+		(attribute.Type.Equal(oidAttributeJurisdictionCountryName) &&
+			countryCodes[attribute.Value]) {
+		return false
+	}
+	return subjectPlaceholderValues[strings.ToLower(strings.TrimSpace(attribute.Value))]
+}
+
+func hasLeadingOrTrailingWhitespace(attribute subjectAttribute) bool {
+	return strings.TrimSpace(attribute.Value) != attribute.Value
+}
+
+func hasBadStringEncoding(attribute subjectAttribute) bool {
+	if tag, ok := subjectFieldRequiredTags[attribute.Type.String()]; ok {
+		return attribute.Tag != tag
+	}
+	return directoryStringAttributes[attribute.Type.String()] &&
+		attribute.Tag != asn1.TagPrintableString && attribute.Tag != asn1.TagUTF8String
+}
+
+func init() {
+	RegisterCheck(subjectCheck{checkInfo{
+		INVALID_COUNTRY_CODE, "7.1.4.2.2", SEVERITY_ERROR, time.Time{}},
+		isInvalidCountryCode})
+	RegisterCheck(subjectCheck{checkInfo{
+		SUBJECT_FIELD_TOO_LONG, "7.1.4.2.2", SEVERITY_ERROR, time.Time{}},
+		isSubjectFieldTooLong})
+	RegisterCheck(subjectCheck{checkInfo{
+		SUBJECT_PLACEHOLDER_VALUE, "7.1.4.2.2", SEVERITY_ERROR, time.Time{}},
+		isSubjectPlaceholderValue})
+	RegisterCheck(subjectCheck{checkInfo{
+		SUBJECT_WHITESPACE, "7.1.4.2.2", SEVERITY_WARNING, time.Time{}},
+		hasLeadingOrTrailingWhitespace})
+	RegisterCheck(subjectCheck{checkInfo{
+		SUBJECT_BAD_STRING_ENCODING, "7.1.4.2.2", SEVERITY_WARNING, time.Time{}},
+		hasBadStringEncoding})
+}
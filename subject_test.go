@@ -0,0 +1,97 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubjectChecks(t *testing.T) {
+	cases := []struct {
+		subject  pkix.Name
+		violated []string
+	}{
+		{pkix.Name{CommonName: "test.example.com", Country: []string{"US"},
+			Organization: []string{"Example Inc"}}, nil},
+		{pkix.Name{CommonName: "test.example.com", Country: []string{"XX"}}, nil},
+		// Namibia
+		{pkix.Name{CommonName: "test.example.com", Country: []string{"NA"}}, nil},
+		{pkix.Name{CommonName: "test.example.com", Organization: []string{"NA"}},
+			[]string{SUBJECT_PLACEHOLDER_VALUE}},
+		{pkix.Name{CommonName: "test.example.com", Country: []string{"UK"}},
+			[]string{INVALID_COUNTRY_CODE}},
+		{pkix.Name{CommonName: "test.example.com", Country: []string{"USA"}},
+			[]string{INVALID_COUNTRY_CODE, SUBJECT_FIELD_TOO_LONG}},
+		{pkix.Name{CommonName: "test.example.com",
+			Organization: []string{strings.Repeat("a", 65)}},
+			[]string{SUBJECT_FIELD_TOO_LONG}},
+		// 64 characters, but more than 64 bytes
+		{pkix.Name{CommonName: "test.example.com",
+			Organization: []string{strings.Repeat("é", 64)}}, nil},
+		{pkix.Name{CommonName: "test.example.com",
+			Province: []string{"Some-State"}, Locality: []string{"Default City"}},
+			[]string{SUBJECT_PLACEHOLDER_VALUE}},
+		{pkix.Name{CommonName: "test.example.com",
+			OrganizationalUnit: []string{"-"}},
+			[]string{SUBJECT_PLACEHOLDER_VALUE}},
+		{pkix.Name{CommonName: "test.example.com",
+			Organization: []string{"Example Inc "}},
+			[]string{SUBJECT_WHITESPACE}},
+	}
+	for i, c := range cases {
+		template := subscriberTemplate(time.Now())
+		template.Subject = c.subject
+		checkSubjectViolations(t, i, makeCert(t, template), c.violated)
+	}
+}
+
+func TestSubjectStringEncoding(t *testing.T) {
+	encode := func(oid asn1.ObjectIdentifier, tag int, value string) []byte {
+		rdns := []rawRelativeDistinguishedNameSET{{{oid,
+			asn1.RawValue{Tag: tag, Bytes: []byte(value)}}}}
+		raw, err := asn1.Marshal(rdns)
+		if err != nil {
+			t.Fatal("could not encode subject", err)
+		}
+		return raw
+	}
+	cases := []struct {
+		rawSubject []byte
+		violated   []string
+	}{
+		{encode(oidAttributeOrganizationName, asn1.TagUTF8String, "Example"), nil},
+		{encode(oidAttributeOrganizationName, asn1.TagT61String, "Example"),
+			[]string{SUBJECT_BAD_STRING_ENCODING}},
+		{encode(oidAttributeCountryName, asn1.TagUTF8String, "US"),
+			[]string{SUBJECT_BAD_STRING_ENCODING}},
+		{encode(oidAttributeCountryName, asn1.TagPrintableString, "US"), nil},
+		{encode(oidAttributeDomainComponent, asn1.TagIA5String, "example"), nil},
+		{encode(oidAttributeDomainComponent, asn1.TagUTF8String, "example"),
+			[]string{SUBJECT_BAD_STRING_ENCODING}},
+	}
+	for i, c := range cases {
+		template := subscriberTemplate(time.Now())
+		template.RawSubject = c.rawSubject
+		checkSubjectViolations(t, i, makeCert(t, template), c.violated)
+	}
+}
+
+var subjectChecks = []string{INVALID_COUNTRY_CODE, SUBJECT_FIELD_TOO_LONG,
+	SUBJECT_PLACEHOLDER_VALUE, SUBJECT_WHITESPACE, SUBJECT_BAD_STRING_ENCODING}
+
+func checkSubjectViolations(t *testing.T, i int, cert *x509.Certificate,
+	violated []string) {
+	summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+	for _, id := range subjectChecks {
+		expected := false
+		for _, v := range violated {
+			expected = expected || id == v
+		}
+		if summary.Violations[id] != expected {
+			t.Errorf("case %d: %s expected %v", i, id, expected)
+		}
+	}
+}
@@ -2,8 +2,6 @@ package sunlight
 
 import (
 	"bytes"
-	"code.google.com/p/go.net/idna"
-	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -11,29 +9,84 @@ import (
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/monicachew/alexa"
-	"io/ioutil"
-	"net"
-	"os"
-	"strings"
 	"time"
 )
 
 const (
-	VALID_PERIOD_TOO_LONG          = "ValidPeriodTooLong"
-	DEPRECATED_SIGNATURE_ALGORITHM = "DeprecatedSignatureAlgorithm"
-	DEPRECATED_VERSION             = "DeprecatedVersion"
-	MISSING_CN_IN_SAN              = "MissingCNInSan"
-	KEY_TOO_SHORT                  = "KeyTooShort"
-	EXP_TOO_SMALL                  = "ExpTooSmall"
+	VALID_PERIOD_TOO_LONG             = "ValidPeriodTooLong"
+	VALID_PERIOD_OVER_39_MONTHS       = "ValidPeriodOver39Months"
+	VALID_PERIOD_OVER_825_DAYS        = "ValidPeriodOver825Days"
+	VALID_PERIOD_OVER_398_DAYS        = "ValidPeriodOver398Days"
+	DEPRECATED_SIGNATURE_ALGORITHM    = "DeprecatedSignatureAlgorithm"
+	DEPRECATED_VERSION                = "DeprecatedVersion"
+	MISSING_CN_IN_SAN                 = "MissingCNInSan"
+	KEY_TOO_SHORT                     = "KeyTooShort"
+	EXP_TOO_SMALL                     = "ExpTooSmall"
+	DISALLOWED_CURVE                  = "DisallowedCurve"
+	INVALID_EC_POINT                  = "InvalidECPoint"
+	DSA_KEY                           = "DSAKey"
+	ROCA_FINGERPRINT                  = "ROCAFingerprint"
+	DEBIAN_WEAK_KEY                   = "DebianWeakKey"
+	SMALL_PRIME_FACTOR                = "SmallPrimeFactor"
+	EVEN_EXPONENT                     = "EvenExponent"
+	FERMAT_FACTORABLE                 = "FermatFactorable"
+	INTERNAL_NAME                     = "InternalName"
+	RESERVED_IP_ADDRESS               = "ReservedIPAddress"
+	IP_ADDRESS_IN_DNS_NAME            = "IPAddressInDNSName"
+	DNS_NAME_UNDERSCORE               = "DNSNameUnderscore"
+	DNS_NAME_EMPTY_LABEL              = "DNSNameEmptyLabel"
+	DNS_NAME_LABEL_TOO_LONG           = "DNSNameLabelTooLong"
+	DNS_NAME_TRAILING_DOT             = "DNSNameTrailingDot"
+	WILDCARD_NOT_LEFTMOST             = "WildcardNotLeftmost"
+	PARTIAL_LABEL_WILDCARD            = "PartialLabelWildcard"
+	WILDCARD_ON_PUBLIC_SUFFIX         = "WildcardOnPublicSuffix"
+	INVALID_PUNYCODE                  = "InvalidPunycode"
+	MISSING_SERVER_AUTH_EKU           = "MissingServerAuthEKU"
+	ANY_EXTENDED_KEY_USAGE            = "AnyExtendedKeyUsage"
+	INAPPROPRIATE_KEY_USAGE           = "InappropriateKeyUsage"
+	SUBSCRIBER_CA_TRUE                = "SubscriberCATrue"
+	CA_BASIC_CONSTRAINTS_NOT_CRITICAL = "CABasicConstraintsNotCritical"
+	CA_MISSING_KEY_CERT_SIGN          = "CAMissingKeyCertSign"
+	MISSING_REVOCATION_POINTER        = "MissingRevocationPointer"
+	MISSING_ISSUING_CERTIFICATE_URL   = "MissingIssuingCertificateURL"
+	MALFORMED_REVOCATION_URL          = "MalformedRevocationURL"
+	DV_WITH_ORGANIZATION              = "DVWithOrganization"
+	OV_MISSING_ORGANIZATION           = "OVMissingOrganization"
+	IV_MISSING_INDIVIDUAL             = "IVMissingIndividual"
+	EV_MISSING_JURISDICTION           = "EVMissingJurisdiction"
+	EV_MISSING_SERIAL_NUMBER          = "EVMissingSerialNumber"
+	EV_MISSING_BUSINESS_CATEGORY      = "EVMissingBusinessCategory"
+	SERIAL_NUMBER_NOT_POSITIVE        = "SerialNumberNotPositive"
+	SERIAL_NUMBER_TOO_LONG            = "SerialNumberTooLong"
+	SERIAL_NUMBER_LOW_ENTROPY         = "SerialNumberLowEntropy"
+	INVALID_COUNTRY_CODE              = "InvalidCountryCode"
+	SUBJECT_FIELD_TOO_LONG            = "SubjectFieldTooLong"
+	SUBJECT_PLACEHOLDER_VALUE         = "SubjectPlaceholderValue"
+	SUBJECT_WHITESPACE                = "SubjectWhitespace"
+	SUBJECT_BAD_STRING_ENCODING       = "SubjectBadStringEncoding"
+	INSUFFICIENT_SCTS                 = "InsufficientSCTs"
 )
 
 // Only fields that start with capital letters are exported
 type CertSummary struct {
-	CN                 string
-	Issuer             string
+	// ENTRY_TYPE_X509 or ENTRY_TYPE_PRECERT
+	EntryType string
+	CN        string
+	// The issuer's O, OU and CN (see DistinguishedNameToString)
+	Issuer string
+	// The issuer's full RFC 4514 DN, for display
+	IssuerDN string
+	// Identifies the CA key that issued the cert, whatever its name (see
+	// IssuerKey)
+	IssuerKey string
+	// The CA organisation that owns the issuer (see CAOwner and
+	// OwnerMap.Apply)
+	CAOwner            string
 	Sha256Fingerprint  string
 	NotBefore          string
 	NotAfter           string
+	KeyAlgorithm       string
+	Curve              string
 	KeySize            int
 	Exp                int
 	SignatureAlgorithm int
@@ -41,10 +94,41 @@ type CertSummary struct {
 	IsCA               bool
 	DnsNames           []string
 	IpAddresses        []string
-	Violations         map[string]bool
-	MaxReputation      float32
-	IssuerInMozillaDB  bool
-	Timestamp          uint64
+	// OCSP responder, CRL distribution point and caIssuers URLs
+	OCSPServers            []string
+	CRLDistributionPoints  []string
+	IssuingCertificateURLs []string
+	// Certificate policy OIDs and the validation level they imply (see
+	// ClassifyValidationLevel)
+	PolicyOIDs      []string
+	ValidationLevel string
+	// SCTs embedded in the cert
+	SCTs       []SCT
+	Violations map[string]bool
+	// Checks that couldn't be evaluated (see FallibleCheck), with the reason.
+	// These are false in Violations, but the cert may well violate them.
+	CheckErrors   map[string]string
+	MaxReputation float32
+	// The root programs with a root that the cert chains to (see BuildPath)
+	// and that's trusted for websites as of the cert's notBefore, in the order
+	// they were given
+	RootPrograms []string
+	// The sha256 fingerprints of the validated path from the cert's issuer to
+	// its root, empty if the cert doesn't chain to any root program. Where
+	// the programs' paths differ, this is the path in the first program that
+	// trusts the cert.
+	Path []string
+	// The root the cert chains to, and the intermediate that issued it (empty
+	// if the root issued it directly)
+	Root         string
+	Intermediate string
+	// The root's RFC 4514 DN, the SPKIHash of its key, which identifies it,
+	// and the CA organisation that owns it (see RootOwner). Empty if the
+	// cert doesn't chain to any root program.
+	RootDN    string
+	RootKey   string
+	RootOwner string
+	Timestamp uint64
 }
 
 type IssuerReputationScore struct {
@@ -52,11 +136,45 @@ type IssuerReputationScore struct {
 	RawScore        float32
 }
 
+// The levels issuer reputation is computed at, for IssuerReputation.Level.
+const (
+	// The intermediate (or root) that issued the certs
+	REPUTATION_LEVEL_ISSUER = "Issuer"
+	// The root the certs chain to
+	REPUTATION_LEVEL_ROOT = "Root"
+	// The CA organisation that owns the issuer
+	REPUTATION_LEVEL_CA_OWNER = "CAOwner"
+)
+
 type IssuerReputation struct {
-	Issuer            string
-	IssuerInMozillaDB bool
-	Scores            map[string]*IssuerReputationScore
-	IsCA              uint64
+	// One of the REPUTATION_LEVEL_ constants
+	Level string
+	// Identifies the issuer (see CertSummary.IssuerKey), the root (see
+	// CertSummary.RootKey) or for a CA owner, the owner.
+	IssuerKey string
+	// The issuer's or root's RFC 4514 DN, for display, or the CA owner
+	Issuer string
+	// The CA organisation that owns the issuer or root (see
+	// CertSummary.CAOwner and CertSummary.RootOwner)
+	CAOwner string
+	// How many certs from this issuer chain to each root program (see
+	// CertSummary.RootPrograms)
+	RootPrograms map[string]uint64
+	Scores       map[string]*IssuerReputationScore
+	IsCA         uint64
+	// How many certs from this issuer point to each OCSP responder and CRL
+	// distribution point URL.
+	OCSPServers           map[string]uint64
+	CRLDistributionPoints map[string]uint64
+	// How many certs from this issuer have an embedded SCT from each CT log
+	// (see SCT.LogName).
+	CTLogs map[string]uint64
+	// The same reputation computed separately for each validation level
+	// (DV, OV, ...). These don't have a breakdown of their own.
+	ByValidationLevel map[string]*IssuerReputation
+	// The same reputation computed separately from the certs that chain to
+	// each root program. These don't have a breakdown of their own either.
+	ByRootProgram map[string]*IssuerReputation
 	// Issuer reputation, between [0, 1]. This is only affected by certs that
 	// have MaxReputation != -1
 	NormalizedScore float32
@@ -87,6 +205,16 @@ func TimeToJSONString(t time.Time) string {
 	return t.Format(layout)
 }
 
+// Returns whether the cert chains to a root in the named root program.
+func (summary *CertSummary) InRootProgram(name string) bool {
+	for _, program := range summary.RootPrograms {
+		if program == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (summary *CertSummary) ViolatesBR() bool {
 	for _, val := range summary.Violations {
 		if val {
@@ -119,31 +247,66 @@ func DistinguishedNameToString(n pkix.Name) string {
 	// so in theory there could be multiple values for Country, Organization, etc.
 	// (except for SerialNumber and CommonName, the former of which we're completely
 	// ignoring anyway). We'll just be lazy and take the first of each.
-	// Also, since our list of root CAs only uses Organization, OrganizationalUnit,
-	// and CommonName, we'll only consider those.
+	// Also, since the old root CA lists only used Organization,
+	// OrganizationalUnit, and CommonName, we'll only consider those.
 	maybeAppendFieldToBuffer(buffer, n.Organization, "O=")
 	maybeAppendFieldToBuffer(buffer, n.OrganizationalUnit, "OU=")
 	maybeAppendFieldToBuffer(buffer, []string{n.CommonName}, "CN=")
 	return buffer.String()
 }
 
-func containsIssuerInRootList(certChain []*x509.Certificate, rootCAMap map[string]bool) bool {
-	for _, cert := range certChain {
-		if rootCAMap[DistinguishedNameToString(cert.Issuer)] {
-			return true
-		}
-	}
-	return false
+// Returns an empty reputation for the month of timestamp for the issuer
+// identified by issuerKey (see IssuerKey), which is named issuer.
+func NewIssuerReputation(issuerKey string, issuer pkix.Name, timestamp uint64) *IssuerReputation {
+	return newLevelReputation(REPUTATION_LEVEL_ISSUER, issuerKey, issuer.String(), timestamp)
+}
+
+// Returns an empty reputation for the month of timestamp that rolls up the
+// certs that chain to the root identified by rootKey (see
+// CertSummary.RootKey), which is named root.
+func NewRootReputation(rootKey string, root string, timestamp uint64) *IssuerReputation {
+	return newLevelReputation(REPUTATION_LEVEL_ROOT, rootKey, root, timestamp)
 }
 
-func NewIssuerReputation(issuer pkix.Name, timestamp uint64) *IssuerReputation {
+// Returns an empty reputation for the month of timestamp that rolls up the
+// certs of all the issuers owned by the CA organisation owner (see CAOwner).
+func NewCAOwnerReputation(owner string, timestamp uint64) *IssuerReputation {
+	reputation := newLevelReputation(REPUTATION_LEVEL_CA_OWNER, owner, owner, timestamp)
+	reputation.CAOwner = owner
+	return reputation
+}
+
+func newLevelReputation(level string, key string, name string, timestamp uint64) *IssuerReputation {
+	reputation := newIssuerReputation(name, TruncateMonth(timestamp))
+	reputation.Level = level
+	reputation.IssuerKey = key
+	reputation.ByValidationLevel = make(map[string]*IssuerReputation)
+	reputation.ByRootProgram = make(map[string]*IssuerReputation)
+	return reputation
+}
+
+func newIssuerReputation(issuer string, beginTime uint64) *IssuerReputation {
 	reputation := new(IssuerReputation)
-	reputation.BeginTime = TruncateMonth(timestamp)
-	reputation.Issuer = DistinguishedNameToString(issuer)
+	reputation.BeginTime = beginTime
+	reputation.Issuer = issuer
+	reputation.RootPrograms = make(map[string]uint64)
 	reputation.Scores = make(map[string]*IssuerReputationScore)
+	reputation.OCSPServers = make(map[string]uint64)
+	reputation.CRLDistributionPoints = make(map[string]uint64)
+	reputation.CTLogs = make(map[string]uint64)
 	return reputation
 }
 
+// Returns an empty reputation for the same issuer and month, for a slice of
+// its certs (e.g. those of one validation level).
+func (issuer *IssuerReputation) newSlice() *IssuerReputation {
+	slice := newIssuerReputation(issuer.Issuer, issuer.BeginTime)
+	slice.Level = issuer.Level
+	slice.IssuerKey = issuer.IssuerKey
+	slice.CAOwner = issuer.CAOwner
+	return slice
+}
+
 func (score *IssuerReputationScore) Update(reputation float32) {
 	score.NormalizedScore += reputation
 	score.RawScore += 1
@@ -160,7 +323,16 @@ func (score *IssuerReputationScore) Finish(normalizedCount uint64,
 
 func (issuer *IssuerReputation) Update(summary *CertSummary) {
 	issuer.RawCount += 1
-	issuer.IssuerInMozillaDB = summary.IssuerInMozillaDB
+	owner := summary.CAOwner
+	if issuer.Level == REPUTATION_LEVEL_ROOT {
+		owner = summary.RootOwner
+	}
+	if len(owner) > 0 {
+		issuer.CAOwner = owner
+	}
+	for _, program := range summary.RootPrograms {
+		issuer.RootPrograms[program] += 1
+	}
 	reputation := summary.MaxReputation
 	if reputation != -1 {
 		// Keep track of certs issued for domains in Alexa
@@ -181,6 +353,35 @@ func (issuer *IssuerReputation) Update(summary *CertSummary) {
 	if summary.IsCA {
 		issuer.IsCA += 1
 	}
+
+	for _, ocspServer := range summary.OCSPServers {
+		issuer.OCSPServers[ocspServer] += 1
+	}
+	for _, crlDistributionPoint := range summary.CRLDistributionPoints {
+		issuer.CRLDistributionPoints[crlDistributionPoint] += 1
+	}
+	for _, sct := range summary.SCTs {
+		issuer.CTLogs[sct.LogName()] += 1
+	}
+
+	if issuer.ByValidationLevel != nil && len(summary.ValidationLevel) > 0 {
+		level := issuer.ByValidationLevel[summary.ValidationLevel]
+		if level == nil {
+			level = issuer.newSlice()
+			issuer.ByValidationLevel[summary.ValidationLevel] = level
+		}
+		level.Update(summary)
+	}
+	if issuer.ByRootProgram != nil {
+		for _, program := range summary.RootPrograms {
+			programReputation := issuer.ByRootProgram[program]
+			if programReputation == nil {
+				programReputation = issuer.newSlice()
+				issuer.ByRootProgram[program] = programReputation
+			}
+			programReputation.Update(summary)
+		}
+	}
 }
 
 func (issuer *IssuerReputation) Finish() {
@@ -193,70 +394,160 @@ func (issuer *IssuerReputation) Finish() {
 	}
 	issuer.NormalizedScore = normalizedSum / float32(len(issuer.Scores))
 	issuer.RawScore = rawSum / float32(len(issuer.Scores))
+	for _, level := range issuer.ByValidationLevel {
+		level.Finish()
+	}
+	for _, program := range issuer.ByRootProgram {
+		program.Finish()
+	}
+}
+
+// Returns a deep copy of issuer.
+func (issuer *IssuerReputation) clone() *IssuerReputation {
+	clone := *issuer
+	clone.Scores = make(map[string]*IssuerReputationScore)
+	for name, score := range issuer.Scores {
+		scoreCopy := *score
+		clone.Scores[name] = &scoreCopy
+	}
+	clone.RootPrograms = copyCounts(issuer.RootPrograms)
+	clone.OCSPServers = copyCounts(issuer.OCSPServers)
+	clone.CRLDistributionPoints = copyCounts(issuer.CRLDistributionPoints)
+	clone.CTLogs = copyCounts(issuer.CTLogs)
+	if issuer.ByValidationLevel != nil {
+		clone.ByValidationLevel = make(map[string]*IssuerReputation)
+		for level, reputation := range issuer.ByValidationLevel {
+			clone.ByValidationLevel[level] = reputation.clone()
+		}
+	}
+	if issuer.ByRootProgram != nil {
+		clone.ByRootProgram = make(map[string]*IssuerReputation)
+		for program, reputation := range issuer.ByRootProgram {
+			clone.ByRootProgram[program] = reputation.clone()
+		}
+	}
+	return &clone
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	countsCopy := make(map[string]uint64)
+	for key, count := range counts {
+		countsCopy[key] = count
+	}
+	return countsCopy
+}
+
+// Adds the certs counted by other, an unfinished reputation for the same
+// month, to issuer's, e.g. when they turn out to be of the same issuer.
+func (issuer *IssuerReputation) Merge(other *IssuerReputation) {
+	if len(issuer.CAOwner) == 0 {
+		issuer.CAOwner = other.CAOwner
+	}
+	addCounts(issuer.RootPrograms, other.RootPrograms)
+	for name, score := range other.Scores {
+		if issuer.Scores[name] == nil {
+			issuer.Scores[name] = new(IssuerReputationScore)
+		}
+		issuer.Scores[name].NormalizedScore += score.NormalizedScore
+		issuer.Scores[name].RawScore += score.RawScore
+	}
+	issuer.IsCA += other.IsCA
+	addCounts(issuer.OCSPServers, other.OCSPServers)
+	addCounts(issuer.CRLDistributionPoints, other.CRLDistributionPoints)
+	addCounts(issuer.CTLogs, other.CTLogs)
+	issuer.NormalizedCount += other.NormalizedCount
+	issuer.RawCount += other.RawCount
+	if issuer.ByValidationLevel != nil {
+		for level, reputation := range other.ByValidationLevel {
+			if issuer.ByValidationLevel[level] == nil {
+				issuer.ByValidationLevel[level] = issuer.newSlice()
+			}
+			issuer.ByValidationLevel[level].Merge(reputation)
+		}
+	}
+	if issuer.ByRootProgram != nil {
+		for program, reputation := range other.ByRootProgram {
+			if issuer.ByRootProgram[program] == nil {
+				issuer.ByRootProgram[program] = issuer.newSlice()
+			}
+			issuer.ByRootProgram[program].Merge(reputation)
+		}
+	}
+}
+
+func addCounts(counts map[string]uint64, other map[string]uint64) {
+	for key, count := range other {
+		counts[key] += count
+	}
+}
+
+// Returns a finished copy of issuer, leaving issuer itself open to further
+// updates. This is for reporting on a reputation that is still being
+// accumulated, e.g. across several runs.
+func (issuer *IssuerReputation) Finished() *IssuerReputation {
+	finished := issuer.clone()
+	finished.Finish()
+	return finished
 }
 
+// Returns the base64 SHA-256 fingerprint of cert, as in
+// CertSummary.Sha256Fingerprint.
+func Sha256Fingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Runs every registered check on cert and summarizes it. If some of cert's
+// names couldn't be ranked, the summary is still returned (with the
+// reputation of the names that could be), along with a *ReputationError for
+// the first name that couldn't.
 func CalculateCertSummary(cert *x509.Certificate, timestamp uint64, ranker *alexa.AlexaRank,
-	certChain []*x509.Certificate, rootCAMap map[string]bool) (result *CertSummary, err error) {
+	certChain []*x509.Certificate, rootPrograms []RootProgram) (result *CertSummary, err error) {
 	summary := CertSummary{}
+	summary.EntryType = ENTRY_TYPE_X509
 	summary.Timestamp = timestamp
 	summary.CN = cert.Subject.CommonName
 	summary.Issuer = DistinguishedNameToString(cert.Issuer)
+	summary.IssuerDN = cert.Issuer.String()
 	summary.NotBefore = TimeToJSONString(cert.NotBefore)
 	summary.NotAfter = TimeToJSONString(cert.NotAfter)
 	summary.IsCA = cert.IsCA
 	summary.Version = cert.Version
 	summary.SignatureAlgorithm = int(cert.SignatureAlgorithm)
-	summary.Violations = map[string]bool{
-		VALID_PERIOD_TOO_LONG:          false,
-		DEPRECATED_SIGNATURE_ALGORITHM: false,
-		DEPRECATED_VERSION:             cert.Version != 3,
-		KEY_TOO_SHORT:                  false,
-		EXP_TOO_SMALL:                  false,
-		MISSING_CN_IN_SAN:              false,
-	}
-
-	// BR 9.4.1: Validity period is longer than 5 years.  This
-	// should be restricted to certs that don't have CA:True
-	if cert.NotAfter.After(cert.NotBefore.AddDate(5, 0, 7)) &&
-		(!cert.BasicConstraintsValid ||
-			(cert.BasicConstraintsValid && !cert.IsCA)) {
-		summary.Violations[VALID_PERIOD_TOO_LONG] = true
-	}
-
-	// SignatureAlgorithm is SHA1
-	if cert.SignatureAlgorithm == x509.SHA1WithRSA ||
-		cert.SignatureAlgorithm == x509.DSAWithSHA1 ||
-		cert.SignatureAlgorithm == x509.ECDSAWithSHA1 {
-		summary.Violations[DEPRECATED_SIGNATURE_ALGORITHM] = true
-	}
-
-	// Public key length <= 1024 bits
-	summary.KeySize = -1
-	summary.Exp = -1
-	parsedKey, ok := cert.PublicKey.(*rsa.PublicKey)
-	if ok {
-		summary.KeySize = parsedKey.N.BitLen()
-		summary.Exp = parsedKey.E
-		if summary.KeySize <= 1024 {
-			summary.Violations[KEY_TOO_SHORT] = true
+	summary.Violations = make(map[string]bool)
+	for _, check := range registeredChecks {
+		if !CheckApplies(check, cert) {
+			summary.Violations[check.ID()] = false
+			continue
 		}
-		if summary.Exp <= 3 {
-			summary.Violations[EXP_TOO_SMALL] = true
+		violated, checkErr := RunCheck(check, cert, certChain)
+		summary.Violations[check.ID()] = violated
+		if checkErr != nil {
+			if summary.CheckErrors == nil {
+				summary.CheckErrors = make(map[string]string)
+			}
+			summary.CheckErrors[check.ID()] = checkErr.Error()
 		}
 	}
 
+	summarizeKey(cert, &summary)
+
 	if ranker != nil {
-		summary.MaxReputation, _ = ranker.GetReputation(cert.Subject.CommonName)
-		for _, host := range cert.DNSNames {
-			reputation, _ := ranker.GetReputation(host)
+		summary.MaxReputation = -1
+		for _, host := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+			reputation, rankErr := ranker.GetReputation(host)
+			if rankErr != nil {
+				if err == nil {
+					err = &ReputationError{host, rankErr}
+				}
+				continue
+			}
 			if reputation > summary.MaxReputation {
 				summary.MaxReputation = reputation
 			}
 		}
 	}
-	sha256hasher := sha256.New()
-	sha256hasher.Write(cert.Raw)
-	summary.Sha256Fingerprint = base64.StdEncoding.EncodeToString(sha256hasher.Sum(nil))
+	summary.Sha256Fingerprint = Sha256Fingerprint(cert)
 
 	// DNS names and IP addresses
 	summary.DnsNames = cert.DNSNames
@@ -264,53 +555,45 @@ func CalculateCertSummary(cert *x509.Certificate, timestamp uint64, ranker *alex
 		summary.IpAddresses = append(summary.IpAddresses, address.String())
 	}
 
-	summary.IssuerInMozillaDB = containsIssuerInRootList(certChain, rootCAMap)
+	summary.OCSPServers = cert.OCSPServer
+	summary.CRLDistributionPoints = cert.CRLDistributionPoints
+	summary.IssuingCertificateURLs = cert.IssuingCertificateURL
 
-	// Assume a 0-length CN means it isn't present (this isn't a good
-	// assumption). If the CN is missing, then it can't be missing CN in SAN.
-	if len(cert.Subject.CommonName) == 0 {
-		return &summary, nil
-	}
-
-	cnAsPunycode, err := idna.ToASCII(cert.Subject.CommonName)
-	if err != nil {
-		return &summary, nil
-	}
+	summary.PolicyOIDs = policyOIDStrings(cert)
+	summary.ValidationLevel = ClassifyValidationLevel(cert)
+	// A malformed SCT list is reported by InsufficientSCTs.
+	summary.SCTs, _ = ParseEmbeddedSCTs(cert)
 
-	// BR 9.2.2: Found Common Name in Subject Alt Names, either as an IP or a
-	// DNS name.
-	summary.Violations[MISSING_CN_IN_SAN] = true
-	cnAsIP := net.ParseIP(cert.Subject.CommonName)
-	if cnAsIP != nil {
-		for _, ip := range cert.IPAddresses {
-			if cnAsIP.Equal(ip) {
-				summary.Violations[MISSING_CN_IN_SAN] = false
-			}
+	// Attribute the cert to the path in the first program that trusts it, or
+	// failing that to the first path found.
+	var attributed *CertPath
+	attributedTrusted := false
+	for _, program := range rootPrograms {
+		path := BuildPath(cert, certChain, program.Roots)
+		if path == nil {
+			continue
 		}
-	} else {
-		for _, san := range cert.DNSNames {
-			if err == nil && strings.EqualFold(san, cnAsPunycode) {
-				summary.Violations[MISSING_CN_IN_SAN] = false
-			}
+		trusted := path.Root.TrustedForWebsites(cert.NotBefore)
+		if trusted {
+			summary.RootPrograms = append(summary.RootPrograms, program.Name)
+		}
+		if attributed == nil || (trusted && !attributedTrusted) {
+			attributed, attributedTrusted = path, trusted
 		}
 	}
-	return &summary, nil
-}
-
-// Takes the name of a file containing newline-delimited Subject Names (as
-// interpreted by DistinguishedNameToString) that each correspond to a
-// certificate in Mozilla's root CA program. Returns these names as a map of
-// string -> bool.
-func ReadRootCAMap(filename string) map[string]bool {
-	caStringBytes, err := ioutil.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open root CA list at %s: %s\n",
-			filename, err)
-		os.Exit(1)
-	}
-	rootCAMap := make(map[string]bool)
-	for _, ca := range strings.Split(string(caStringBytes), "\n") {
-		rootCAMap[ca] = true
+	issuer := FindIssuer(cert, certChain)
+	if attributed != nil {
+		summary.Path = attributed.Fingerprints()
+		summary.Root = DistinguishedNameToString(attributed.Root.Cert.Subject)
+		if len(attributed.Intermediates) > 0 {
+			summary.Intermediate = DistinguishedNameToString(attributed.Intermediates[0].Subject)
+		}
+		summary.RootDN = attributed.Root.Cert.Subject.String()
+		summary.RootKey = SPKIHash(attributed.Root.Cert)
+		summary.RootOwner = RootOwner(attributed.Root)
+		issuer = attributed.Issuer()
 	}
-	return rootCAMap
+	summary.IssuerKey = IssuerKey(cert, issuer)
+	summary.CAOwner = CAOwner(cert, attributed)
+	return &summary, err
 }
@@ -26,16 +26,22 @@ YW1wbGUuY29tMAsGCSqGSIb3DQEBBQNBAHKZKoS1wEQOGhgklx4+/yFYQlnqwKXvar/ZecQvJwui
 func TestCertSummary(t *testing.T) {
 	pemBlock, _ := pem.Decode([]byte(pemCertificate))
 	cert, _ := x509.ParseCertificate(pemBlock.Bytes)
-	fakeRootCAMap := make(map[string]bool)
+	fakeRootPrograms := []RootProgram{{ROOT_PROGRAM_MOZILLA, NewRootStore()}}
 	fakeCertList := make([]*x509.Certificate, 0)
 	ts := uint64(time.Now().Unix())
-	summary, _ := CalculateCertSummary(cert, ts, nil, fakeCertList, fakeRootCAMap)
+	summary, _ := CalculateCertSummary(cert, ts, nil, fakeCertList, fakeRootPrograms)
 	expected := CertSummary{
+		EntryType:          ENTRY_TYPE_X509,
 		CN:                 "test.example.com",
 		Issuer:             "O=Acme Co, CN=test.example.com",
+		IssuerDN:           "CN=test.example.com,O=Acme Co",
+		IssuerKey:          "keyid:01020304",
+		CAOwner:            "Acme Co",
 		Sha256Fingerprint:  "Gvp+Qw6i96YPjUZoO2zqLWdusngA8xpAtvMBouj+MZ8=",
 		NotBefore:          "Jan 1 1970",
 		NotAfter:           "Jan 2 1970",
+		KeyAlgorithm:       "RSA",
+		Curve:              "",
 		KeySize:            512,
 		Exp:                65537,
 		SignatureAlgorithm: 3,
@@ -43,13 +49,61 @@ func TestCertSummary(t *testing.T) {
 		IsCA:               true,
 		DnsNames:           []string{"test.example.com"},
 		IpAddresses:        nil,
+		PolicyOIDs:         []string{"1.2.3"},
+		ValidationLevel:    VALIDATION_LEVEL_UNKNOWN,
 		Violations: map[string]bool{
-			DEPRECATED_SIGNATURE_ALGORITHM: true,
-			DEPRECATED_VERSION:             false,
-			EXP_TOO_SMALL:                  false,
-			KEY_TOO_SHORT:                  true,
-			MISSING_CN_IN_SAN:              false,
-			VALID_PERIOD_TOO_LONG:          false,
+			DEPRECATED_SIGNATURE_ALGORITHM:    true,
+			DEPRECATED_VERSION:                false,
+			EXP_TOO_SMALL:                     false,
+			KEY_TOO_SHORT:                     true,
+			MISSING_CN_IN_SAN:                 false,
+			VALID_PERIOD_TOO_LONG:             false,
+			VALID_PERIOD_OVER_39_MONTHS:       false,
+			VALID_PERIOD_OVER_825_DAYS:        false,
+			VALID_PERIOD_OVER_398_DAYS:        false,
+			DISALLOWED_CURVE:                  false,
+			INVALID_EC_POINT:                  false,
+			DSA_KEY:                           false,
+			ROCA_FINGERPRINT:                  false,
+			DEBIAN_WEAK_KEY:                   false,
+			SMALL_PRIME_FACTOR:                false,
+			EVEN_EXPONENT:                     false,
+			FERMAT_FACTORABLE:                 false,
+			INTERNAL_NAME:                     false,
+			RESERVED_IP_ADDRESS:               false,
+			IP_ADDRESS_IN_DNS_NAME:            false,
+			DNS_NAME_UNDERSCORE:               false,
+			DNS_NAME_EMPTY_LABEL:              false,
+			DNS_NAME_LABEL_TOO_LONG:           false,
+			DNS_NAME_TRAILING_DOT:             false,
+			WILDCARD_NOT_LEFTMOST:             false,
+			PARTIAL_LABEL_WILDCARD:            false,
+			WILDCARD_ON_PUBLIC_SUFFIX:         false,
+			INVALID_PUNYCODE:                  false,
+			MISSING_SERVER_AUTH_EKU:           false,
+			ANY_EXTENDED_KEY_USAGE:            false,
+			INAPPROPRIATE_KEY_USAGE:           false,
+			SUBSCRIBER_CA_TRUE:                false,
+			CA_BASIC_CONSTRAINTS_NOT_CRITICAL: false,
+			CA_MISSING_KEY_CERT_SIGN:          false,
+			MISSING_REVOCATION_POINTER:        false,
+			MISSING_ISSUING_CERTIFICATE_URL:   false,
+			MALFORMED_REVOCATION_URL:          false,
+			DV_WITH_ORGANIZATION:              false,
+			OV_MISSING_ORGANIZATION:           false,
+			IV_MISSING_INDIVIDUAL:             false,
+			EV_MISSING_JURISDICTION:           false,
+			EV_MISSING_SERIAL_NUMBER:          false,
+			EV_MISSING_BUSINESS_CATEGORY:      false,
+			SERIAL_NUMBER_NOT_POSITIVE:        false,
+			SERIAL_NUMBER_TOO_LONG:            false,
+			SERIAL_NUMBER_LOW_ENTROPY:         false,
+			INVALID_COUNTRY_CODE:              false,
+			SUBJECT_FIELD_TOO_LONG:            false,
+			SUBJECT_PLACEHOLDER_VALUE:         false,
+			SUBJECT_WHITESPACE:                false,
+			SUBJECT_BAD_STRING_ENCODING:       false,
+			INSUFFICIENT_SCTS:                 false,
 		},
 		MaxReputation: 0,
 		Timestamp:     ts,
@@ -75,9 +129,8 @@ func TestIssuerReputation(t *testing.T) {
 			EXP_TOO_SMALL:                  false,
 			MISSING_CN_IN_SAN:              true,
 		},
-		MaxReputation:     0.1,
-		IssuerInMozillaDB: false,
-		Timestamp:         ts,
+		MaxReputation: 0.1,
+		Timestamp:     ts,
 	}
 	unknown_summary := CertSummary{
 		CN:                "unknown.example.com",
@@ -91,10 +144,9 @@ func TestIssuerReputation(t *testing.T) {
 			EXP_TOO_SMALL:                  false,
 			MISSING_CN_IN_SAN:              true,
 		},
-		IsCA:              false,
-		MaxReputation:     -1,
-		IssuerInMozillaDB: false,
-		Timestamp:         ts,
+		IsCA:          false,
+		MaxReputation: -1,
+		Timestamp:     ts,
 	}
 	// SEQUENCE of SET of SEQUENCE of OID (CN), PrintableString ("Honest Al")
 	subjectBytes := []byte{0x30, 0x14, 0x31, 0x12, 0x30, 0x10, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x09, 0x48, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x20, 0x41, 0x6c}
@@ -105,7 +157,7 @@ func TestIssuerReputation(t *testing.T) {
 	}
 	var name pkix.Name
 	name.FillFromRDNSequence(&subject)
-	issuer := NewIssuerReputation(name, ts)
+	issuer := NewIssuerReputation("honest-al", name, ts)
 	issuer.Update(&summary)
 	issuer.Update(&unknown_summary)
 	issuer.Finish()
@@ -118,11 +170,14 @@ func TestIssuerReputation(t *testing.T) {
 	if issuer.Scores[VALID_PERIOD_TOO_LONG].NormalizedScore != 0.9 {
 		t.Error("Should have score of 0.9")
 	}
-	if issuer.IssuerInMozillaDB {
-		t.Error("Should not be in mozilla db")
+	if len(issuer.RootPrograms) != 0 {
+		t.Error("Should not be in any root program")
 	}
 	expected_issuer := IssuerReputation{
-		Issuer: "CN=Honest Al",
+		Level:        REPUTATION_LEVEL_ISSUER,
+		IssuerKey:    "honest-al",
+		Issuer:       "CN=Honest Al",
+		RootPrograms: map[string]uint64{},
 		Scores: map[string]*IssuerReputationScore{
 			DEPRECATED_SIGNATURE_ALGORITHM: {
 				NormalizedScore: 1,
@@ -149,12 +204,17 @@ func TestIssuerReputation(t *testing.T) {
 				RawScore:        0,
 			},
 		},
-		IsCA:            0,
-		NormalizedScore: 0.9666667,
-		RawScore:        0.6666667,
-		NormalizedCount: 1,
-		RawCount:        2,
-		BeginTime:       TruncateMonth(ts),
+		IsCA:                  0,
+		OCSPServers:           map[string]uint64{},
+		CRLDistributionPoints: map[string]uint64{},
+		CTLogs:                map[string]uint64{},
+		ByValidationLevel:     map[string]*IssuerReputation{},
+		ByRootProgram:         map[string]*IssuerReputation{},
+		NormalizedScore:       0.9666667,
+		RawScore:              0.6666667,
+		NormalizedCount:       1,
+		RawCount:              2,
+		BeginTime:             TruncateMonth(ts),
 	}
 	b, _ := json.MarshalIndent(issuer, "", "  ")
 	expected_b, _ := json.MarshalIndent(expected_issuer, "", "  ")
@@ -162,3 +222,121 @@ func TestIssuerReputation(t *testing.T) {
 		t.Errorf("Didn't get expected reputation: %s \n!= \n%s\n", expected_b, b)
 	}
 }
+
+func TestIssuerReputationFinished(t *testing.T) {
+	summary := CertSummary{
+		Issuer:        "CN=Honest Al",
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: true},
+		MaxReputation: 0.5,
+	}
+	issuer := newIssuerReputation("CN=Honest Al", 0)
+	issuer.ByValidationLevel = make(map[string]*IssuerReputation)
+	issuer.Update(&summary)
+	finished := issuer.Finished()
+	if finished.Scores[VALID_PERIOD_TOO_LONG].NormalizedScore != 0.5 {
+		t.Error("Should have finished score of 0.5")
+	}
+	if issuer.Scores[VALID_PERIOD_TOO_LONG].RawScore != 1 {
+		t.Error("Finished should leave the original unfinished")
+	}
+	issuer.Update(&summary)
+	if finished.RawCount != 1 || issuer.RawCount != 2 {
+		t.Error("Updates after Finished shouldn't affect the finished copy")
+	}
+	if issuer.Finished().Scores[VALID_PERIOD_TOO_LONG].RawScore != 0 {
+		t.Error("Should have raw score of 0")
+	}
+}
+
+func TestIssuerReputationMerge(t *testing.T) {
+	violating := CertSummary{
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: true},
+		MaxReputation: -1,
+		RootPrograms:  []string{ROOT_PROGRAM_MOZILLA},
+	}
+	compliant := CertSummary{
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: false},
+		MaxReputation: -1,
+	}
+	issuer := NewIssuerReputation("spki", pkix.Name{CommonName: "Honest Al"}, 0)
+	issuer.Update(&compliant)
+	other := NewIssuerReputation("keyid:01", pkix.Name{CommonName: "Honest Al"}, 0)
+	other.Update(&violating)
+	issuer.Merge(other)
+	if issuer.RawCount != 2 || issuer.RootPrograms[ROOT_PROGRAM_MOZILLA] != 1 {
+		t.Errorf("Expected both certs to be counted, got %d", issuer.RawCount)
+	}
+	finished := issuer.Finished()
+	if finished.RawScore != 0.5 {
+		t.Errorf("Expected a raw score of 0.5, got %f", finished.RawScore)
+	}
+	mozilla := finished.ByRootProgram[ROOT_PROGRAM_MOZILLA]
+	if mozilla == nil || mozilla.RawCount != 1 || mozilla.IssuerKey != "spki" {
+		t.Error("Should have merged the other's root program slice")
+	}
+}
+
+func TestIssuerReputationByRootProgram(t *testing.T) {
+	trusted := CertSummary{
+		Issuer:        "CN=Honest Al",
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: true},
+		MaxReputation: -1,
+		RootPrograms:  []string{ROOT_PROGRAM_MOZILLA, ROOT_PROGRAM_APPLE},
+	}
+	untrusted := CertSummary{
+		Issuer:        "CN=Honest Al",
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: false},
+		MaxReputation: -1,
+	}
+	issuer := newIssuerReputation("CN=Honest Al", 0)
+	issuer.ByRootProgram = make(map[string]*IssuerReputation)
+	issuer.Update(&trusted)
+	issuer.Update(&untrusted)
+	issuer.Update(&untrusted)
+	issuer.Update(&untrusted)
+	if issuer.RootPrograms[ROOT_PROGRAM_MOZILLA] != 1 ||
+		issuer.RootPrograms[ROOT_PROGRAM_APPLE] != 1 || len(issuer.RootPrograms) != 2 {
+		t.Errorf("Unexpected root programs %v", issuer.RootPrograms)
+	}
+	finished := issuer.Finished()
+	if finished.RawScore != 0.75 {
+		t.Errorf("Expected a raw score of 0.75, got %f", finished.RawScore)
+	}
+	mozilla := finished.ByRootProgram[ROOT_PROGRAM_MOZILLA]
+	if mozilla == nil || mozilla.RawCount != 1 || mozilla.RawScore != 0 {
+		t.Error("Mozilla's slice should only count the trusted cert")
+	}
+	if finished.ByRootProgram[ROOT_PROGRAM_MICROSOFT] != nil {
+		t.Error("Shouldn't have a slice for a program no cert chains to")
+	}
+	if issuer.ByRootProgram[ROOT_PROGRAM_MOZILLA].Scores[VALID_PERIOD_TOO_LONG].RawScore != 1 {
+		t.Error("Finished should leave the original's slices unfinished")
+	}
+}
+
+func TestIssuerReputationLevels(t *testing.T) {
+	summary := CertSummary{
+		Violations:    map[string]bool{VALID_PERIOD_TOO_LONG: true},
+		MaxReputation: -1,
+		CAOwner:       "Subordinate Co",
+		RootKey:       "root-key",
+		RootOwner:     "Root Co",
+	}
+	root := NewRootReputation("root-key", "CN=Root", 0)
+	owner := NewCAOwnerReputation("Subordinate Co", 0)
+	for _, reputation := range []*IssuerReputation{root, owner} {
+		reputation.Update(&summary)
+		if reputation.RawCount != 1 || reputation.Scores[VALID_PERIOD_TOO_LONG].RawScore != 1 {
+			t.Errorf("The %s reputation should count the cert", reputation.Level)
+		}
+	}
+	if root.Level != REPUTATION_LEVEL_ROOT || root.Issuer != "CN=Root" ||
+		root.CAOwner != "Root Co" {
+		t.Errorf("Unexpected root reputation %s %s %s", root.Level, root.Issuer, root.CAOwner)
+	}
+	if owner.Level != REPUTATION_LEVEL_CA_OWNER || owner.IssuerKey != "Subordinate Co" ||
+		owner.CAOwner != "Subordinate Co" {
+		t.Errorf("Unexpected CA owner reputation %s %s %s", owner.Level, owner.IssuerKey,
+			owner.CAOwner)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/monicachew/certificatetransparency"
+	. "github.com/mozkeeler/sunlight"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	LINT_PASS           = "pass"
+	LINT_FAIL           = "fail"
+	LINT_NOT_APPLICABLE = "notApplicable"
+	LINT_NOT_EVALUATED  = "notEvaluated"
+)
+
+// The result of one check for one certificate.
+type lintResult struct {
+	ID        string
+	BRSection string
+	Severity  string
+	Result    string
+	// Why the check couldn't be evaluated, for LINT_NOT_EVALUATED
+	Error string `json:",omitempty"`
+}
+
+// Everything lint found out about one certificate.
+type lintReport struct {
+	// The file the certificate was read from, and its position in the file
+	Source            string
+	Index             uint64
+	Subject           string
+	Issuer            string
+	Sha256Fingerprint string
+	EntryType         string
+	Results           []lintResult
+	// Whether any check with error severity failed
+	HasErrors bool
+}
+
+// Returns the certificates in each of names (see OpenCertSource), or stdin
+// if there are none.
+func readLintCerts(names []string) ([]*x509.Certificate, []lintReport, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	var certs []*x509.Certificate
+	var reports []lintReport
+	for _, name := range names {
+		source, err := OpenCertSource(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == "-" {
+			name = "stdin"
+		}
+		source.Map(func(ent *certificatetransparency.EntryAndPosition, entErr error) {
+			if err != nil {
+				return
+			}
+			if entErr != nil {
+				err = entErr
+				return
+			}
+			cert, entErr := x509.ParseCertificate(ent.Entry.X509Cert)
+			if entErr != nil {
+				err = entErr
+				return
+			}
+			certs = append(certs, cert)
+			reports = append(reports, lintReport{Source: name, Index: ent.Index})
+		}, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return certs, reports, nil
+}
+
+// Returns a reference to section as it appears in the BRs, e.g. "BR 9.4.1".
+// Sections of other documents (e.g. "EV 9.2.3") already say which document
+// they're from.
+func sectionReference(section string) string {
+	if len(section) > 0 && (unicode.IsDigit(rune(section[0])) ||
+		strings.HasPrefix(section, "Appendix")) {
+		return "BR " + section
+	}
+	return section
+}
+
+// Runs every check on cert and fills in report.
+func lintCert(cert *x509.Certificate, chain []*x509.Certificate, report *lintReport) error {
+	// Certificates that weren't logged are checked as of their notBefore.
+	timestamp := uint64(cert.NotBefore.UnixNano() / 1000000)
+	var summary *CertSummary
+	var err error
+	if IsPrecertificate(cert) {
+		summary, err = CalculatePrecertSummary(cert, timestamp, nil, chain, nil)
+	} else {
+		summary, err = CalculateCertSummary(cert, timestamp, nil, chain, nil)
+	}
+	if err != nil {
+		return err
+	}
+	report.Subject = DistinguishedNameToString(cert.Subject)
+	report.Issuer = summary.Issuer
+	report.Sha256Fingerprint = summary.Sha256Fingerprint
+	report.EntryType = summary.EntryType
+	for _, check := range Checks() {
+		result := lintResult{check.ID(), check.BRSection(),
+			check.Severity().String(), LINT_PASS, ""}
+		if !CheckApplies(check, cert) {
+			result.Result = LINT_NOT_APPLICABLE
+		} else if checkErr, ok := summary.CheckErrors[check.ID()]; ok {
+			result.Result = LINT_NOT_EVALUATED
+			result.Error = checkErr
+		} else if summary.Violations[check.ID()] {
+			result.Result = LINT_FAIL
+			if check.Severity() == SEVERITY_ERROR {
+				report.HasErrors = true
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	return nil
+}
+
+func writeLintText(out io.Writer, reports []lintReport) {
+	for _, report := range reports {
+		fmt.Fprintf(out, "%s #%d: %s issued by %s (%s)\n", report.Source,
+			report.Index, report.Subject, report.Issuer, report.Sha256Fingerprint)
+		failures := 0
+		for _, result := range report.Results {
+			if result.Result == LINT_FAIL {
+				failures += 1
+			}
+			fmt.Fprintf(out, "  %-13s %-7s %-32s %s\n", result.Result,
+				result.Severity, result.ID, sectionReference(result.BRSection))
+			if len(result.Error) > 0 {
+				fmt.Fprintf(out, "    %s\n", result.Error)
+			}
+		}
+		fmt.Fprintf(out, "  %d of %d checks failed\n\n", failures, len(report.Results))
+	}
+}
+
+// Returns the SARIF level for a check's severity.
+func sarifLevel(severity string) string {
+	switch severity {
+	case SEVERITY_ERROR.String():
+		return "error"
+	case SEVERITY_WARNING.String():
+		return "warning"
+	}
+	return "note"
+}
+
+// Writes reports as a SARIF 2.1.0 log, with a rule for each check and a
+// result for each failure, for tools that collect findings in that format.
+func writeLintSARIF(out io.Writer, reports []lintReport) error {
+	var rules []interface{}
+	for _, check := range Checks() {
+		rules = append(rules, map[string]interface{}{
+			"id":               check.ID(),
+			"shortDescription": map[string]string{"text": check.ID()},
+			"defaultConfiguration": map[string]string{
+				"level": sarifLevel(check.Severity().String()),
+			},
+			"properties": map[string]string{
+				"section": sectionReference(check.BRSection()),
+			},
+		})
+	}
+	results := make([]interface{}, 0)
+	for _, report := range reports {
+		for _, result := range report.Results {
+			if result.Result != LINT_FAIL {
+				continue
+			}
+			results = append(results, map[string]interface{}{
+				"ruleId": result.ID,
+				"level":  sarifLevel(result.Severity),
+				"message": map[string]string{
+					"text": fmt.Sprintf("Certificate %d (%s) violates %s",
+						report.Index, report.Subject, sectionReference(result.BRSection)),
+				},
+				"locations": []interface{}{map[string]interface{}{
+					"physicalLocation": map[string]interface{}{
+						"artifactLocation": map[string]string{"uri": report.Source},
+					},
+				}},
+				"fingerprints": map[string]string{
+					"sha256Fingerprint": report.Sha256Fingerprint,
+				},
+			})
+		}
+	}
+	log := map[string]interface{}{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":  "sunlight",
+					"rules": rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+// Checks the certificates named in args and prints the results. Returns the
+// exit status: 0 if no check with error severity failed, 1 if one did and 2
+// if the certificates couldn't be checked.
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	chainFile := flags.String("chain", "",
+		"file of intermediate certificates to check the certificates with")
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lint [flags] [certificate files, or - for stdin]\n",
+			os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		flags.Usage()
+		return 2
+	}
+
+	certs, reports, err := readLintCerts(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read certificates: %s\n", err)
+		return 2
+	}
+	if len(certs) == 0 {
+		fmt.Fprintf(os.Stderr, "No certificates to check\n")
+		return 2
+	}
+	var chain []*x509.Certificate
+	if len(*chainFile) > 0 {
+		chain, _, err = readLintCerts([]string{*chainFile})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read chain: %s\n", err)
+			return 2
+		}
+	}
+
+	status := 0
+	for i, cert := range certs {
+		if err := lintCert(cert, chain, &reports[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to check %s #%d: %s\n",
+				reports[i].Source, reports[i].Index, err)
+			return 2
+		}
+		if reports[i].HasErrors {
+			status = 1
+		}
+	}
+
+	switch *format {
+	case "text":
+		writeLintText(os.Stdout, reports)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(reports)
+	case "sarif":
+		err = writeLintSARIF(os.Stdout, reports)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write results: %s\n", err)
+		return 2
+	}
+	return status
+}
@@ -11,9 +11,11 @@ import (
 	"github.com/monicachew/alexa"
 	"github.com/monicachew/certificatetransparency"
 	. "github.com/mozkeeler/sunlight"
+	"github.com/mozkeeler/sunlight/ctlog"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,18 +24,60 @@ import (
 var alexaFile string
 var dbFile string
 var ctLog string
+var ctLogURL string
+var ctLogKeyFile string
 var jsonFile string
 var maxEntries uint64
 var rootCAFile string
+var rootProgramFiles string
+var caOwnersFile string
+var debianWeakKeysFiles string
+var publicSuffixFile string
+var evPolicyOIDsFile string
+var ctLogListFile string
+var ctPolicyFile string
+var checkpointInterval uint64
+var certSources string
 
 func init() {
 	flag.StringVar(&alexaFile, "alexa_file", "top-1m.csv",
 		"CSV containing <rank, domain>")
 	flag.StringVar(&dbFile, "db_file", "BRs.db", "File for creating sqlite DB")
-	flag.StringVar(&ctLog, "ct_log", "ct_entries.log", "File containing CT log")
+	flag.StringVar(&ctLog, "ct_log", "ct_entries.log",
+		"comma-separated list of files containing CT logs (only read by default "+
+			"if neither ct_log_url nor certs is given)")
+	flag.StringVar(&ctLogURL, "ct_log_url", "",
+		"comma-separated list of URLs of CT logs to scan directly")
+	flag.StringVar(&ctLogKeyFile, "ct_log_key", "",
+		"comma-separated list of PEM files with the public keys of the logs at "+
+			"ct_log_url, in the same order")
 	flag.StringVar(&jsonFile, "json_file", "certs.json", "JSON summary output")
 	flag.Uint64Var(&maxEntries, "max_entries", 0, "Max entries (0 means all)")
-	flag.StringVar(&rootCAFile, "rootCA_file", "rootCAList.txt", "list of root CA CNs")
+	flag.StringVar(&rootCAFile, "rootCA_file", "certdata.txt",
+		"Mozilla's root store: an NSS certdata.txt, CCADB CSV export or PEM bundle "+
+			"(see README.md for where to get one)")
+	flag.StringVar(&rootProgramFiles, "root_programs", "",
+		"comma-separated list of name=file root stores of other root programs, "+
+			"in the formats rootCA_file takes (e.g. Microsoft=microsoft.csv,Apple=apple.pem)")
+	flag.StringVar(&caOwnersFile, "ca_owners", "",
+		"CSV mapping intermediates and roots to the CA organisations that own them "+
+			"(see LoadOwnerMap)")
+	flag.StringVar(&debianWeakKeysFiles, "debian_weak_keys", "",
+		"comma-separated list of Debian openssl-blacklist files")
+	flag.StringVar(&publicSuffixFile, "public_suffix_file", "",
+		"public_suffix_list.dat to use instead of the bundled copy")
+	flag.StringVar(&evPolicyOIDsFile, "ev_policy_oids", "",
+		"file of CA-specific EV policy OIDs, one per line")
+	flag.StringVar(&ctLogListFile, "ct_log_list", "",
+		"log_list.json mapping CT log IDs to names and operators")
+	flag.StringVar(&ctPolicyFile, "ct_policy", "",
+		"JSON list of {MaxLifetimeDays, MinSCTs} rules to use instead of Chrome's")
+	flag.StringVar(&certSources, "certs", "",
+		"comma-separated list of certificate inventories to check as well as CT "+
+			"logs: directories, .zip/.tar/.tar.gz archives or files of PEM, DER or "+
+			"base64 (one per line) certificates, or - for a PEM bundle on stdin")
+	flag.Uint64Var(&checkpointInterval, "checkpoint_interval", 10000,
+		"Entries of ct_log_url to process between commits (0 means only at the end)")
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
 
@@ -47,15 +91,629 @@ func certToString(cert *x509.Certificate) string {
 	return "-----BEGIN CERTIFICATE-----\r\n" + b64WithNewlines + "\r\n-----END CERTIFICATE-----\r\n"
 }
 
+// Formats each of columnFormats with the column name prefix of every
+// registered check and joins the results into a comma-separated list.
+func checkColumns(columnFormats ...string) string {
+	columns := make([]string, 0)
+	for _, check := range Checks() {
+		for _, format := range columnFormats {
+			columns = append(columns, fmt.Sprintf(format, ColumnName(check.ID())))
+		}
+	}
+	return strings.Join(columns, ",\n\t\t")
+}
+
+// The columns for each registered check in the baselineRequirements, issuer
+// reputation and examples tables.
+var resultColumns = checkColumns("%s bool")
+var reputationScoreColumns = checkColumns("%[1]sNormalizedScore float",
+	"%[1]sRawScore float")
+var exampleColumns = checkColumns("%[1]sExample text", "%[1]sLastSeen bigint")
+
+// The columns shared by the issuerReputation, rootReputation and
+// caOwnerReputation tables. Issuers are identified by issuerKey (see
+// IssuerKey); issuer is their DN, for display. For roots, these are the
+// root's key and DN, and for CA owners, both are the owner.
+var issuerReputationColumns = `issuerKey text,
+		issuer text,
+		caOwner text,
+		rootPrograms text,
+		` + reputationScoreColumns + `,
+		normalizedScore float,
+		rawScore float,
+		normalizedCount integer,
+		rawCount integer,
+		beginTime bigint,
+		ocspServers text,
+		crlDistributionPoints text,
+		ctLogs text`
+
+var issuerReputationInsertColumns = `issuerKey,
+		issuer,
+		caOwner,
+		rootPrograms,
+		` + checkColumns("%[1]sNormalizedScore", "%[1]sRawScore") + `,
+		normalizedScore, rawScore,
+		normalizedCount, rawCount, beginTime,
+		ocspServers, crlDistributionPoints, ctLogs`
+
+var issuerReputationInsertCount = 12 + 2*len(Checks())
+
+// Returns the values for issuerReputationInsertColumns.
+func issuerReputationArgs(issuer *IssuerReputation) []interface{} {
+	args := []interface{}{issuer.IssuerKey, issuer.Issuer, issuer.CAOwner,
+		toJSON(issuer.RootPrograms)}
+	for _, check := range Checks() {
+		score := issuer.Scores[check.ID()]
+		args = append(args, score.NormalizedScore, score.RawScore)
+	}
+	return append(args, issuer.NormalizedScore,
+		issuer.RawScore,
+		issuer.NormalizedCount,
+		issuer.RawCount,
+		issuer.BeginTime,
+		toJSON(issuer.OCSPServers),
+		toJSON(issuer.CRLDistributionPoints),
+		toJSON(issuer.CTLogs))
+}
+
+// Writes the reputations that changed of a roll-up of issuer reputations
+// (rootReputation or caOwnerReputation) in tx, along with their state.
+func commitRollUps(tx *sql.Tx, table string, insert *sql.Stmt,
+	reputations map[string]*IssuerReputation, changed map[string]bool) {
+	for key := range changed {
+		reputation := reputations[key]
+		_, err := tx.Exec(`
+			insert or replace into `+table+`State(issuerKey, state)
+			values(?, ?)`, key, toJSON(reputation))
+		if err == nil {
+			_, err = tx.Exec(`
+				delete from `+table+`
+				where issuerKey = ? and beginTime = ?`, reputation.IssuerKey,
+				reputation.BeginTime)
+		}
+		if err == nil {
+			_, err = tx.Stmt(insert).Exec(issuerReputationArgs(reputation.Finished())...)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Returns Mozilla's root program from rootCA_file followed by the ones in
+// root_programs.
+func loadRootPrograms() []RootProgram {
+	names := []string{ROOT_PROGRAM_MOZILLA}
+	filenames := []string{rootCAFile}
+	if len(rootProgramFiles) > 0 {
+		for _, program := range strings.Split(rootProgramFiles, ",") {
+			nameAndFile := strings.SplitN(program, "=", 2)
+			if len(nameAndFile) != 2 || len(nameAndFile[0]) == 0 {
+				fmt.Fprintf(os.Stderr, "root_programs entries must be name=file, not %s\n",
+					program)
+				os.Exit(1)
+			}
+			names = append(names, nameAndFile[0])
+			filenames = append(filenames, nameAndFile[1])
+		}
+	}
+	var programs []RootProgram
+	for i, name := range names {
+		roots, err := LoadRootStore(filenames[i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load %s's root store: %s\n", name, err)
+			os.Exit(1)
+		}
+		for _, skipped := range roots.Skipped() {
+			fmt.Fprintf(os.Stderr, "Skipping root in %s's root store: %s\n", name, skipped)
+		}
+		programs = append(programs, RootProgram{Name: name, Roots: roots})
+	}
+	return programs
+}
+
+// Returns the JSON encoding of v for storing in a text column.
+func toJSON(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to convert to JSON: %s\n", err)
+		os.Exit(1)
+	}
+	return b
+}
+
+// Returns the checkpoint saved for log (a log URL or entries file) by an
+// earlier run, or nil if there isn't one.
+func readCheckpoint(db *sql.DB, log string) *ctlog.Checkpoint {
+	checkpoint := new(ctlog.Checkpoint)
+	var treeHead, merkleTree []byte
+	err := db.QueryRow(`
+		select nextIndex, treeHead, merkleTree
+		from checkpoints where log = ?`, log).Scan(
+		&checkpoint.NextIndex, &treeHead, &merkleTree)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	var hashes [][]byte
+	if err == nil {
+		err = json.Unmarshal(treeHead, &checkpoint.TreeHead)
+	}
+	if err == nil {
+		err = json.Unmarshal(merkleTree, &hashes)
+	}
+	// Only scans of a log keep track of its Merkle tree.
+	if err == nil && checkpoint.TreeHead != nil {
+		checkpoint.Tree, err = ctlog.NewMerkleTreeFromHashes(checkpoint.NextIndex, hashes)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read checkpoint: %s\n", err)
+		os.Exit(1)
+	}
+	return checkpoint
+}
+
+// Saves checkpoint as the point log has been processed up to.
+func writeCheckpoint(tx *sql.Tx, log string, checkpoint *ctlog.Checkpoint) {
+	var treeSize uint64
+	var rootHash string
+	var hashes [][]byte
+	if checkpoint.TreeHead != nil {
+		treeSize = checkpoint.TreeHead.TreeSize
+		rootHash = base64.StdEncoding.EncodeToString(checkpoint.TreeHead.SHA256RootHash)
+	}
+	if checkpoint.Tree != nil {
+		hashes = checkpoint.Tree.Hashes()
+	}
+	_, err := tx.Exec(`
+		insert or replace into checkpoints(
+			log, nextIndex, treeSize, rootHash, treeHead, merkleTree)
+		values(?, ?, ?, ?, ?, ?)`, log, checkpoint.NextIndex, treeSize,
+		rootHash, toJSON(checkpoint.TreeHead), toJSON(hashes))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Returns the unfinished reputations saved in stateTable by earlier runs, by
+// issuer (or CA owner) and month.
+func readIssuerReputations(db *sql.DB, stateTable string) map[string]*IssuerReputation {
+	issuers := make(map[string]*IssuerReputation)
+	rows, err := db.Query(fmt.Sprintf("select issuerKey, state from %s", stateTable))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read issuer reputations: %s\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var state []byte
+		issuer := new(IssuerReputation)
+		err = rows.Scan(&key, &state)
+		if err == nil {
+			err = json.Unmarshal(state, issuer)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read issuer reputations: %s\n", err)
+			os.Exit(1)
+		}
+		issuers[key] = issuer
+	}
+	return issuers
+}
+
+// Returns the issuers of "keyid:" issuer keys learned by earlier runs.
+func readIssuerKeyMap(db *sql.DB) *IssuerKeyMap {
+	keys := NewIssuerKeyMap()
+	rows, err := db.Query("select keyId, issuerKey from issuerKeyIds")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read issuer key ids: %s\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var keyId, issuerKey string
+		if err := rows.Scan(&keyId, &issuerKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read issuer key ids: %s\n", err)
+			os.Exit(1)
+		}
+		keys.Add(keyId, issuerKey)
+	}
+	return keys
+}
+
+// Looks up and records serial numbers in the issuerSerialNumberEntries table.
+// The statements are those of the current batch's transaction, so that the
+// serials of the batch's own entries are seen too.
+type dbSerialNumberStore struct {
+	lookup *sql.Stmt
+	insert *sql.Stmt
+}
+
+func (store *dbSerialNumberStore) Fingerprints(issuerKey string,
+	serial string) ([]string, error) {
+	rows, err := store.lookup.Query(issuerKey, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fingerprints []string
+	for rows.Next() {
+		var fingerprint string
+		if err := rows.Scan(&fingerprint); err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints, rows.Err()
+}
+
+func (store *dbSerialNumberStore) Add(issuerKey string, serial string,
+	fingerprint string) error {
+	_, err := store.insert.Exec(issuerKey, serial, fingerprint)
+	return err
+}
+
+// Returns the serial number counts of each issuer seen by earlier runs. The
+// serials themselves stay in store.
+func readIssuerSerialNumbers(db *sql.DB,
+	store SerialNumberStore) map[string]*IssuerSerialNumbers {
+	issuerSerials := make(map[string]*IssuerSerialNumbers)
+	rows, err := db.Query(`
+		select issuerKey, certCount, repeatedCount, sequentialCount
+		from issuerSerialNumbers`)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read serial numbers: %s\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var issuerKey string
+		var certCount, repeatedCount, sequentialCount uint64
+		err := rows.Scan(&issuerKey, &certCount, &repeatedCount, &sequentialCount)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read serial numbers: %s\n", err)
+			os.Exit(1)
+		}
+		serials := NewIssuerSerialNumbers(issuerKey, store)
+		serials.CertCount = certCount
+		serials.RepeatedCount = repeatedCount
+		serials.SequentialCount = sequentialCount
+		issuerSerials[issuerKey] = serials
+	}
+	return issuerSerials
+}
+
+// Looks up and records the hashes PrecertPairs compares in the precertHashes
+// table, in the transaction of the current batch as for
+// dbSerialNumberStore. Only final certificates have their fingerprint and
+// timestamp recorded.
+type dbPrecertHashStore struct {
+	lookup *sql.Stmt
+	insert *sql.Stmt
+}
+
+func (store *dbPrecertHashStore) Hashes(issuerKey, serialNumber string) (string,
+	string, PrecertMismatch, error) {
+	var precertHash, finalHash string
+	final := PrecertMismatch{IssuerKey: issuerKey, SerialNumber: serialNumber}
+	rows, err := store.lookup.Query(issuerKey, serialNumber)
+	if err != nil {
+		return "", "", final, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryType, hash string
+		var fingerprint sql.NullString
+		var timestamp sql.NullInt64
+		if err := rows.Scan(&entryType, &hash, &fingerprint, &timestamp); err != nil {
+			return "", "", final, err
+		}
+		if entryType == ENTRY_TYPE_PRECERT && len(precertHash) == 0 {
+			precertHash = hash
+		} else if entryType != ENTRY_TYPE_PRECERT && len(finalHash) == 0 {
+			finalHash = hash
+			final.Sha256Fingerprint = fingerprint.String
+			final.Timestamp = uint64(timestamp.Int64)
+		}
+	}
+	return precertHash, finalHash, final, rows.Err()
+}
+
+func (store *dbPrecertHashStore) AddPrecertHash(issuerKey, serialNumber,
+	hash string) error {
+	_, err := store.insert.Exec(ENTRY_TYPE_PRECERT, issuerKey, serialNumber, hash,
+		nil, nil)
+	return err
+}
+
+func (store *dbPrecertHashStore) AddFinalHash(hash string, final PrecertMismatch) error {
+	_, err := store.insert.Exec(ENTRY_TYPE_X509, final.IssuerKey,
+		final.SerialNumber, hash, final.Sha256Fingerprint, final.Timestamp)
+	return err
+}
+
+// Looks up and records where certs were seen in the certAppearances table,
+// in the transaction of the current batch as for dbSerialNumberStore.
+type dbAppearanceStore struct {
+	lookup *sql.Stmt
+	insert *sql.Stmt
+}
+
+func (store *dbAppearanceStore) Appearances(fingerprint string) ([]LogAppearance, error) {
+	rows, err := store.lookup.Query(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var appearances []LogAppearance
+	for rows.Next() {
+		var appearance LogAppearance
+		if err := rows.Scan(&appearance.Log, &appearance.Index); err != nil {
+			return nil, err
+		}
+		appearances = append(appearances, appearance)
+	}
+	return appearances, rows.Err()
+}
+
+func (store *dbAppearanceStore) Add(fingerprint string, appearance LogAppearance) error {
+	_, err := store.insert.Exec(fingerprint, appearance.Log, appearance.Index)
+	return err
+}
+
+// Returns the example cert (as PEM) and when it was last seen, for each
+// issuer (by issuerKey) and violated check, saved by earlier runs.
+func readExamples(db *sql.DB) (map[string]map[string]string, map[string]map[string]uint64) {
+	exampleMap := make(map[string]map[string]string)
+	exampleMapLastSeen := make(map[string]map[string]uint64)
+	rows, err := db.Query(fmt.Sprintf("select issuerKey, %s from examples",
+		checkColumns("%[1]sExample", "%[1]sLastSeen")))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read examples: %s\n", err)
+		os.Exit(1)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var issuer string
+		// Columns of checks added since the issuer's row was written are NULL.
+		examples := make([]sql.NullString, len(Checks()))
+		lastSeen := make([]sql.NullInt64, len(Checks()))
+		dest := []interface{}{&issuer}
+		for i := range Checks() {
+			dest = append(dest, &examples[i], &lastSeen[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read examples: %s\n", err)
+			os.Exit(1)
+		}
+		exampleMap[issuer] = make(map[string]string)
+		exampleMapLastSeen[issuer] = make(map[string]uint64)
+		for i, check := range Checks() {
+			if len(examples[i].String) > 0 {
+				exampleMap[issuer][check.ID()] = examples[i].String
+				exampleMapLastSeen[issuer][check.ID()] = uint64(lastSeen[i].Int64)
+			}
+		}
+	}
+	return exampleMap, exampleMapLastSeen
+}
+
+// Creates the tables that don't exist yet. Everything that has one column per
+// rule is derived from the registered checks, and results are merged into
+// these tables across runs, so tables from an earlier run with fewer checks
+// get columns for the new ones. The state needed to carry on is kept
+// alongside them.
+func createTables(db *sql.DB) error {
+	schema := fmt.Sprintf(`
+	create table if not exists checkpoints(
+		log text primary key,
+		nextIndex integer,
+		treeSize integer,
+		rootHash text,
+		treeHead text,
+		merkleTree text);
+	create table if not exists certAppearances(
+		sha256Fingerprint text,
+		log text,
+		logIndex integer);
+	create index if not exists certAppearancesByFingerprint
+		on certAppearances(sha256Fingerprint);
+	create table if not exists baselineRequirements(
+		entryType text,
+		cn text, issuer text,
+		issuerDN text, issuerKey text, caOwner text,
+		sha256Fingerprint text, notBefore date,
+		notAfter date, keyAlgorithm text,
+		curve text, keySize integer,
+		exp integer, signatureAlgorithm integer,
+		version integer, dnsNames string,
+		policyOIDs string, validationLevel text,
+		ipAddresses string, ocspServers string,
+		crlDistributionPoints string,
+		issuingCertificateURLs string,
+		scts string,
+		maxReputation float,
+		rootPrograms string,
+		path string, root text, intermediate text,
+		rootKey text, rootOwner text,
+		timestamp bigint,
+		%[1]s);
+	create table if not exists issuerReputation(
+		%[2]s);
+	create table if not exists issuerReputationByValidationLevel(
+		validationLevel text,
+		%[2]s);
+	create table if not exists issuerReputationByRootProgram(
+		rootProgram text,
+		%[2]s);
+	create table if not exists issuerReputationState(
+		issuerKey text primary key,
+		state text);
+	create table if not exists issuerKeyIds(
+		keyId text primary key,
+		issuerKey text);
+	create table if not exists rootReputation(
+		%[2]s);
+	create table if not exists rootReputationState(
+		issuerKey text primary key,
+		state text);
+	create table if not exists caOwnerReputation(
+		%[2]s);
+	create table if not exists caOwnerReputationState(
+		issuerKey text primary key,
+		state text);
+	create table if not exists issuerSerialNumbers(
+		issuerKey text primary key,
+		certCount integer,
+		repeatedCount integer,
+		sequentialCount integer);
+	create table if not exists issuerSerialNumberEntries(
+		issuerKey text,
+		serialNumber text,
+		sha256Fingerprint text);
+	create index if not exists issuerSerialNumberEntriesBySerial
+		on issuerSerialNumberEntries(issuerKey, serialNumber);
+	create table if not exists precertHashes(
+		entryType text,
+		issuerKey text,
+		serialNumber text,
+		tbsHash text,
+		sha256Fingerprint text,
+		timestamp bigint);
+	create index if not exists precertHashesBySerial
+		on precertHashes(issuerKey, serialNumber);
+	create table if not exists precertMismatches(
+		issuerKey text,
+		serialNumber text,
+		sha256Fingerprint text,
+		timestamp bigint);
+	create table if not exists examples(
+		issuerKey text primary key,
+		%[3]s);
+	`, resultColumns, issuerReputationColumns, exampleColumns)
+
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	checkColumnsByTable := map[string]string{
+		"baselineRequirements":              resultColumns,
+		"issuerReputation":                  reputationScoreColumns,
+		"issuerReputationByValidationLevel": reputationScoreColumns,
+		"issuerReputationByRootProgram":     reputationScoreColumns,
+		"rootReputation":                    reputationScoreColumns,
+		"caOwnerReputation":                 reputationScoreColumns,
+		"examples":                          exampleColumns,
+	}
+	for table, columns := range checkColumnsByTable {
+		if err := addMissingColumns(db, table, columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds the columns in columns, a comma-separated list of "name type"
+// definitions as in a create table, that table doesn't have yet. Rows that
+// were already there get NULL for them.
+func addMissingColumns(db *sql.DB, table string, columns string) error {
+	rows, err := db.Query("pragma table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue interface{}
+		err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if existing[strings.ToLower(strings.Fields(column)[0])] {
+			continue
+		}
+		if _, err := db.Exec("alter table " + table + " add column " + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a comma-separated list of n sqlite parameter placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
 func main() {
+	// "sunlight lint" checks individual certificates without any of the
+	// files or the DB a scan needs.
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lint(os.Args[2:]))
+	}
 	flag.Parse()
 	if flag.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags], or %s lint [flags] [certificate files]\n",
+			os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	var ranker alexa.AlexaRank
 	ranker.Init(alexaFile)
+	if len(debianWeakKeysFiles) > 0 {
+		for _, filename := range strings.Split(debianWeakKeysFiles, ",") {
+			err := LoadDebianWeakKeys(filename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load Debian weak keys from %s: %s\n",
+					filename, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if len(publicSuffixFile) > 0 {
+		err := LoadPublicSuffixList(publicSuffixFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load public suffix list from %s: %s\n",
+				publicSuffixFile, err)
+			os.Exit(1)
+		}
+	}
+	if len(evPolicyOIDsFile) > 0 {
+		err := LoadEVPolicyOIDs(evPolicyOIDsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load EV policy OIDs from %s: %s\n",
+				evPolicyOIDsFile, err)
+			os.Exit(1)
+		}
+	}
+	if len(ctLogListFile) > 0 {
+		err := LoadCTLogList(ctLogListFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load CT log list from %s: %s\n",
+				ctLogListFile, err)
+			os.Exit(1)
+		}
+	}
+	if len(ctPolicyFile) > 0 {
+		err := LoadCTPolicy(ctPolicyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load CT policy from %s: %s\n",
+				ctPolicyFile, err)
+			os.Exit(1)
+		}
+	}
 	db, err := sql.Open("sqlite3", dbFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to open %s: %s\n", dbFile, err)
@@ -64,148 +722,271 @@ func main() {
 	}
 	defer db.Close()
 
-	createTables := `
-	drop table if exists baselineRequirements;
-	create table baselineRequirements(
-		cn text, issuer text,
-		sha256Fingerprint text, notBefore date,
-		notAfter date, validPeriodTooLong bool,
-		deprecatedSignatureAlgorithm bool,
-		deprecatedVersion bool,
-		missingCNinSAN bool, keyTooShort bool,
-		keySize integer, expTooSmall bool,
-		exp integer, signatureAlgorithm integer,
-		version integer, dnsNames string,
-		ipAddresses string, maxReputation float,
-		issuerInMozillaDB bool,
-		timestamp bigint);
-	drop table if exists issuerReputation;
-	create table issuerReputation(
-		issuer text,
-		issuerInMozillaDB bool,
-		validPeriodTooLongNormalizedScore float,
-		validPeriodTooLongRawScore float,
-		deprecatedVersionNormalizedScore float,
-		deprecatedVersionRawScore float,
-		deprecatedSignatureAlgorithmNormalizedScore float,
-		deprecatedSignatureAlgorithmRawScore float,
-		missingCNinSANNormalizedScore float,
-		missingCNinSANRawScore float,
-		keyTooShortNormalizedScore float,
-		keyTooShortRawScore float,
-		expTooSmallNormalizedScore float,
-		expTooSmallRawScore float,
-		normalizedScore float,
-		rawScore float,
-		normalizedCount integer,
-		rawCount integer,
-		beginTime bigint);
-	drop table if exists examples;
-	create table examples(
-		issuer text,
-		validPeriodTooLongExample text,
-		validPeriodTooLongLastSeen bigint,
-		deprecatedVersionExample text,
-		deprecatedVersionLastSeen bigint,
-		deprecatedSignatureAlgorithmExample text,
-		deprecatedSignatureAlgorithmLastSeen bigint,
-		missingCNinSANExample text,
-		missingCNinSANLastSeen bigint,
-		keyTooShortExample text,
-		keyTooShortLastSeen bigint,
-		expTooSmallExample text,
-		expTooSmallLastSeen bigint);
+	if err := createTables(db); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create table: %s\n", err)
+		os.Exit(1)
+	}
+
+	insertEntry := fmt.Sprintf(`
+	insert into baselineRequirements(
+		entryType, cn, issuer, issuerDN, issuerKey, caOwner,
+		sha256Fingerprint, notBefore,
+		notAfter, keyAlgorithm, curve, keySize, exp,
+		signatureAlgorithm, version, dnsNames,
+		policyOIDs, validationLevel, ipAddresses, ocspServers,
+		crlDistributionPoints, issuingCertificateURLs, scts,
+		maxReputation, rootPrograms, path, root, intermediate,
+		rootKey, rootOwner, timestamp, %s)
+		values(%s)
+	`, checkColumns("%s"), placeholders(31+len(Checks())))
+	insertEntryStatement, err := db.Prepare(insertEntry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertEntryStatement.Close()
+
+	insertIssuer := fmt.Sprintf(`
+	 insert into issuerReputation(
+		%s)
+	values(%s)
+	`, issuerReputationInsertColumns, placeholders(issuerReputationInsertCount))
+	insertIssuerStatement, err := db.Prepare(insertIssuer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertIssuerStatement.Close()
+
+	insertRoot := fmt.Sprintf(`
+	 insert into rootReputation(
+		%s)
+	values(%s)
+	`, issuerReputationInsertColumns, placeholders(issuerReputationInsertCount))
+	insertRootStatement, err := db.Prepare(insertRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertRootStatement.Close()
+
+	insertCAOwner := fmt.Sprintf(`
+	 insert into caOwnerReputation(
+		%s)
+	values(%s)
+	`, issuerReputationInsertColumns, placeholders(issuerReputationInsertCount))
+	insertCAOwnerStatement, err := db.Prepare(insertCAOwner)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertCAOwnerStatement.Close()
+
+	insertIssuerByValidationLevel := fmt.Sprintf(`
+	 insert into issuerReputationByValidationLevel(
+		validationLevel,
+		%s)
+	values(%s)
+	`, issuerReputationInsertColumns, placeholders(1+issuerReputationInsertCount))
+	insertIssuerByValidationLevelStatement, err := db.Prepare(insertIssuerByValidationLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertIssuerByValidationLevelStatement.Close()
+
+	insertIssuerByRootProgram := fmt.Sprintf(`
+	 insert into issuerReputationByRootProgram(
+		rootProgram,
+		%s)
+	values(%s)
+	`, issuerReputationInsertColumns, placeholders(1+issuerReputationInsertCount))
+	insertIssuerByRootProgramStatement, err := db.Prepare(insertIssuerByRootProgram)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertIssuerByRootProgramStatement.Close()
+
+	insertSerials := `
+		insert or replace into issuerSerialNumbers(
+			issuerKey, certCount, repeatedCount, sequentialCount)
+		values(?, ?, ?, ?)
 	`
+	insertSerialsStatement, err := db.Prepare(insertSerials)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertSerialsStatement.Close()
 
-	_, err = db.Exec(createTables)
+	insertSerialEntry := `
+		insert into issuerSerialNumberEntries(
+			issuerKey, serialNumber, sha256Fingerprint)
+		values(?, ?, ?)
+	`
+	insertSerialEntryStatement, err := db.Prepare(insertSerialEntry)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create table: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
+	defer insertSerialEntryStatement.Close()
 
-	tx, err := db.Begin()
+	lookupSerialEntry := `
+		select sha256Fingerprint from issuerSerialNumberEntries
+		where issuerKey = ? and serialNumber = ?
+	`
+	lookupSerialEntryStatement, err := db.Prepare(lookupSerialEntry)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to begin using DB: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
+	defer lookupSerialEntryStatement.Close()
 
-	insertEntry := `
-	insert into baselineRequirements(
-		cn, issuer, sha256Fingerprint, notBefore,
-		notAfter, validPeriodTooLong,
-		deprecatedSignatureAlgorithm,
-		deprecatedVersion, missingCNinSAN,
-		keyTooShort, keySize, expTooSmall, exp,
-		signatureAlgorithm, version, dnsNames,
-		ipAddresses, maxReputation,
-		issuerInMozillaDB, timestamp)
-		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	insertPrecertHash := `
+		insert into precertHashes(
+			entryType, issuerKey, serialNumber, tbsHash, sha256Fingerprint,
+			timestamp)
+		values(?, ?, ?, ?, ?, ?)
 	`
-	insertEntryStatement, err := tx.Prepare(insertEntry)
+	insertPrecertHashStatement, err := db.Prepare(insertPrecertHash)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
-	defer insertEntryStatement.Close()
+	defer insertPrecertHashStatement.Close()
 
-	insertIssuer := `
-	 insert into issuerReputation(
-		issuer,
-		issuerInMozillaDB,
-		validPeriodTooLongNormalizedScore, validPeriodTooLongRawScore,
-		deprecatedVersionNormalizedScore, deprecatedVersionRawScore,
-		deprecatedSignatureAlgorithmNormalizedScore,
-		deprecatedSignatureAlgorithmRawScore,
-		missingCNinSANNormalizedScore, missingCNinSANRawScore,
-		keyTooShortNormalizedScore, keyTooShortRawScore,
-		expTooSmallNormalizedScore, expTooSmallRawScore,
-		normalizedScore, rawScore,
-		normalizedCount, rawCount, beginTime)
-	values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	lookupPrecertHash := `
+		select entryType, tbsHash, sha256Fingerprint, timestamp
+		from precertHashes
+		where issuerKey = ? and serialNumber = ?
+		order by rowid
 	`
-	insertIssuerStatement, err := tx.Prepare(insertIssuer)
+	lookupPrecertHashStatement, err := db.Prepare(lookupPrecertHash)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
-	defer insertIssuerStatement.Close()
+	defer lookupPrecertHashStatement.Close()
 
-	insertExample := `
-		insert into examples(
-			issuer,
-			validPeriodTooLongExample,
-			validPeriodTooLongLastSeen,
-			deprecatedVersionExample,
-			deprecatedVersionLastSeen,
-			deprecatedSignatureAlgorithmExample,
-			deprecatedSignatureAlgorithmLastSeen,
-			missingCNinSANExample,
-			missingCNinSANLastSeen,
-			keyTooShortExample,
-			keyTooShortLastSeen,
-			expTooSmallExample,
-			expTooSmallLastSeen)
-		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	insertAppearance := `
+		insert into certAppearances(sha256Fingerprint, log, logIndex)
+		values(?, ?, ?)
 	`
-	insertExampleStatement, err := tx.Prepare(insertExample)
+	insertAppearanceStatement, err := db.Prepare(insertAppearance)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
-	defer insertExampleStatement.Close()
+	defer insertAppearanceStatement.Close()
 
-	fmt.Fprintf(os.Stderr, "Starting %s\n", time.Now())
-	in, err := os.Open(ctLog)
+	lookupAppearance := `
+		select log, logIndex from certAppearances
+		where sha256Fingerprint = ?
+		order by rowid
+	`
+	lookupAppearanceStatement, err := db.Prepare(lookupAppearance)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open entries file: %s\n", err)
-		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
 		os.Exit(1)
 	}
-	defer in.Close()
+	defer lookupAppearanceStatement.Close()
 
-	entriesFile := certificatetransparency.EntriesFile{in}
+	insertMismatch := `
+		insert into precertMismatches(
+			issuerKey, serialNumber, sha256Fingerprint, timestamp)
+		values(?, ?, ?, ?)
+	`
+	insertMismatchStatement, err := db.Prepare(insertMismatch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertMismatchStatement.Close()
+
+	insertExample := fmt.Sprintf(`
+		insert or replace into examples(
+			issuerKey,
+			%s)
+		values(%s)
+	`, checkColumns("%[1]sExample", "%[1]sLastSeen"),
+		placeholders(1+2*len(Checks())))
+	insertExampleStatement, err := db.Prepare(insertExample)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create prepared statement: %s\n", err)
+		os.Exit(1)
+	}
+	defer insertExampleStatement.Close()
+
+	fmt.Fprintf(os.Stderr, "Starting %s\n", time.Now())
+	// Entries come from downloaded log files and straight from logs, one log
+	// after the other, and each log picks up where the last run left off.
+	var logFiles, logURLs, logKeyFiles []string
+	if len(ctLogURL) > 0 {
+		logURLs = strings.Split(ctLogURL, ",")
+	}
+	if len(ctLogKeyFile) > 0 {
+		logKeyFiles = strings.Split(ctLogKeyFile, ",")
+		if len(logKeyFiles) != len(logURLs) {
+			fmt.Fprintf(os.Stderr, "ct_log_key needs one (possibly empty) entry per ct_log_url\n")
+			os.Exit(1)
+		}
+	}
+	ctLogSet := false
+	flag.Visit(func(f *flag.Flag) {
+		ctLogSet = ctLogSet || f.Name == "ct_log"
+	})
+	var sourceNames []string
+	if len(certSources) > 0 {
+		sourceNames = strings.Split(certSources, ",")
+	}
+	if (ctLogSet || len(logURLs)+len(sourceNames) == 0) && len(ctLog) > 0 {
+		logFiles = strings.Split(ctLog, ",")
+	}
+	serialStore := new(dbSerialNumberStore)
+	precertHashStore := new(dbPrecertHashStore)
+	appearanceStore := new(dbAppearanceStore)
+	// Everything from an entry is written in the transaction of the batch
+	// the entry is in, along with the checkpoint after the batch, so a batch
+	// is either processed completely or not at all.
+	var tx *sql.Tx
+	var insertEntryTxStatement *sql.Stmt
+	begin := func() {
+		tx, err = db.Begin()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to begin using DB: %s\n", err)
+			os.Exit(1)
+		}
+		insertEntryTxStatement = tx.Stmt(insertEntryStatement)
+		serialStore.lookup = tx.Stmt(lookupSerialEntryStatement)
+		serialStore.insert = tx.Stmt(insertSerialEntryStatement)
+		precertHashStore.lookup = tx.Stmt(lookupPrecertHashStatement)
+		precertHashStore.insert = tx.Stmt(insertPrecertHashStatement)
+		appearanceStore.lookup = tx.Stmt(lookupAppearanceStatement)
+		appearanceStore.insert = tx.Stmt(insertAppearanceStatement)
+	}
+	entriesFiles := make([]certificatetransparency.EntriesFile, len(logFiles))
+	for i, logFile := range logFiles {
+		in, err := os.Open(logFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open entries file: %s\n", err)
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+		defer in.Close()
+		entriesFiles[i] = certificatetransparency.EntriesFile{File: in}
+	}
+	sources := make([]CertSource, len(sourceNames))
+	for i, sourceName := range sourceNames {
+		sources[i], err = OpenCertSource(sourceName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open certificates: %s\n", err)
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+	}
 	fmt.Fprintf(os.Stderr, "Initialized entries %s\n", time.Now())
-	out, err := os.OpenFile(jsonFile, os.O_RDWR|os.O_CREATE, 0666)
+	out, err := os.OpenFile(jsonFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to open JSON output file %s: %s\n",
 			jsonFile, err)
@@ -216,24 +997,80 @@ func main() {
 	firstOutLock := new(sync.Mutex)
 	firstOut := true
 
-	rootCAMap := ReadRootCAMap(rootCAFile)
+	rootPrograms := loadRootPrograms()
+	var caOwners *OwnerMap
+	if len(caOwnersFile) > 0 {
+		caOwners, err = LoadOwnerMap(caOwnersFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load CA owners: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
+	// Issuers, serial numbers and examples touched since the last commit
+	// are rewritten when the batch is committed.
 	issuersLock := new(sync.Mutex)
-	issuers := make(map[string]*IssuerReputation)
+	issuers := readIssuerReputations(db, "issuerReputationState")
+	changedIssuers := make(map[string]bool)
+	// The same reputations rolled up to the roots the certs chain to and to
+	// the CA organisations that own the issuers.
+	roots := readIssuerReputations(db, "rootReputationState")
+	changedRoots := make(map[string]bool)
+	owners := readIssuerReputations(db, "caOwnerReputationState")
+	changedOwners := make(map[string]bool)
+	// The issuers of "keyid:" issuer keys, learned from certs logged with
+	// their issuer. Reputations kept under a "keyid:" key are merged into
+	// the issuer's when it's learned, and deleted when the batch is
+	// committed.
+	issuerKeys := readIssuerKeyMap(db)
+	newIssuerKeyIds := make(map[string]string)
+	mergedIssuers := make(map[string]*IssuerReputation)
+
+	// Serial numbers are tracked per issuer over all runs rather than per
+	// month, since reuse can span months. They're looked up in the DB rather
+	// than kept in memory.
+	issuerSerialsLock := new(sync.Mutex)
+	issuerSerials := readIssuerSerialNumbers(db, serialStore)
+	changedIssuerSerials := make(map[string]bool)
+
+	// Precertificates and final certificates are paired up over all runs,
+	// looking up the hashes of earlier ones in the DB. Mismatches are saved
+	// when the batch they're found in is committed.
+	precertPairsLock := new(sync.Mutex)
+	precertPairs := NewPrecertPairs(precertHashStore)
+
+	// Certs are only counted the first time they're seen, whichever log
+	// they're in and whichever run saw them. Earlier appearances are looked
+	// up in the DB.
+	certAppearancesLock := new(sync.Mutex)
+	certAppearances := NewCertAppearances(appearanceStore)
 
 	exampleMapLock := new(sync.Mutex)
-	exampleMap := make(map[string]map[string]*x509.Certificate)
-	exampleMapLastSeen := make(map[string]map[string]uint64)
+	exampleMap, exampleMapLastSeen := readExamples(db)
+	changedExamples := make(map[string]bool)
 
-	entriesFile.Map(func(ent *certificatetransparency.EntryAndPosition, err error) {
+	processEntry := func(log string, ent *certificatetransparency.EntryAndPosition,
+		err error) {
+		// Entries that can't be read (e.g. a file in a cert source that
+		// doesn't exist or doesn't parse) are skipped, but not silently.
 		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping entry of %s: %s\n", log, err)
 			return
 		}
 
-		cert, err := x509.ParseCertificate(ent.Entry.X509Cert)
+		var cert *x509.Certificate
+		switch ent.Entry.Type {
+		case certificatetransparency.X509Entry:
+			cert, err = x509.ParseCertificate(ent.Entry.X509Cert)
+		case certificatetransparency.PrecertEntry:
+			cert, err = ParsePrecertificate(ent.Entry.Precert.TBSCertificate)
+		default:
+			return
+		}
 		if err != nil {
 			return
 		}
+		isPrecert := ent.Entry.Type == certificatetransparency.PrecertEntry
 
 		// Filter out certs issued before 2013 or that have already
 		// expired.
@@ -243,6 +1080,18 @@ func main() {
 			return
 		}
 
+		fingerprint := Sha256Fingerprint(cert)
+		certAppearancesLock.Lock()
+		first, err := certAppearances.Add(fingerprint, LogAppearance{Log: log, Index: ent.Index})
+		certAppearancesLock.Unlock()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record cert appearance: %s\n", err)
+			os.Exit(1)
+		}
+		if !first {
+			return
+		}
+
 		certList := make([]*x509.Certificate, 0)
 		for _, certBytes := range ent.Entry.ExtraCerts {
 			nextCert, err := x509.ParseCertificate(certBytes)
@@ -252,54 +1101,141 @@ func main() {
 			certList = append(certList, nextCert)
 		}
 
-		summary, err := CalculateCertSummary(cert, ent.Entry.Timestamp, &ranker, certList, rootCAMap)
-		if err != nil {
+		var summary *CertSummary
+		if isPrecert {
+			summary, err = CalculatePrecertSummary(cert, ent.Entry.Timestamp, &ranker, certList, rootPrograms)
+		} else {
+			summary, err = CalculateCertSummary(cert, ent.Entry.Timestamp, &ranker, certList, rootPrograms)
+		}
+		if _, ok := err.(*ReputationError); ok {
+			// The cert is still counted, as if the name weren't in Alexa.
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		} else if err != nil {
 			return
 		}
 		if summary == nil {
 			fmt.Fprintf(os.Stderr, "Couldn't allocate new cert summary\n")
 			os.Exit(1)
 		}
-		certIssuerDN := DistinguishedNameToString(cert.Issuer)
-		key := fmt.Sprintf("%s:%d", certIssuerDN, TruncateMonth(ent.Entry.Timestamp))
 		issuersLock.Lock()
-		if issuers[key] == nil {
-			issuers[key] = NewIssuerReputation(cert.Issuer, ent.Entry.Timestamp)
-		}
-		if issuers[key] == nil {
-			fmt.Fprintf(os.Stderr, "Couldn't allocate new issuer reputation\n")
-			os.Exit(1)
+		if keyId := issuerKeys.Apply(cert, summary); len(keyId) > 0 {
+			newIssuerKeyIds[keyId] = summary.IssuerKey
+			for key, reputation := range issuers {
+				if reputation.IssuerKey != keyId {
+					continue
+				}
+				mergedKey := fmt.Sprintf("%s:%d", summary.IssuerKey, reputation.BeginTime)
+				if issuers[mergedKey] == nil {
+					issuers[mergedKey] = NewIssuerReputation(summary.IssuerKey, cert.Issuer,
+						reputation.BeginTime)
+				}
+				issuers[mergedKey].Merge(reputation)
+				changedIssuers[mergedKey] = true
+				delete(issuers, key)
+				delete(changedIssuers, key)
+				mergedIssuers[key] = reputation
+			}
 		}
-		// Update issuer reputation whether or not the cert violates baseline
-		// requirements.
-		issuers[key].Update(summary)
 		issuersLock.Unlock()
-		if summary.ViolatesBR() {
-			dnsNamesAsString, err := json.Marshal(summary.DnsNames)
+		caOwners.Apply(summary)
+		serialNumber := cert.SerialNumber.Text(16)
+		tbsHash, err := PrecertTBSHash(cert)
+		if err == nil {
+			precertPairsLock.Lock()
+			if isPrecert {
+				err = precertPairs.AddPrecertHash(summary.IssuerKey, serialNumber, tbsHash)
+			} else {
+				err = precertPairs.AddFinalHash(tbsHash, PrecertMismatch{
+					IssuerKey:         summary.IssuerKey,
+					SerialNumber:      serialNumber,
+					Sha256Fingerprint: summary.Sha256Fingerprint,
+					Timestamp:         ent.Entry.Timestamp,
+				})
+			}
+			precertPairsLock.Unlock()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to convert to JSON: %s\n", err)
+				fmt.Fprintf(os.Stderr, "Failed to pair precertificates: %s\n", err)
 				os.Exit(1)
 			}
-			ipAddressesAsString, err := json.Marshal(summary.IpAddresses)
+		}
+		// A precert and its final cert are the same issuance, so only final
+		// certs count towards issuer reputation and serial number reuse.
+		// Precerts are still checked and reported below.
+		if !isPrecert {
+			month := TruncateMonth(ent.Entry.Timestamp)
+			issuersLock.Lock()
+			// Another entry may have learned the issuer of a "keyid:" key
+			// since this one's was resolved.
+			summary.IssuerKey = issuerKeys.Resolve(summary.IssuerKey)
+			key := fmt.Sprintf("%s:%d", summary.IssuerKey, month)
+			ownerKey := fmt.Sprintf("%s:%d", summary.CAOwner, month)
+			if issuers[key] == nil {
+				issuers[key] = NewIssuerReputation(summary.IssuerKey, cert.Issuer,
+					ent.Entry.Timestamp)
+			}
+			if owners[ownerKey] == nil {
+				owners[ownerKey] = NewCAOwnerReputation(summary.CAOwner, ent.Entry.Timestamp)
+			}
+			if issuers[key] == nil {
+				fmt.Fprintf(os.Stderr, "Couldn't allocate new issuer reputation\n")
+				os.Exit(1)
+			}
+			// Update issuer reputation whether or not the cert violates baseline
+			// requirements.
+			issuers[key].Update(summary)
+			changedIssuers[key] = true
+			owners[ownerKey].Update(summary)
+			changedOwners[ownerKey] = true
+			// Certs that don't chain to any root program have no root.
+			if len(summary.RootKey) > 0 {
+				rootKey := fmt.Sprintf("%s:%d", summary.RootKey, month)
+				if roots[rootKey] == nil {
+					roots[rootKey] = NewRootReputation(summary.RootKey, summary.RootDN,
+						ent.Entry.Timestamp)
+				}
+				roots[rootKey].Update(summary)
+				changedRoots[rootKey] = true
+			}
+			issuersLock.Unlock()
+			issuerSerialsLock.Lock()
+			if issuerSerials[summary.IssuerKey] == nil {
+				issuerSerials[summary.IssuerKey] = NewIssuerSerialNumbers(summary.IssuerKey,
+					serialStore)
+			}
+			_, _, err = issuerSerials[summary.IssuerKey].Update(cert.SerialNumber,
+				summary.Sha256Fingerprint)
+			changedIssuerSerials[summary.IssuerKey] = true
+			issuerSerialsLock.Unlock()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to convert to JSON: %s\n", err)
+				fmt.Fprintf(os.Stderr, "Failed to update serial numbers: %s\n", err)
 				os.Exit(1)
 			}
-			_, err = insertEntryStatement.Exec(summary.CN, summary.Issuer,
-				summary.Sha256Fingerprint,
+		}
+		if summary.ViolatesBR() {
+			entryArgs := []interface{}{summary.EntryType,
+				summary.CN, summary.Issuer,
+				summary.IssuerDN, summary.IssuerKey,
+				summary.CAOwner, summary.Sha256Fingerprint,
 				cert.NotBefore, cert.NotAfter,
-				summary.Violations[VALID_PERIOD_TOO_LONG],
-				summary.Violations[DEPRECATED_SIGNATURE_ALGORITHM],
-				summary.Violations[DEPRECATED_VERSION],
-				summary.Violations[MISSING_CN_IN_SAN],
-				summary.Violations[KEY_TOO_SHORT], summary.KeySize,
-				summary.Violations[EXP_TOO_SMALL], summary.Exp,
+				summary.KeyAlgorithm, summary.Curve,
+				summary.KeySize, summary.Exp,
 				summary.SignatureAlgorithm,
-				summary.Version, dnsNamesAsString,
-				ipAddressesAsString,
+				summary.Version, toJSON(summary.DnsNames),
+				toJSON(summary.PolicyOIDs), summary.ValidationLevel,
+				toJSON(summary.IpAddresses),
+				toJSON(summary.OCSPServers),
+				toJSON(summary.CRLDistributionPoints),
+				toJSON(summary.IssuingCertificateURLs),
+				toJSON(summary.SCTs),
 				summary.MaxReputation,
-				summary.IssuerInMozillaDB,
-				summary.Timestamp)
+				toJSON(summary.RootPrograms),
+				toJSON(summary.Path), summary.Root,
+				summary.Intermediate, summary.RootKey,
+				summary.RootOwner, summary.Timestamp}
+			for _, check := range Checks() {
+				entryArgs = append(entryArgs, summary.Violations[check.ID()])
+			}
+			_, err = insertEntryTxStatement.Exec(entryArgs...)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
 				os.Exit(1)
@@ -321,66 +1257,242 @@ func main() {
 			}
 
 			exampleMapLock.Lock()
-			if exampleMap[certIssuerDN] == nil {
-				exampleMap[certIssuerDN] = make(map[string]*x509.Certificate)
-				exampleMapLastSeen[certIssuerDN] = make(map[string]uint64)
+			if exampleMap[summary.IssuerKey] == nil {
+				exampleMap[summary.IssuerKey] = make(map[string]string)
+				exampleMapLastSeen[summary.IssuerKey] = make(map[string]uint64)
 			}
 			for violation, isViolation := range summary.Violations {
 				if isViolation {
-					exampleMap[certIssuerDN][violation] = cert
-					exampleMapLastSeen[certIssuerDN][violation] = ent.Entry.Timestamp
+					exampleMap[summary.IssuerKey][violation] = certToString(cert)
+					exampleMapLastSeen[summary.IssuerKey][violation] = ent.Entry.Timestamp
 				}
 			}
+			changedExamples[summary.IssuerKey] = true
 			exampleMapLock.Unlock()
 		}
-	}, maxEntries)
-	fmt.Fprintf(out, "]}\n")
-	// Normalize all our scores
-	for _, issuer := range issuers {
-		issuer.Finish()
-		_, err = insertIssuerStatement.Exec(issuer.Issuer,
-			issuer.IssuerInMozillaDB,
-			issuer.Scores[VALID_PERIOD_TOO_LONG].NormalizedScore,
-			issuer.Scores[VALID_PERIOD_TOO_LONG].RawScore,
-			issuer.Scores[DEPRECATED_VERSION].NormalizedScore,
-			issuer.Scores[DEPRECATED_VERSION].RawScore,
-			issuer.Scores[DEPRECATED_SIGNATURE_ALGORITHM].NormalizedScore,
-			issuer.Scores[DEPRECATED_SIGNATURE_ALGORITHM].RawScore,
-			issuer.Scores[MISSING_CN_IN_SAN].NormalizedScore,
-			issuer.Scores[MISSING_CN_IN_SAN].RawScore,
-			issuer.Scores[KEY_TOO_SHORT].NormalizedScore,
-			issuer.Scores[KEY_TOO_SHORT].RawScore,
-			issuer.Scores[EXP_TOO_SMALL].NormalizedScore,
-			issuer.Scores[EXP_TOO_SMALL].RawScore,
-			issuer.NormalizedScore,
-			issuer.RawScore,
-			issuer.NormalizedCount,
-			issuer.RawCount,
-			issuer.BeginTime)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
-			os.Exit(1)
+	}
+
+	// Writes everything that changed in the batch, along with the checkpoint
+	// of log after it (if there is one), and starts the next batch. Every
+	// entry of the batch has been processed by the time this is called.
+	commit := func(log string, checkpoint *ctlog.Checkpoint) error {
+		for key := range changedIssuers {
+			issuer := issuers[key]
+			_, err := tx.Exec(`
+				insert or replace into issuerReputationState(issuerKey, state)
+				values(?, ?)`, key, toJSON(issuer))
+			if err == nil {
+				_, err = tx.Exec(`
+					delete from issuerReputation
+					where issuerKey = ? and beginTime = ?`, issuer.IssuerKey, issuer.BeginTime)
+			}
+			if err == nil {
+				_, err = tx.Exec(`
+					delete from issuerReputationByValidationLevel
+					where issuerKey = ? and beginTime = ?`, issuer.IssuerKey, issuer.BeginTime)
+			}
+			if err == nil {
+				_, err = tx.Exec(`
+					delete from issuerReputationByRootProgram
+					where issuerKey = ? and beginTime = ?`, issuer.IssuerKey, issuer.BeginTime)
+			}
+			// Normalize the scores of everything seen so far
+			finished := issuer.Finished()
+			if err == nil {
+				_, err = tx.Stmt(insertIssuerStatement).Exec(issuerReputationArgs(finished)...)
+			}
+			for level, levelReputation := range finished.ByValidationLevel {
+				if err != nil {
+					break
+				}
+				args := append([]interface{}{level}, issuerReputationArgs(levelReputation)...)
+				_, err = tx.Stmt(insertIssuerByValidationLevelStatement).Exec(args...)
+			}
+			for program, programReputation := range finished.ByRootProgram {
+				if err != nil {
+					break
+				}
+				args := append([]interface{}{program}, issuerReputationArgs(programReputation)...)
+				_, err = tx.Stmt(insertIssuerByRootProgramStatement).Exec(args...)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
 		}
+		changedIssuers = make(map[string]bool)
+
+		// Reputations merged into their issuer's are deleted, so that the
+		// issuer isn't reported twice.
+		for key, issuer := range mergedIssuers {
+			_, err := tx.Exec(`
+				delete from issuerReputationState where issuerKey = ?`, key)
+			for _, table := range []string{"issuerReputation",
+				"issuerReputationByValidationLevel", "issuerReputationByRootProgram"} {
+				if err != nil {
+					break
+				}
+				_, err = tx.Exec(`
+					delete from `+table+`
+					where issuerKey = ? and beginTime = ?`, issuer.IssuerKey, issuer.BeginTime)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		mergedIssuers = make(map[string]*IssuerReputation)
+		for keyId, issuerKey := range newIssuerKeyIds {
+			_, err := tx.Exec(`
+				insert or replace into issuerKeyIds(keyId, issuerKey)
+				values(?, ?)`, keyId, issuerKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		newIssuerKeyIds = make(map[string]string)
+
+		commitRollUps(tx, "rootReputation", insertRootStatement, roots, changedRoots)
+		changedRoots = make(map[string]bool)
+		commitRollUps(tx, "caOwnerReputation", insertCAOwnerStatement, owners, changedOwners)
+		changedOwners = make(map[string]bool)
+
+		for issuerKey := range changedIssuerSerials {
+			serials := issuerSerials[issuerKey]
+			_, err = tx.Stmt(insertSerialsStatement).Exec(serials.IssuerKey,
+				serials.CertCount, serials.RepeatedCount, serials.SequentialCount)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		changedIssuerSerials = make(map[string]bool)
+
+		for _, mismatch := range precertPairs.Mismatches {
+			_, err = tx.Stmt(insertMismatchStatement).Exec(mismatch.IssuerKey,
+				mismatch.SerialNumber, mismatch.Sha256Fingerprint, mismatch.Timestamp)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		precertPairs.Mismatches = nil
+
+		for issuer := range changedExamples {
+			exampleArgs := []interface{}{issuer}
+			for _, check := range Checks() {
+				exampleArgs = append(exampleArgs,
+					exampleMap[issuer][check.ID()],
+					exampleMapLastSeen[issuer][check.ID()])
+			}
+			_, err = tx.Stmt(insertExampleStatement).Exec(exampleArgs...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		changedExamples = make(map[string]bool)
+
+		if checkpoint != nil {
+			writeCheckpoint(tx, log, checkpoint)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			fmt.Fprintf(os.Stderr, "Committed %s up to entry %d %s\n", log,
+				checkpoint.NextIndex, time.Now())
+		} else {
+			fmt.Fprintf(os.Stderr, "Committed %s %s\n", log, time.Now())
+		}
+		begin()
+		return nil
 	}
 
-	for issuer, examples := range exampleMap {
-		_, err = insertExampleStatement.Exec(issuer,
-			certToString(examples[VALID_PERIOD_TOO_LONG]),
-			exampleMapLastSeen[issuer][VALID_PERIOD_TOO_LONG],
-			certToString(examples[DEPRECATED_VERSION]),
-			exampleMapLastSeen[issuer][DEPRECATED_VERSION],
-			certToString(examples[DEPRECATED_SIGNATURE_ALGORITHM]),
-			exampleMapLastSeen[issuer][DEPRECATED_SIGNATURE_ALGORITHM],
-			certToString(examples[MISSING_CN_IN_SAN]),
-			exampleMapLastSeen[issuer][MISSING_CN_IN_SAN],
-			certToString(examples[KEY_TOO_SHORT]),
-			exampleMapLastSeen[issuer][KEY_TOO_SHORT],
-			certToString(examples[EXP_TOO_SMALL]),
-			exampleMapLastSeen[issuer][EXP_TOO_SMALL])
+	begin()
+	for i, logURL := range logURLs {
+		client := ctlog.NewClient(logURL)
+		if i < len(logKeyFiles) && len(logKeyFiles[i]) > 0 {
+			client.PublicKey, err = ctlog.LoadPublicKey(logKeyFiles[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load log key from %s: %s\n",
+					logKeyFiles[i], err)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "No ct_log_key given for %s; not checking tree head signatures\n",
+				logURL)
+		}
+		checkpoint := readCheckpoint(db, logURL)
+		if checkpoint != nil {
+			fmt.Fprintf(os.Stderr, "Resuming %s from entry %d\n", logURL,
+				checkpoint.NextIndex)
+		}
+		// Bind logURL for the closures.
+		logURL := logURL
+		_, err = client.Resume(checkpoint,
+			func(ent *certificatetransparency.EntryAndPosition, err error) {
+				processEntry(logURL, ent, err)
+			}, maxEntries, checkpointInterval,
+			func(checkpoint *ctlog.Checkpoint) error {
+				return commit(logURL, checkpoint)
+			})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to insert entry: %s\n", err)
+			// The batch that failed isn't committed.
+			fmt.Fprintf(os.Stderr, "Failed to scan %s: %s\n", logURL, err)
+			os.Exit(1)
+		}
+	}
+	for i, logFile := range logFiles {
+		// An entries file can't be processed in order, so it's committed in
+		// one go, skipping whatever earlier runs committed.
+		start := uint64(0)
+		if checkpoint := readCheckpoint(db, logFile); checkpoint != nil {
+			fmt.Fprintf(os.Stderr, "Resuming %s from entry %d\n", logFile,
+				checkpoint.NextIndex)
+			start = checkpoint.NextIndex
+		}
+		end := start
+		endLock := new(sync.Mutex)
+		fileMaxEntries := maxEntries
+		if maxEntries > 0 {
+			fileMaxEntries = start + maxEntries
+		}
+		entriesFiles[i].Map(func(ent *certificatetransparency.EntryAndPosition, err error) {
+			if ent != nil {
+				if ent.Index < start {
+					return
+				}
+				endLock.Lock()
+				if ent.Index >= end {
+					end = ent.Index + 1
+				}
+				endLock.Unlock()
+			}
+			processEntry(logFile, ent, err)
+		}, fileMaxEntries)
+		if err := commit(logFile, &ctlog.Checkpoint{NextIndex: end}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to commit: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	for i, source := range sources {
+		// Inventories can change from one run to the next, so they're checked
+		// in full each time. Certs that were already seen aren't counted
+		// again.
+		sourceName := sourceNames[i]
+		if sourceName == "-" {
+			sourceName = "stdin"
+		}
+		source.Map(func(ent *certificatetransparency.EntryAndPosition, err error) {
+			processEntry(sourceName, ent, err)
+		}, maxEntries)
+		if err := commit(sourceName, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to commit: %s\n", err)
 			os.Exit(1)
 		}
 	}
-	tx.Commit()
+	tx.Rollback()
+	fmt.Fprintf(out, "]}\n")
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	. "github.com/mozkeeler/sunlight"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Returns a temporary DB for a test, and a function that removes it.
+func openTestDB(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "sunlight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "BRs.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Returns the names of table's columns.
+func tableColumns(t *testing.T, db *sql.DB, table string) map[string]bool {
+	rows, err := db.Query("pragma table_info(" + table + ")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue interface{}
+		err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns[name] = true
+	}
+	return columns
+}
+
+func TestCreateTablesAddsCheckColumns(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make it a DB from a run that didn't have the last check yet.
+	first := Checks()[0]
+	last := ColumnName(Checks()[len(Checks())-1].ID())
+	dropped := map[string][]string{
+		"baselineRequirements": {last},
+		"issuerReputation":     {last + "NormalizedScore", last + "RawScore"},
+		"rootReputation":       {last + "NormalizedScore", last + "RawScore"},
+		"examples":             {last + "Example", last + "LastSeen"},
+	}
+	for table, columns := range dropped {
+		for _, column := range columns {
+			_, err := db.Exec("alter table " + table + " drop column " + column)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		insert into examples(issuerKey, %[1]sExample, %[1]sLastSeen)
+		values('issuer', 'example', 5)`, ColumnName(first.ID())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	for table, columns := range dropped {
+		existing := tableColumns(t, db, table)
+		for _, column := range columns {
+			if !existing[column] {
+				t.Errorf("Expected %s to get back its %s column", table, column)
+			}
+		}
+	}
+	exampleMap, exampleMapLastSeen := readExamples(db)
+	if exampleMap["issuer"][first.ID()] != "example" ||
+		exampleMapLastSeen["issuer"][first.ID()] != 5 || len(exampleMap["issuer"]) != 1 {
+		t.Errorf("Unexpected examples %v", exampleMap)
+	}
+	insertEntry := fmt.Sprintf("insert into baselineRequirements(entryType, %s) values(%s)",
+		strings.Replace(checkColumns("%s"), "\n", " ", -1), placeholders(1+len(Checks())))
+	if _, err := db.Prepare(insertEntry); err != nil {
+		t.Errorf("Couldn't insert results for every check: %s", err)
+	}
+}
+
+func TestDBPrecertHashStore(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	lookup, err := db.Prepare(`
+		select entryType, tbsHash, sha256Fingerprint, timestamp from precertHashes
+		where issuerKey = ? and serialNumber = ? order by rowid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert, err := db.Prepare(`
+		insert into precertHashes(entryType, issuerKey, serialNumber, tbsHash,
+			sha256Fingerprint, timestamp)
+		values(?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each run pairs what it sees with what earlier runs committed.
+	run := func(add func(pairs *PrecertPairs) error) *PrecertPairs {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs := NewPrecertPairs(&dbPrecertHashStore{tx.Stmt(lookup), tx.Stmt(insert)})
+		if err := add(pairs); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return pairs
+	}
+	final := PrecertMismatch{IssuerKey: "honest-al", SerialNumber: "1f",
+		Sha256Fingerprint: "final", Timestamp: 4}
+	pairs := run(func(pairs *PrecertPairs) error {
+		if err := pairs.AddPrecertHash("honest-al", "1f", "aaaa"); err != nil {
+			return err
+		}
+		return pairs.AddPrecertHash("honest-al", "20", "cccc")
+	})
+	if pairs.PairedCount != 0 {
+		t.Error("Precertificates shouldn't pair with each other")
+	}
+	pairs = run(func(pairs *PrecertPairs) error {
+		if err := pairs.AddFinalHash("bbbb", final); err != nil {
+			return err
+		}
+		// Only the first final certificate is compared.
+		return pairs.AddFinalHash("aaaa", final)
+	})
+	if pairs.PairedCount != 1 || len(pairs.Mismatches) != 1 || pairs.Mismatches[0] != final {
+		t.Errorf("Unexpected mismatches %v", pairs.Mismatches)
+	}
+}
+
+func TestDBAppearanceStore(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	lookup, err := db.Prepare(`
+		select log, logIndex from certAppearances
+		where sha256Fingerprint = ? order by rowid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert, err := db.Prepare(`
+		insert into certAppearances(sha256Fingerprint, log, logIndex)
+		values(?, ?, ?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each run sees what earlier runs committed.
+	for i, log := range []string{"log1", "log2"} {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs := NewCertAppearances(&dbAppearanceStore{tx.Stmt(lookup), tx.Stmt(insert)})
+		first, err := certs.Add("a", LogAppearance{Log: log, Index: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != (i == 0) {
+			t.Errorf("%s: expected first to be %v", log, i == 0)
+		}
+		if first, _ := certs.Add("a", LogAppearance{Log: log, Index: 5}); first {
+			t.Errorf("%s: the same appearance shouldn't be counted again", log)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	store := &dbAppearanceStore{tx.Stmt(lookup), tx.Stmt(insert)}
+	appearances, err := store.Appearances("a")
+	if err != nil || len(appearances) != 2 || appearances[1].Log != "log2" {
+		t.Errorf("Unexpected appearances %v, %v", appearances, err)
+	}
+}
+
+func TestReadIssuerKeyMap(t *testing.T) {
+	db, cleanup := openTestDB(t)
+	defer cleanup()
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`
+		insert into issuerKeyIds(keyId, issuerKey)
+		values('keyid:01020304', 'spki')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := readIssuerKeyMap(db)
+	if resolved := keys.Resolve("keyid:01020304"); resolved != "spki" {
+		t.Errorf("Expected the key id learned by an earlier run, got %s", resolved)
+	}
+	if resolved := keys.Resolve("keyid:05"); resolved != "keyid:05" {
+		t.Errorf("Expected an unknown key id to be kept, got %s", resolved)
+	}
+}
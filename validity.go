@@ -0,0 +1,87 @@
+package sunlight
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// The maximum validity period of subscriber certificates has been reduced
+// several times. Each reduction is its own check so that a violation records
+// which version of the rule was broken. Exactly one of these applies to any
+// given certificate, chosen by its NotBefore.
+var (
+	// BR 1.0, 9.4.1: 60 months. Certs issued before BR 1.0 took effect are
+	// held to this as well, since nothing was stricter.
+	validity60MonthsDate = time.Time{}
+	// BR 1.1.8 (after CA/B Forum Ballot 111), 6.3.2: 39 months.
+	validity39MonthsDate = time.Date(2015, 4, 1, 0, 0, 0, 0, time.UTC)
+	// BR 1.5.0 (after Ballot 193), 6.3.2: 825 days.
+	validity825DaysDate = time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	// BR 1.7.1 (after Ballot SC31), 6.3.2: 398 days.
+	validity398DaysDate = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type validityRule struct {
+	checkInfo
+	// Returns the latest NotAfter permitted for a cert issued at notBefore.
+	maxNotAfter func(notBefore time.Time) time.Time
+}
+
+// Validity period limits only apply to subscriber certs, i.e. ones that
+// don't have CA:True. A rule stops applying once the next one takes effect.
+func (rule validityRule) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return false
+	}
+	if validityRuleFor(cert.NotBefore) != rule.ID() {
+		return false
+	}
+	return cert.NotAfter.After(rule.maxNotAfter(cert.NotBefore))
+}
+
+func maxValidityDays(days int) func(time.Time) time.Time {
+	return func(notBefore time.Time) time.Time {
+		return notBefore.Add(time.Duration(days) * 24 * time.Hour)
+	}
+}
+
+// The validity rules in the order they took effect, each superseding the
+// one before.
+var validityRules = []validityRule{
+	{checkInfo{VALID_PERIOD_TOO_LONG, "9.4.1", SEVERITY_ERROR,
+		validity60MonthsDate},
+		// Historically we've allowed a week of slack on top of 5 years.
+		func(notBefore time.Time) time.Time {
+			return notBefore.AddDate(5, 0, 7)
+		}},
+	{checkInfo{VALID_PERIOD_OVER_39_MONTHS, "6.3.2", SEVERITY_ERROR,
+		validity39MonthsDate},
+		func(notBefore time.Time) time.Time {
+			return notBefore.AddDate(0, 39, 0)
+		}},
+	{checkInfo{VALID_PERIOD_OVER_825_DAYS, "6.3.2", SEVERITY_ERROR,
+		validity825DaysDate},
+		maxValidityDays(825)},
+	{checkInfo{VALID_PERIOD_OVER_398_DAYS, "6.3.2", SEVERITY_ERROR,
+		validity398DaysDate},
+		maxValidityDays(398)},
+}
+
+// Returns the ID of the validity period check that applies to certs issued
+// at notBefore: the last of validityRules to have taken effect by then.
+func validityRuleFor(notBefore time.Time) string {
+	id := validityRules[0].ID()
+	for _, rule := range validityRules[1:] {
+		if notBefore.Before(rule.EffectiveDate()) {
+			break
+		}
+		id = rule.ID()
+	}
+	return id
+}
+
+func init() {
+	for _, rule := range validityRules {
+		RegisterCheck(rule)
+	}
+}
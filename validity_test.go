@@ -0,0 +1,60 @@
+package sunlight
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidityRules(t *testing.T) {
+	cases := []struct {
+		notBefore time.Time
+		years     int
+		days      int
+		violated  string
+	}{
+		{time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), 5, 0, ""},
+		{time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), 5, 8, VALID_PERIOD_TOO_LONG},
+		{time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), 3, 0, ""},
+		{time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), 4, 0, VALID_PERIOD_OVER_39_MONTHS},
+		{time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), 0, 825, ""},
+		{time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), 0, 826, VALID_PERIOD_OVER_825_DAYS},
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 0, 398, ""},
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 0, 399, VALID_PERIOD_OVER_398_DAYS},
+	}
+	validityChecks := []string{VALID_PERIOD_TOO_LONG, VALID_PERIOD_OVER_39_MONTHS,
+		VALID_PERIOD_OVER_825_DAYS, VALID_PERIOD_OVER_398_DAYS}
+	for _, c := range cases {
+		template := subscriberTemplate(c.notBefore)
+		template.NotAfter = c.notBefore.AddDate(c.years, 0, c.days)
+		cert := makeCert(t, template)
+		summary, _ := CalculateCertSummary(cert, 0, nil, nil, nil)
+		for _, id := range validityChecks {
+			if summary.Violations[id] != (id == c.violated) {
+				t.Errorf("%s for %s + %dy%dd: expected %v", id, c.notBefore,
+					c.years, c.days, id == c.violated)
+			}
+		}
+	}
+}
+
+func TestValidityRulesIgnoreCAs(t *testing.T) {
+	template := subscriberTemplate(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	template.NotAfter = template.NotBefore.AddDate(10, 0, 0)
+	template.IsCA = true
+	cert := makeCert(t, template)
+	if CheckByID(VALID_PERIOD_OVER_398_DAYS).Run(cert, nil) {
+		t.Error("CA certificates should not be held to subscriber validity limits")
+	}
+}
+
+func TestValidityRuleFor(t *testing.T) {
+	if validityRuleFor(time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)) != VALID_PERIOD_TOO_LONG {
+		t.Error("Expected 60 month rule for 2012")
+	}
+	if validityRuleFor(validity825DaysDate) != VALID_PERIOD_OVER_825_DAYS {
+		t.Error("Expected 825 day rule to apply from its effective date")
+	}
+	if validityRuleFor(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) != VALID_PERIOD_OVER_398_DAYS {
+		t.Error("Expected 398 day rule for 2024")
+	}
+}
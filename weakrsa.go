@@ -0,0 +1,174 @@
+package sunlight
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Primes used to detect keys generated by the Infineon RSALib (ROCA,
+// CVE-2017-15361). Moduli from that library are always of the form
+// k * M + (65537^a mod M), where M is a product of small primes, so for each
+// prime p, N mod p lies in the subgroup of Z_p* generated by 65537.
+var rocaPrimes = []int64{3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47,
+	53, 59, 61, 67, 71, 73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131,
+	137, 139, 149, 151, 157, 163, 167}
+
+// rocaSubgroups[i][r] is true if r is a power of 65537 mod rocaPrimes[i].
+var rocaSubgroups [][]bool
+
+// Moduli with a prime factor below this bound are considered weak.
+const smallFactorBound = 1 << 16
+
+// The product of all primes below smallFactorBound.
+var smallPrimeProduct *big.Int
+
+// How many steps of Fermat's factorization method to try. Moduli whose
+// factors are close enough to be found this quickly are considered weak.
+const fermatRounds = 100
+
+func init() {
+	for _, p := range rocaPrimes {
+		subgroup := make([]bool, p)
+		for r := int64(1); !subgroup[r]; r = (r * 65537) % p {
+			subgroup[r] = true
+		}
+		rocaSubgroups = append(rocaSubgroups, subgroup)
+	}
+
+	sieve := make([]bool, smallFactorBound)
+	smallPrimeProduct = big.NewInt(1)
+	for i := 2; i < smallFactorBound; i++ {
+		if sieve[i] {
+			continue
+		}
+		smallPrimeProduct.Mul(smallPrimeProduct, big.NewInt(int64(i)))
+		for j := i * i; j < smallFactorBound; j += i {
+			sieve[j] = true
+		}
+	}
+}
+
+// Returns true if n has the fingerprint of a ROCA-vulnerable key.
+func HasROCAFingerprint(n *big.Int) bool {
+	remainder := new(big.Int)
+	for i, p := range rocaPrimes {
+		remainder.Mod(n, big.NewInt(p))
+		if !rocaSubgroups[i][remainder.Int64()] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if n has a prime factor below smallFactorBound.
+func HasSmallPrimeFactor(n *big.Int) bool {
+	if n.Sign() <= 0 {
+		return false
+	}
+	gcd := new(big.Int).Mod(smallPrimeProduct, n)
+	gcd.GCD(nil, nil, gcd, n)
+	return gcd.Cmp(big.NewInt(1)) != 0
+}
+
+// Returns true if n can be factored with a few rounds of Fermat's method,
+// i.e. if n = p * q with p and q very close together.
+func IsFermatFactorable(n *big.Int) bool {
+	if n.Sign() <= 0 || n.Bit(0) == 0 {
+		return false
+	}
+	// Start at a = ceil(sqrt(n)) and look for a^2 - n being a square.
+	a := new(big.Int).Sqrt(n)
+	if new(big.Int).Mul(a, a).Cmp(n) != 0 {
+		a.Add(a, big.NewInt(1))
+	}
+	b2 := new(big.Int)
+	b := new(big.Int)
+	for i := 0; i < fermatRounds; i++ {
+		b2.Mul(a, a)
+		b2.Sub(b2, n)
+		b.Sqrt(b2)
+		if new(big.Int).Mul(b, b).Cmp(b2) == 0 {
+			return true
+		}
+		a.Add(a, big.NewInt(1))
+	}
+	return false
+}
+
+var debianWeakKeysLock sync.RWMutex
+var debianWeakKeys = make(map[string]bool)
+
+// Returns the fingerprint the Debian openssl-blacklist files use for n: the
+// last 20 hex digits of the SHA-1 of "Modulus=<N in upper case hex>\n".
+func debianWeakKeyFingerprint(n *big.Int) string {
+	modulus := fmt.Sprintf("Modulus=%X\n", n)
+	digest := sha1.Sum([]byte(modulus))
+	return hex.EncodeToString(digest[len(digest)-10:])
+}
+
+// Adds the fingerprints in filename (in the format of the Debian
+// openssl-blacklist package, e.g. blacklist.RSA-2048) to the set of known
+// Debian weak keys. This can be called once per file for each key size.
+func LoadDebianWeakKeys(filename string) error {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return &FileError{filename, err}
+	}
+	debianWeakKeysLock.Lock()
+	defer debianWeakKeysLock.Unlock()
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		debianWeakKeys[line] = true
+	}
+	return nil
+}
+
+// Returns true if n is in one of the loaded Debian weak key lists.
+func IsDebianWeakKey(n *big.Int) bool {
+	debianWeakKeysLock.RLock()
+	defer debianWeakKeysLock.RUnlock()
+	if len(debianWeakKeys) == 0 {
+		return false
+	}
+	return debianWeakKeys[debianWeakKeyFingerprint(n)]
+}
+
+// rsaModulusCheck flags RSA keys for which weak returns true.
+type rsaModulusCheck struct {
+	checkInfo
+	weak func(key *rsa.PublicKey) bool
+}
+
+func (check rsaModulusCheck) Run(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	return ok && check.weak(key)
+}
+
+func init() {
+	RegisterCheck(rsaModulusCheck{
+		checkInfo{ROCA_FINGERPRINT, "6.1.1.3", SEVERITY_ERROR, time.Time{}},
+		func(key *rsa.PublicKey) bool { return HasROCAFingerprint(key.N) }})
+	RegisterCheck(rsaModulusCheck{
+		checkInfo{DEBIAN_WEAK_KEY, "6.1.1.3", SEVERITY_ERROR, time.Time{}},
+		func(key *rsa.PublicKey) bool { return IsDebianWeakKey(key.N) }})
+	RegisterCheck(rsaModulusCheck{
+		checkInfo{SMALL_PRIME_FACTOR, "6.1.6", SEVERITY_ERROR, time.Time{}},
+		func(key *rsa.PublicKey) bool { return HasSmallPrimeFactor(key.N) }})
+	RegisterCheck(rsaModulusCheck{
+		checkInfo{EVEN_EXPONENT, "6.1.6", SEVERITY_ERROR, time.Time{}},
+		func(key *rsa.PublicKey) bool { return key.E%2 == 0 }})
+	RegisterCheck(rsaModulusCheck{
+		checkInfo{FERMAT_FACTORABLE, "6.1.1.3", SEVERITY_ERROR, time.Time{}},
+		func(key *rsa.PublicKey) bool { return IsFermatFactorable(key.N) }})
+}
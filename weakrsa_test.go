@@ -0,0 +1,115 @@
+package sunlight
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func rsaCert(n *big.Int, e int) *x509.Certificate {
+	return &x509.Certificate{
+		PublicKeyAlgorithm: x509.RSA,
+		PublicKey:          &rsa.PublicKey{N: n, E: e},
+	}
+}
+
+// Returns the first probable prime >= n.
+func nextPrime(n *big.Int) *big.Int {
+	p := new(big.Int).Set(n)
+	for !p.ProbablyPrime(20) {
+		p.Add(p, big.NewInt(1))
+	}
+	return p
+}
+
+func TestWeakRSAChecksOnGoodKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	cert := rsaCert(key.N, key.E)
+	for _, id := range []string{ROCA_FINGERPRINT, DEBIAN_WEAK_KEY,
+		SMALL_PRIME_FACTOR, EVEN_EXPONENT, FERMAT_FACTORABLE} {
+		if CheckByID(id).Run(cert, nil) {
+			t.Errorf("Freshly generated key should not violate %s", id)
+		}
+	}
+}
+
+func TestROCAFingerprint(t *testing.T) {
+	// 65537 + k * M, where M is the product of rocaPrimes, has the same
+	// residues as 65537 mod every prime in rocaPrimes.
+	m := big.NewInt(1)
+	for _, p := range rocaPrimes {
+		m.Mul(m, big.NewInt(p))
+	}
+	n := new(big.Int).Lsh(big.NewInt(1), 2000)
+	n.Div(n, m)
+	n.Mul(n, m)
+	n.Add(n, big.NewInt(65537))
+	if !CheckByID(ROCA_FINGERPRINT).Run(rsaCert(n, 65537), nil) {
+		t.Error("Expected ROCA fingerprint to be detected")
+	}
+}
+
+func TestSmallPrimeFactor(t *testing.T) {
+	prime := nextPrime(new(big.Int).Lsh(big.NewInt(1), 1020))
+	n := new(big.Int).Mul(prime, big.NewInt(65521))
+	if !HasSmallPrimeFactor(n) {
+		t.Error("Expected 65521 to be found as a factor")
+	}
+	if !CheckByID(SMALL_PRIME_FACTOR).Run(rsaCert(new(big.Int).Lsh(prime, 1), 65537), nil) {
+		t.Error("Even moduli have a small prime factor")
+	}
+}
+
+func TestEvenExponent(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	if !CheckByID(EVEN_EXPONENT).Run(rsaCert(key.N, 65536), nil) {
+		t.Error("Expected even exponent to be flagged")
+	}
+}
+
+func TestFermatFactorable(t *testing.T) {
+	p := nextPrime(new(big.Int).Lsh(big.NewInt(1), 1023))
+	q := nextPrime(new(big.Int).Add(p, big.NewInt(2)))
+	n := new(big.Int).Mul(p, q)
+	if !CheckByID(FERMAT_FACTORABLE).Run(rsaCert(n, 65537), nil) {
+		t.Error("Expected close primes to be found by Fermat's method")
+	}
+}
+
+func TestDebianWeakKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("could not generate key", err)
+	}
+	cert := rsaCert(key.N, key.E)
+	if CheckByID(DEBIAN_WEAK_KEY).Run(cert, nil) {
+		t.Error("Key should not be weak before the list is loaded")
+	}
+	f, err := ioutil.TempFile("", "blacklist.RSA-1024")
+	if err != nil {
+		t.Fatal("could not create temp file", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, "# comment\n%s\n", debianWeakKeyFingerprint(key.N))
+	f.Close()
+	if err := LoadDebianWeakKeys(f.Name()); err != nil {
+		t.Fatal("could not load weak keys", err)
+	}
+	if !CheckByID(DEBIAN_WEAK_KEY).Run(cert, nil) {
+		t.Error("Key should be weak after the list is loaded")
+	}
+	if LoadDebianWeakKeys(f.Name()+".missing") == nil {
+		t.Error("Loading a missing file should fail")
+	}
+}